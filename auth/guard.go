@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+)
+
+// defaultAPIKeyHeader carries API keys unless api_key_header is configured.
+const defaultAPIKeyHeader = "X-API-Key"
+
+// Guard is HTTP middleware that rejects unauthenticated requests and stores
+// the client identity in the request context. Its settings can be replaced
+// at runtime with Update.
+type Guard struct {
+	state atomic.Pointer[guardState]
+}
+
+type guardState struct {
+	header  string
+	apiKeys []hyancie.APIKeyConfig
+	jwt     *jwtVerifier
+}
+
+// NewGuard builds a guard for the settings. A nil config lets every request through.
+func NewGuard(config *hyancie.ServerAuthConfig) (*Guard, error) {
+	g := &Guard{}
+	if err := g.Update(config); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Update replaces the settings, e.g. after a config reload. On error the
+// current settings stay active.
+func (g *Guard) Update(config *hyancie.ServerAuthConfig) error {
+	if config == nil {
+		g.state.Store(nil)
+		return nil
+	}
+	state := &guardState{header: config.APIKeyHeader, apiKeys: config.APIKeys}
+	if state.header == "" {
+		state.header = defaultAPIKeyHeader
+	}
+	if config.JWT != nil {
+		verifier, err := newJWTVerifier(*config.JWT)
+		if err != nil {
+			return err
+		}
+		state.jwt = verifier
+	}
+	g.state.Store(state)
+	return nil
+}
+
+// Enabled reports whether requests must be authenticated.
+func (g *Guard) Enabled() bool {
+	return g.state.Load() != nil
+}
+
+// Middleware authenticates every request before it reaches next, so that no
+// MCP session is created for unauthenticated clients. CORS preflight requests
+// must be answered before this middleware.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := g.state.Load()
+		if state == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, reason := state.authenticate(r)
+		if identity == nil {
+			logging.Logger.Warn("Rejected unauthenticated request", "remote_addr", r.RemoteAddr, "path", r.URL.Path, "reason", reason)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="hyancie"`)
+			http.Error(w, "unauthorized: "+reason, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// authenticate checks the API key header, then the bearer token. It returns
+// the identity, or nil and the reason for the rejection.
+func (s *guardState) authenticate(r *http.Request) (*Identity, string) {
+	if key := r.Header.Get(s.header); key != "" {
+		if identity := s.lookupAPIKey(key); identity != nil {
+			return identity, ""
+		}
+		return nil, "invalid API key"
+	}
+
+	authorization := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, "missing credentials"
+	}
+	token = strings.TrimSpace(token)
+	if identity := s.lookupAPIKey(token); identity != nil {
+		return identity, ""
+	}
+	if s.jwt == nil {
+		return nil, "invalid API key"
+	}
+	identity, err := s.jwt.Verify(token)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return identity, ""
+}
+
+// lookupAPIKey compares the key with every configured key in constant time.
+func (s *guardState) lookupAPIKey(key string) *Identity {
+	var match *hyancie.APIKeyConfig
+	for i := range s.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKeys[i].Key)) == 1 {
+			match = &s.apiKeys[i]
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return &Identity{ClientID: match.ClientID, Roles: match.Roles, Method: "api_key"}
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := logging.InitLogger(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// serveWithGuard runs a request through the guard and returns the response and the identity seen by the handler.
+func serveWithGuard(g *Guard, headers map[string]string) (*httptest.ResponseRecorder, *Identity) {
+	var seen *Identity
+	handler := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = IdentityFromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, seen
+}
+
+func TestGuardAPIKeys(t *testing.T) {
+	g, err := NewGuard(&hyancie.ServerAuthConfig{
+		APIKeys: []hyancie.APIKeyConfig{
+			{Key: "support-key", ClientID: "support-bot", Roles: []string{"support"}},
+			{Key: "admin-key", ClientID: "ops", Roles: []string{"admin"}},
+		},
+	})
+	require.NoError(t, err)
+
+	rec, identity := serveWithGuard(g, map[string]string{"X-API-Key": "support-key"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &Identity{ClientID: "support-bot", Roles: []string{"support"}, Method: "api_key"}, identity)
+
+	rec, identity = serveWithGuard(g, map[string]string{"Authorization": "Bearer admin-key"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ops", identity.ClientID)
+
+	for _, headers := range []map[string]string{
+		{},
+		{"X-API-Key": "wrong"},
+		{"Authorization": "Bearer wrong"},
+		{"Authorization": "Basic c3VwcG9ydC1rZXk="},
+	} {
+		rec, identity = serveWithGuard(g, headers)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, headers)
+		assert.Nil(t, identity)
+	}
+
+	// A nil config disables authentication.
+	require.NoError(t, g.Update(nil))
+	rec, identity = serveWithGuard(g, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, identity)
+}
+
+func TestGuardJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "key-1",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	jwksData, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, jwksData, 0o600))
+
+	g, err := NewGuard(&hyancie.ServerAuthConfig{JWT: &hyancie.JWTConfig{
+		HS256Secret: "shared-secret",
+		JWKSFile:    jwksFile,
+		Issuer:      "https://idp.example.com",
+		Audience:    "hyancie",
+	}})
+	require.NoError(t, err)
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{
+		"sub":   "agent-7",
+		"iss":   "https://idp.example.com",
+		"aud":   []string{"hyancie", "other"},
+		"exp":   now + 300,
+		"roles": []string{"support", "readonly"},
+	}
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		claims := make(map[string]interface{}, len(valid))
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range changes {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	rec, identity := serveWithGuard(g, map[string]string{"Authorization": "Bearer " + signHS256(t, "shared-secret", valid)})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, &Identity{ClientID: "agent-7", Roles: []string{"support", "readonly"}, Method: "jwt"}, identity)
+
+	rec, identity = serveWithGuard(g, map[string]string{"Authorization": "Bearer " + signRS256(t, key, "key-1", with(map[string]interface{}{"roles": "admin ops"}))})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, []string{"admin", "ops"}, identity.Roles)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	for name, token := range map[string]string{
+		"wrong secret":   signHS256(t, "other-secret", valid),
+		"wrong key":      signRS256(t, otherKey, "key-1", valid),
+		"unknown kid":    signRS256(t, key, "key-2", valid),
+		"expired":        signHS256(t, "shared-secret", with(map[string]interface{}{"exp": now - 120})),
+		"no expiry":      signHS256(t, "shared-secret", with(map[string]interface{}{"exp": nil})),
+		"not yet valid":  signHS256(t, "shared-secret", with(map[string]interface{}{"nbf": now + 120})),
+		"wrong issuer":   signHS256(t, "shared-secret", with(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"wrong audience": signHS256(t, "shared-secret", with(map[string]interface{}{"aud": "other"})),
+		"no subject":     signHS256(t, "shared-secret", with(map[string]interface{}{"sub": ""})),
+		"alg none":       encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, valid) + ".",
+		"malformed":      "not-a-jwt",
+	} {
+		rec, identity = serveWithGuard(g, map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, name)
+		assert.Nil(t, identity, name)
+	}
+
+	// Tokens without exp are only accepted with allow_no_exp.
+	require.NoError(t, g.Update(&hyancie.ServerAuthConfig{JWT: &hyancie.JWTConfig{HS256Secret: "shared-secret", AllowNoExp: true}}))
+	rec, identity = serveWithGuard(g, map[string]string{"Authorization": "Bearer " + signHS256(t, "shared-secret", with(map[string]interface{}{"exp": nil}))})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "agent-7", identity.ClientID)
+
+	// An invalid update keeps the current settings.
+	require.Error(t, g.Update(&hyancie.ServerAuthConfig{JWT: &hyancie.JWTConfig{JWKSFile: "/nonexistent/jwks.json"}}))
+	rec, _ = serveWithGuard(g, map[string]string{"Authorization": "Bearer " + signHS256(t, "shared-secret", valid)})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestGuardRejectsBeforeSessionCreation(t *testing.T) {
+	g, err := NewGuard(&hyancie.ServerAuthConfig{APIKeys: []hyancie.APIKeyConfig{{Key: "k", ClientID: "c"}}})
+	require.NoError(t, err)
+	s := server.NewMCPServer("test", "1.0")
+	handler := g.Middleware(server.NewStreamableHTTPServer(s))
+
+	initialize := `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-03-26", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}}`
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(initialize))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get("Mcp-Session-Id"))
+
+	rec = send("k")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Mcp-Session-Id"))
+}
@@ -0,0 +1,26 @@
+// Package auth authenticates clients of the network transports and carries
+// their identity through the request context to tool handlers.
+package auth
+
+import "context"
+
+// Identity is an authenticated client.
+type Identity struct {
+	ClientID string
+	Roles    []string
+	Method   string // "api_key" or "jwt"
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the calling client, or nil if
+// the request was not authenticated (stdio, or no server_auth configured).
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
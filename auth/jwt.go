@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+// defaultLeeway is the clock skew tolerated for exp and nbf.
+const defaultLeeway = 30 * time.Second
+
+// jwtVerifier validates HS256 and RS256 bearer tokens.
+type jwtVerifier struct {
+	secret       []byte
+	keys         map[string]*rsa.PublicKey // RS256 keys by kid
+	issuer       string
+	audience     string
+	subjectClaim string
+	rolesClaim   string
+	leeway       time.Duration
+	allowNoExp   bool
+	now          func() time.Time
+}
+
+func newJWTVerifier(config hyancie.JWTConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{
+		issuer:       config.Issuer,
+		audience:     config.Audience,
+		subjectClaim: config.SubjectClaim,
+		rolesClaim:   config.RolesClaim,
+		leeway:       defaultLeeway,
+		allowNoExp:   config.AllowNoExp,
+		now:          time.Now,
+	}
+	if config.HS256Secret != "" {
+		v.secret = []byte(config.HS256Secret)
+	}
+	if v.subjectClaim == "" {
+		v.subjectClaim = "sub"
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = "roles"
+	}
+	if config.Leeway != "" {
+		leeway, err := time.ParseDuration(config.Leeway)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt leeway %q: %w", config.Leeway, err)
+		}
+		v.leeway = leeway
+	}
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	}
+	if v.secret == nil && len(v.keys) == 0 {
+		return nil, errors.New("jwt requires hs256_secret or a jwks_file with RSA keys")
+	}
+	return v, nil
+}
+
+// jwk is the subset of a JSON Web Key needed for RS256.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJWKS reads the RSA signing keys of a JWKS file.
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks_file: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks_file %s: %w", path, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") || (key.Alg != "" && key.Alg != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key.N, "="))
+		if err != nil {
+			return nil, fmt.Errorf("jwks_file %s: invalid modulus of key %q", path, key.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key.E, "="))
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwks_file %s: invalid exponent of key %q", path, key.Kid)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks_file %s contains no RSA signing keys", path)
+	}
+	return keys, nil
+}
+
+// Verify checks the token signature and claims and returns the client identity.
+func (v *jwtVerifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if v.secret == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid token signature")
+		}
+	case "RS256":
+		key, ok := v.keys[header.Kid]
+		if !ok && header.Kid == "" && len(v.keys) == 1 {
+			for _, only := range v.keys {
+				key, ok = only, true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", header.Kid)
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("invalid token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims[v.subjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no %q claim", v.subjectClaim)
+	}
+	return &Identity{ClientID: subject, Roles: stringList(claims[v.rolesClaim]), Method: "jwt"}, nil
+}
+
+// checkClaims validates the time, issuer and audience claims. Tokens without
+// "exp" would be valid forever and are rejected unless allow_no_exp is set.
+func (v *jwtVerifier) checkClaims(claims map[string]interface{}) error {
+	now := v.now()
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+			return errors.New("token has expired")
+		}
+	} else if !v.allowNoExp {
+		return errors.New("token has no exp claim")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+			return errors.New("token is not valid yet")
+		}
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("unexpected token issuer %q", iss)
+		}
+	}
+	if v.audience != "" {
+		found := false
+		for _, aud := range stringList(claims["aud"]) {
+			if aud == v.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("token audience does not match")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// stringList reads a claim given as an array of strings or a space-separated string.
+func stringList(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []interface{}:
+		var out []string
+		for _, item := range typed {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync/atomic"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Policy enforces per-client tool access control. It filters tools/list and
+// rejects calls to tools the client may not use. Config validation requires
+// server_auth with access_control, so every request of a network transport
+// carries an identity. Requests without one come from the stdio transport,
+// whose client is the local user who started the server, and are not restricted.
+type Policy struct {
+	config atomic.Pointer[hyancie.AccessControlConfig]
+}
+
+// Update replaces the access control settings. A nil config allows every tool.
+func (p *Policy) Update(config *hyancie.AccessControlConfig) {
+	p.config.Store(config)
+}
+
+// Allowed reports whether the identity may use the tool.
+func (p *Policy) Allowed(identity *Identity, toolName string) bool {
+	config := p.config.Load()
+	if config == nil || identity == nil {
+		return true
+	}
+
+	matched, allowed := false, false
+	for _, rule := range config.Rules {
+		if !ruleApplies(rule, identity) {
+			continue
+		}
+		matched = true
+		if matchesAny(rule.Deny, toolName) {
+			return false
+		}
+		if matchesAny(rule.Allow, toolName) {
+			allowed = true
+		}
+	}
+	if !matched {
+		return config.DefaultPolicy == "allow"
+	}
+	return allowed
+}
+
+// FilterTools is a server.ToolFilterFunc that hides the tools the client may not use.
+func (p *Policy) FilterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	identity := IdentityFromContext(ctx)
+	visible := make([]mcp.Tool, 0, len(tools))
+	var hidden []string
+	for _, tool := range tools {
+		if p.Allowed(identity, tool.Name) {
+			visible = append(visible, tool)
+		} else {
+			hidden = append(hidden, tool.Name)
+		}
+	}
+	if len(hidden) > 0 {
+		logging.Logger.Debug("Tools hidden by access control", "client_id", identity.ClientID, "tools", hidden)
+	}
+	return visible
+}
+
+// Middleware is a server.ToolHandlerMiddleware that rejects calls to tools
+// the client may not use, including tools hidden from tools/list.
+func (p *Policy) Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		identity := IdentityFromContext(ctx)
+		if !p.Allowed(identity, request.Params.Name) {
+			logging.Logger.Warn("Tool call denied", "tool_name", request.Params.Name, "client_id", identity.ClientID, "roles", identity.Roles)
+			return mcp.NewToolResultError(fmt.Sprintf("access denied: client %q may not call tool %q", identity.ClientID, request.Params.Name)), nil
+		}
+		return next(ctx, request)
+	}
+}
+
+// ruleApplies reports whether the rule names the client or one of its roles.
+func ruleApplies(rule hyancie.AccessRule, identity *Identity) bool {
+	for _, client := range rule.Clients {
+		if client == identity.ClientID {
+			return true
+		}
+	}
+	for _, role := range rule.Roles {
+		for _, has := range identity.Roles {
+			if role == has {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether the tool name matches one of the glob patterns.
+func matchesAny(patterns []string, toolName string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, toolName); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy := &Policy{}
+	support := &Identity{ClientID: "support-bot", Roles: []string{"support"}}
+	admin := &Identity{ClientID: "ops", Roles: []string{"admin", "support"}}
+	stranger := &Identity{ClientID: "stranger"}
+
+	// Without access_control every tool is allowed.
+	assert.True(t, policy.Allowed(support, "create_user_cn"))
+
+	policy.Update(&hyancie.AccessControlConfig{Rules: []hyancie.AccessRule{
+		{Roles: []string{"support"}, Allow: []string{"get_*", "food-info-search"}},
+		{Roles: []string{"admin"}, Allow: []string{"*"}},
+		{Clients: []string{"support-bot"}, Deny: []string{"get_internal_*"}},
+	}})
+
+	assert.True(t, policy.Allowed(support, "get_weather_cn"))
+	assert.True(t, policy.Allowed(support, "food-info-search"))
+	assert.False(t, policy.Allowed(support, "create_user_cn"))
+	assert.False(t, policy.Allowed(support, "get_internal_stats"))
+	assert.True(t, policy.Allowed(admin, "create_user_cn"))
+	assert.True(t, policy.Allowed(admin, "get_internal_stats"))
+	assert.False(t, policy.Allowed(stranger, "get_weather_cn"))
+
+	// Unauthenticated requests (stdio) are not restricted.
+	assert.True(t, policy.Allowed(nil, "create_user_cn"))
+
+	policy.Update(&hyancie.AccessControlConfig{DefaultPolicy: "allow", Rules: []hyancie.AccessRule{
+		{Clients: []string{"support-bot"}, Deny: []string{"create_*"}},
+	}})
+	assert.True(t, policy.Allowed(stranger, "create_user_cn"))
+	assert.False(t, policy.Allowed(support, "create_user_cn"))
+}
+
+func TestPolicyEnforcedByServer(t *testing.T) {
+	policy := &Policy{}
+	policy.Update(&hyancie.AccessControlConfig{Rules: []hyancie.AccessRule{
+		{Roles: []string{"support"}, Allow: []string{"get_*"}},
+	}})
+
+	s := server.NewMCPServer("test", "1.0",
+		server.WithToolCapabilities(true),
+		server.WithToolFilter(policy.FilterTools),
+		server.WithToolHandlerMiddleware(policy.Middleware),
+	)
+	echo := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("called " + request.Params.Name), nil
+	}
+	s.AddTool(mcp.NewTool("get_weather_cn"), echo)
+	s.AddTool(mcp.NewTool("create_user_cn"), echo)
+
+	ctx := WithIdentity(context.Background(), &Identity{ClientID: "support-bot", Roles: []string{"support"}})
+
+	listResponse := s.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`))
+	list, ok := listResponse.(mcp.JSONRPCResponse)
+	require.True(t, ok, "%#v", listResponse)
+	var names []string
+	for _, tool := range list.Result.(mcp.ListToolsResult).Tools {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"get_weather_cn"}, names)
+
+	call := func(ctx context.Context, name string) mcp.CallToolResult {
+		response := s.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "`+name+`"}}`))
+		result, ok := response.(mcp.JSONRPCResponse)
+		require.True(t, ok, "%#v", response)
+		return result.Result.(mcp.CallToolResult)
+	}
+
+	result := call(ctx, "create_user_cn")
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "access denied")
+
+	result = call(ctx, "get_weather_cn")
+	assert.False(t, result.IsError)
+	assert.Equal(t, "called get_weather_cn", result.Content[0].(mcp.TextContent).Text)
+
+	// Without an identity (stdio) the policy does not apply.
+	result = call(context.Background(), "create_user_cn")
+	assert.False(t, result.IsError)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	hyancieMCP "github.com/liu599/hyancie"
+)
+
+// runImport implements the "import" subcommand:
+//
+//	hyancie import openapi [--base-url URL] [--prefix PREFIX] [--operations a,b] [--output FILE] spec.yaml
+//
+// It prints a config fragment with the generated mcp_tools, which can be
+// pasted into config.json.
+func runImport(args []string) error {
+	if len(args) == 0 || args[0] != "openapi" {
+		return fmt.Errorf("usage: hyancie import openapi [flags] <spec.yaml|spec.json>")
+	}
+
+	fs := flag.NewFlagSet("import openapi", flag.ContinueOnError)
+	baseURL := fs.String("base-url", "", "Override the base URL declared in the document")
+	prefix := fs.String("prefix", "", "Prefix added to every generated tool name")
+	operations := fs.String("operations", "", "Comma-separated operationIds to import (default: all)")
+	output := fs.String("output", "", "Write the generated config to this file instead of stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: hyancie import openapi [flags] <spec.yaml|spec.json>")
+	}
+
+	opts := hyancieMCP.ImportOptions{
+		BaseURL:    *baseURL,
+		ToolPrefix: *prefix,
+	}
+	if *operations != "" {
+		opts.Operations = strings.Split(*operations, ",")
+	}
+
+	tools, err := hyancieMCP.ImportOpenAPIFile(fs.Arg(0), opts)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(struct {
+		McpTools []hyancieMCP.GenericToolConfig `json:"mcp_tools"`
+	}{tools}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode generated tools: %w", err)
+	}
+	out = append(out, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return os.WriteFile(*output, out, 0o644)
+}
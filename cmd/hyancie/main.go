@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/auth"
 	"github.com/liu599/hyancie/logging"
 	"github.com/liu599/hyancie/tools"
 
@@ -16,10 +18,23 @@ import (
 	"github.com/rs/cors"
 )
 
+// configFile is the name of the config file next to the executable.
+const configFile = "config.json"
+
 func newServer() (*server.MCPServer, error) {
+	policy.Update(hyancieMCP.Config.AccessControl)
+	limiter.Update(hyancieMCP.Config)
+	hooks := &server.Hooks{}
+	hooks.AddAfterListTools(tools.AddOutputSchemas)
 	s := server.NewMCPServer(
 		hyancieMCP.Config.ServerName,
 		hyancieMCP.Config.ServerVersion,
+		server.WithToolCapabilities(true),
+		server.WithToolFilter(policy.FilterTools),
+		server.WithHooks(hooks),
+		// Access control runs first, so that denied calls use up no rate limit
+		server.WithToolHandlerMiddleware(policy.Middleware),
+		server.WithToolHandlerMiddleware(limiter.Middleware),
 	)
 
 	// Add generic tools from config.json
@@ -30,16 +45,70 @@ func newServer() (*server.MCPServer, error) {
 	return s, nil
 }
 
-func run(transport, addr string) error {
+// guard authenticates clients of the network transports, policy limits the
+// tools they may use and limiter throttles tool calls. Their settings follow
+// config reloads.
+var (
+	guard   = &auth.Guard{}
+	policy  = &auth.Policy{}
+	limiter = tools.NewRateLimiter()
+)
+
+// newCORS builds the CORS policy shared by the network transports.
+func newCORS() *cors.Cors {
+	options := cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"Mcp-Session-Id"},
+	}
+	if c := hyancieMCP.Config.CORS; c != nil {
+		if len(c.AllowedOrigins) > 0 {
+			options.AllowedOrigins = c.AllowedOrigins
+		}
+		if len(c.AllowedHeaders) > 0 {
+			options.AllowedHeaders = c.AllowedHeaders
+		}
+		options.AllowCredentials = c.AllowCredentials
+		options.MaxAge = c.MaxAge
+	}
+	return cors.New(options)
+}
+
+// newHTTPHandler wraps a transport handler with CORS and inbound authentication.
+// CORS runs first so that preflight requests, which carry no credentials, are answered.
+func newHTTPHandler(handler http.Handler) http.Handler {
+	if !guard.Enabled() {
+		logging.Logger.Warn("server_auth is not configured, all tools are reachable without authentication")
+	}
+	return newCORS().Handler(guard.Middleware(handler))
+}
+
+// httpEndpointPath returns the configured streamable HTTP endpoint path, defaulting to /mcp.
+func httpEndpointPath() string {
+	path := hyancieMCP.Config.HttpEndpoint
+	if path == "" {
+		path = "/mcp"
+	}
+	return "/" + strings.Trim(path, "/")
+}
+
+// setup initializes logging and loads config.json, so that command line
+// flags can default to the configured values.
+func setup() error {
 	// 初始化日志
 	if err := logging.InitLogger(); err != nil {
 		return fmt.Errorf("初始化日志失败: %v", err)
 	}
 
 	// 加载配置
-	if err := hyancieMCP.LoadConfig("config.json"); err != nil {
+	if err := hyancieMCP.LoadConfig(configFile); err != nil {
 		return fmt.Errorf("加载配置失败: %v", err)
 	}
+	return nil
+}
+
+func run(transport string) error {
 	defer func() {
 		// Give the logger time to flush
 		time.Sleep(1 * time.Second)
@@ -50,31 +119,65 @@ func run(transport, addr string) error {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
+	if err := guard.Update(hyancieMCP.Config.ServerAuth); err != nil {
+		return fmt.Errorf("invalid server_auth: %w", err)
+	}
+
+	configPath, err := hyancieMCP.ResolveConfigPath(configFile)
+	if err != nil {
+		return err
+	}
+	go watchConfig(context.Background(), s, configPath)
+
 	switch transport {
 	case "stdio":
+		if hyancieMCP.Config.AccessControl != nil {
+			logging.Logger.Warn("access_control does not apply to the stdio transport, all tools are available")
+		}
 		srv := server.NewStdioServer(s)
 		logging.Logger.Info("Stdio server start")
 		return srv.Listen(context.Background(), os.Stdin, os.Stdout)
 	case "sse":
-		url := hyancieMCP.Config.SseBaseUrl
-		c := cors.New(cors.Options{
-			AllowedOrigins:   []string{"*"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders:   []string{"*"},
-			AllowCredentials: true,
-		})
-
+		addr := hyancieMCP.Config.SseAddress
 		srv := server.NewSSEServer(s,
-			server.WithBaseURL(url),
+			server.WithBaseURL(hyancieMCP.Config.SseBaseUrl),
 		)
 		logging.Logger.Info("SSE server listening on", "address", addr)
-		handler := c.Handler(srv)
+		handler := newHTTPHandler(srv)
+		if err := http.ListenAndServe(addr, handler); err != nil {
+			return fmt.Errorf("Server error: %v", err)
+		}
+	case "http":
+		addr := hyancieMCP.Config.HttpAddress
+		endpoint := httpEndpointPath()
+		srv := server.NewStreamableHTTPServer(s)
+		mux := http.NewServeMux()
+		mux.Handle(endpoint, srv)
+		logging.Logger.Info("Streamable HTTP server listening on", "address", addr, "endpoint", endpoint)
+		handler := newHTTPHandler(mux)
+		if err := http.ListenAndServe(addr, handler); err != nil {
+			return fmt.Errorf("Server error: %v", err)
+		}
+	case "sse+http":
+		// Serve both transports from the SSE listener so existing SSE clients
+		// keep working while new clients move to streamable HTTP.
+		addr := hyancieMCP.Config.SseAddress
+		endpoint := httpEndpointPath()
+		sseSrv := server.NewSSEServer(s,
+			server.WithBaseURL(hyancieMCP.Config.SseBaseUrl),
+		)
+		httpSrv := server.NewStreamableHTTPServer(s)
+		mux := http.NewServeMux()
+		mux.Handle(endpoint, httpSrv)
+		mux.Handle("/", sseSrv)
+		logging.Logger.Info("SSE and streamable HTTP server listening on", "address", addr, "endpoint", endpoint)
+		handler := newHTTPHandler(mux)
 		if err := http.ListenAndServe(addr, handler); err != nil {
 			return fmt.Errorf("Server error: %v", err)
 		}
 	default:
 		return fmt.Errorf(
-			"Invalid transport type: %s. Must be 'stdio' or 'sse'",
+			"Invalid transport type: %s. Must be 'stdio', 'sse', 'http' or 'sse+http'",
 			transport,
 		)
 	}
@@ -82,17 +185,31 @@ func run(transport, addr string) error {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := setup(); err != nil {
+		panic(err)
+	}
+
 	var transport string
-	flag.StringVar(&transport, "t", "stdio", "Transport type (stdio or sse)")
+	flag.StringVar(&transport, "t", "stdio", "Transport type (stdio, sse, http or sse+http)")
 	flag.StringVar(
 		&transport,
 		"transport",
 		"stdio",
-		"Transport type (stdio or sse)",
+		"Transport type (stdio, sse, http or sse+http)",
 	)
-	// Set default SSE address from config, but allow override from command line.
+	// Set default addresses from config, but allow override from command line.
 	addr := flag.String("sse-address", hyancieMCP.Config.SseAddress, "The host and port to start the sse server on")
 	baseUrl := flag.String("sse-base-url", hyancieMCP.Config.SseBaseUrl, "The public-facing base URL for the SSE server")
+	httpAddr := flag.String("http-address", hyancieMCP.Config.HttpAddress, "The host and port to start the streamable HTTP server on")
+	httpEndpoint := flag.String("http-endpoint-path", hyancieMCP.Config.HttpEndpoint, "The endpoint path of the streamable HTTP server")
 	flag.Parse()
 
 	// Update config with flag values if they are provided
@@ -102,8 +219,14 @@ func main() {
 	if *baseUrl != "" {
 		hyancieMCP.Config.SseBaseUrl = *baseUrl
 	}
+	if *httpAddr != "" {
+		hyancieMCP.Config.HttpAddress = *httpAddr
+	}
+	if *httpEndpoint != "" {
+		hyancieMCP.Config.HttpEndpoint = *httpEndpoint
+	}
 
-	if err := run(transport, hyancieMCP.Config.SseAddress); err != nil {
+	if err := run(transport); err != nil {
 		panic(err)
 	}
 }
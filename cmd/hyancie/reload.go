@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+	"github.com/liu599/hyancie/tools"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// defaultReloadInterval is how often config.json and the files it references
+// are polled for changes.
+const defaultReloadInterval = 2 * time.Second
+
+// fileState identifies a version of a watched file on disk.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statConfig(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// statWatched returns the state of the config file and of the secret files
+// and OpenAPI documents the current config was built from.
+func statWatched(configPath string) map[string]fileState {
+	paths := append([]string{configPath}, hyancieMCP.CurrentConfig().ReferencedFiles...)
+	states := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		states[path] = statConfig(path)
+	}
+	return states
+}
+
+// rewatch returns the states to compare against after a reload. Files that
+// were already watched keep the state seen before the reload, so that changes
+// made during it trigger another one; files the new config added start with
+// their current state, and files it no longer references are dropped.
+func rewatch(last map[string]fileState, configPath string) map[string]fileState {
+	next := statWatched(configPath)
+	for path := range next {
+		if state, ok := last[path]; ok {
+			next[path] = state
+		}
+	}
+	return next
+}
+
+// watchConfig reloads the config file whenever it or a file it references
+// changes on disk, or the process receives SIGHUP. It blocks until ctx is
+// cancelled.
+func watchConfig(ctx context.Context, s *server.MCPServer, configPath string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if settings := hyancieMCP.CurrentConfig().HotReload; !settings.Disabled {
+		interval := defaultReloadInterval
+		if settings.Interval > 0 {
+			interval = time.Duration(settings.Interval) * time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last := statWatched(configPath)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logging.Logger.Info("SIGHUP received, reloading config", "path", configPath)
+			last = statWatched(configPath)
+			reloadConfig(s, configPath)
+			last = rewatch(last, configPath)
+		case <-tick:
+			current := statWatched(configPath)
+			if maps.Equal(current, last) {
+				continue
+			}
+			changed := configPath
+			for path, state := range current {
+				if state != last[path] {
+					changed = path
+					break
+				}
+			}
+			logging.Logger.Info("Config file changed, reloading", "path", changed)
+			reloadConfig(s, configPath)
+			last = rewatch(current, configPath)
+		}
+	}
+}
+
+// reloadConfig parses the config file and applies its tool changes to the
+// server. An invalid config is rejected and the current one is kept.
+func reloadConfig(s *server.MCPServer, configPath string) {
+	next, err := hyancieMCP.ParseConfig(configPath)
+	if err != nil {
+		logging.Logger.Error("Config reload rejected, keeping current config", "error", err)
+		return
+	}
+
+	// Listener settings cannot change without a restart and may have been
+	// overridden from the command line, so keep the running values.
+	current := hyancieMCP.CurrentConfig()
+	next.SseAddress = current.SseAddress
+	next.SseBaseUrl = current.SseBaseUrl
+	next.HttpAddress = current.HttpAddress
+	next.HttpEndpoint = current.HttpEndpoint
+
+	if err := guard.Update(next.ServerAuth); err != nil {
+		logging.Logger.Error("Config reload rejected, keeping current config", "error", err)
+		return
+	}
+	policy.Update(next.AccessControl)
+	limiter.Update(next)
+
+	// Publish the config before the tools are re-registered, so that clients
+	// listing the tools after notifications/tools/list_changed see the new one.
+	hyancieMCP.PublishConfig(next)
+	added, removed, replaced := tools.ReloadGenericTools(s, current, next)
+	if len(added)+len(removed)+len(replaced) == 0 && !reflect.DeepEqual(current.AccessControl, next.AccessControl) {
+		// The visible tools changed for some clients although the tool list did not
+		s.SendNotificationToAllClients(mcp.MethodNotificationToolsListChanged, nil)
+	}
+}
@@ -1,10 +1,22 @@
 package hyancie
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
@@ -13,18 +25,41 @@ import (
 
 // GenericToolConfig defines the structure for a single tool configuration.
 type GenericToolConfig struct {
-	ToolName      string              `json:"tool_name"`
-	Description   string              `json:"description"`
-	Request       RequestConfig       `json:"request"`
-	Headers       []Header            `json:"headers,omitempty"`
-	InputSchema   mcp.ToolInputSchema `json:"input_schema"`
-	OutputMapping []OutputMap         `json:"output_mapping"`
+	ToolName       string              `json:"tool_name"`
+	Description    string              `json:"description"`
+	Request        RequestConfig       `json:"request"`
+	Headers        []Header            `json:"headers,omitempty"`
+	InputSchema    mcp.ToolInputSchema `json:"input_schema"`
+	OutputMapping  []OutputMap         `json:"output_mapping"`
+	OutputTemplate string              `json:"output_template,omitempty"` // Go template rendering the result text instead of output_mapping
+	OutputFormat   string              `json:"output_format,omitempty"`   // "text" (default) or "json" for results built from output_mapping, returned in _meta.structuredContent (not MCP structuredContent)
+	OutputStyle    *OutputStyleConfig  `json:"output_style,omitempty"`    // Overrides the global output_style field by field
+	Retry          *RetryConfig        `json:"retry,omitempty"`           // Overrides the global retry settings field by field
+	HTTPClient     string              `json:"http_client,omitempty"`     // Name of an entry in http_clients to use instead of the default client
+	Auth           *AuthConfig         `json:"auth,omitempty"`            // Upstream authentication
+	Cache          *CacheConfig        `json:"cache,omitempty"`           // Opt-in response cache
+	Pagination     *PaginationConfig   `json:"pagination,omitempty"`      // Follows further pages of list endpoints
+	Response       *ResponseConfig     `json:"response,omitempty"`        // How the upstream response body is decoded
+	Steps          []StepConfig        `json:"steps,omitempty"`           // Chained requests, used instead of request
 }
 
 // RequestConfig defines the HTTP request details.
 type RequestConfig struct {
-	Method string `json:"method"`
-	URL    string `json:"url"`
+	Method       string          `json:"method"`
+	URL          string          `json:"url"`
+	BodyTemplate json.RawMessage `json:"body_template,omitempty"` // Go template string or JSON with {{ }} placeholders
+	Timeout      string          `json:"timeout,omitempty"`       // Per-attempt timeout, e.g. "10s"; overrides the global timeout
+	ContentType  string          `json:"content_type,omitempty"`  // application/json (default), application/x-www-form-urlencoded or multipart/form-data
+	Files        []FilePart      `json:"files,omitempty"`         // Multipart file parts, for content_type multipart/form-data
+}
+
+// FilePart maps a base64-encoded argument to a multipart file part.
+type FilePart struct {
+	Argument         string `json:"argument"`                     // Argument holding the base64 (or data URL) content
+	FieldName        string `json:"field_name,omitempty"`         // Multipart field name, defaults to the argument's wire name
+	FileName         string `json:"file_name,omitempty"`          // File name sent with the part, defaults to the field name
+	FileNameArgument string `json:"file_name_argument,omitempty"` // Argument overriding file_name
+	ContentType      string `json:"content_type,omitempty"`       // Defaults to the data URL type or application/octet-stream
 }
 
 // Header represents a single HTTP header.
@@ -36,25 +71,237 @@ type Header struct {
 // OutputMap defines how to map a key from the JSON response to a human-readable description.
 type OutputMap struct {
 	JsonKey     string      `json:"json_key"`
+	Expr        string      `json:"expr,omitempty"` // JSONPath expression used instead of json_key
+	Name        string      `json:"name,omitempty"` // Key of the value in structured results (output_format "json")
 	Description string      `json:"description"`
-	Type        string      `json:"type"` // "primitive", "array"
+	Type        string      `json:"type"` // "primitive", "array", "object"
 	Limit       int         `json:"limit,omitempty"`
 	Items       []OutputMap `json:"items,omitempty"` // For type "array"
 }
 
+// OutputStyleConfig defines how the text of output_mapping results is formatted.
+type OutputStyleConfig struct {
+	Preset             string `json:"preset,omitempty"`               // "default" or "markdown"; the other fields override it
+	Locale             string `json:"locale,omitempty"`               // Language of generated labels: "zh" (default) or "en"
+	KeySeparator       string `json:"key_separator,omitempty"`        // Between a description and its value
+	FieldSeparator     string `json:"field_separator,omitempty"`      // Between top-level fields
+	ItemSeparator      string `json:"item_separator,omitempty"`       // Between the items of an array
+	ItemFieldSeparator string `json:"item_field_separator,omitempty"` // Between the fields of an item or object
+	ItemLabel          string `json:"item_label,omitempty"`           // Label of array items, in which {n} is the item number
+	Escape             string `json:"escape,omitempty"`               // Escaping of values: "none", "separators", "markdown" or "json"
+}
+
+// ResponseConfig defines how an upstream response body is decoded into the
+// data that output_mapping reads.
+type ResponseConfig struct {
+	Format        string            `json:"format,omitempty"`         // "json", "xml", "csv", "yaml", "html" or "text"; detected from Content-Type by default
+	ArrayElements []string          `json:"array_elements,omitempty"` // For XML: elements that are always arrays, even when they occur once
+	Delimiter     string            `json:"delimiter,omitempty"`      // For CSV: field delimiter, defaults to ","
+	Columns       []string          `json:"columns,omitempty"`        // For CSV: column names of a body without header row
+	Selectors     map[string]string `json:"selectors,omitempty"`      // For HTML: name -> CSS selector of the elements to extract
+	MaxBytes      int64             `json:"max_bytes,omitempty"`      // Largest binary response or fetched image, defaults to 10 MiB
+	ImageURL      string            `json:"image_url,omitempty"`      // json_key of an image URL in the response to fetch and return as image content
+}
+
+// RetryConfig defines when and how failed upstream requests are retried.
+type RetryConfig struct {
+	MaxAttempts        int            `json:"max_attempts,omitempty"`         // Total attempts including the first one; 1 disables retries
+	Backoff            *BackoffConfig `json:"backoff,omitempty"`              // Delay between attempts
+	OnStatus           []int          `json:"on_status,omitempty"`            // Status codes to retry, defaults to 429, 502, 503 and 504
+	AllowNonIdempotent bool           `json:"allow_non_idempotent,omitempty"` // Also retry POST and PATCH requests
+}
+
+// BackoffConfig defines an exponential backoff with jitter.
+type BackoffConfig struct {
+	Initial    string  `json:"initial,omitempty"`    // First delay, e.g. "200ms"
+	Max        string  `json:"max,omitempty"`        // Upper bound of a single delay, e.g. "10s"
+	Multiplier float64 `json:"multiplier,omitempty"` // Growth factor per attempt, defaults to 2
+}
+
+// StepConfig defines one HTTP call of a multi-step tool. Its URL, headers and
+// body can reference the arguments and the values extracted by earlier steps.
+type StepConfig struct {
+	Name    string            `json:"name"`               // Identifies the step in references and output_mapping
+	Request RequestConfig     `json:"request"`            // URL and header values may contain {argument} and {step.value} placeholders
+	Headers []Header          `json:"headers,omitempty"`  // Sent after the tool's headers
+	Extract map[string]string `json:"extract,omitempty"`  // Values for later steps: name -> json_key in the response
+	When    string            `json:"when,omitempty"`     // Go template; the step is skipped if it renders "", "false" or "0"
+	OnError string            `json:"on_error,omitempty"` // "fail" (default), "continue" or "stop"
+}
+
+// CacheConfig enables an in-memory cache of successful upstream responses.
+type CacheConfig struct {
+	TTL        string   `json:"ttl,omitempty"`         // Freshness lifetime, e.g. "30s"; defaults to 1m
+	MaxEntries int      `json:"max_entries,omitempty"` // Least recently used entries are evicted beyond this, defaults to 100
+	KeyHeaders []string `json:"key_headers,omitempty"` // Request headers that are part of the cache key
+}
+
+// PaginationConfig defines how further pages of a list response are requested.
+type PaginationConfig struct {
+	Type     string `json:"type"`                // "cursor", "page", "offset" or "link"
+	JsonKey  string `json:"json_key"`            // Dot-separated key of the array whose items are concatenated
+	NextKey  string `json:"next_key,omitempty"`  // For type "cursor": key of the next cursor, token or URL
+	Param    string `json:"param,omitempty"`     // Query parameter receiving the cursor, page number or offset
+	Start    int    `json:"start,omitempty"`     // For type "page": number of the first page, defaults to 1
+	PageSize int    `json:"page_size,omitempty"` // A page with fewer items is the last one
+	MaxPages int    `json:"max_pages,omitempty"` // Defaults to 10
+	MaxItems int    `json:"max_items,omitempty"` // Stops and truncates once this many items were collected
+}
+
+// HTTPClientConfig defines the transport settings of an outbound HTTP client.
+type HTTPClientConfig struct {
+	ProxyURL            string   `json:"proxy_url,omitempty"`               // Outbound proxy; defaults to the HTTP_PROXY/HTTPS_PROXY environment variables
+	NoProxy             []string `json:"no_proxy,omitempty"`                // Hosts, domains (".example.com"), CIDR ranges or "*" that bypass proxy_url
+	CAFile              string   `json:"ca_file,omitempty"`                 // PEM bundle trusted in addition to the system roots
+	CertFile            string   `json:"cert_file,omitempty"`               // PEM client certificate for mutual TLS
+	KeyFile             string   `json:"key_file,omitempty"`                // PEM private key of cert_file
+	TLSMinVersion       string   `json:"tls_min_version,omitempty"`         // "1.0", "1.1", "1.2" (default) or "1.3"
+	InsecureSkipVerify  bool     `json:"insecure_skip_verify,omitempty"`    // Disables certificate verification, for development only
+	MaxIdleConns        int      `json:"max_idle_conns,omitempty"`          // Defaults to 100
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host,omitempty"` // Defaults to 10
+	RedirectPolicy      string   `json:"redirect_policy,omitempty"`         // "follow" (default), "same_host" or "none"
+	MaxRedirects        int      `json:"max_redirects,omitempty"`           // Defaults to 10
+}
+
+// AuthConfig defines how requests to an upstream API are authenticated.
+type AuthConfig struct {
+	Profile string `json:"profile,omitempty"` // Name of an entry in auth_profiles; the other fields are then ignored
+	Type    string `json:"type,omitempty"`    // "oauth2", "basic", "hmac" or "aws_sigv4"
+
+	// OAuth2 settings
+	GrantType    string            `json:"grant_type,omitempty"` // "client_credentials" (default) or "refresh_token"
+	TokenURL     string            `json:"token_url,omitempty"`
+	ClientID     string            `json:"client_id,omitempty"`
+	ClientSecret string            `json:"client_secret,omitempty"`
+	RefreshToken string            `json:"refresh_token,omitempty"` // For grant_type "refresh_token"
+	Scopes       []string          `json:"scopes,omitempty"`
+	ExtraParams  map[string]string `json:"extra_params,omitempty"` // Additional token request parameters, e.g. "audience"
+	ClientAuth   string            `json:"client_auth,omitempty"`  // "basic" (default, HTTP Basic header) or "body" (form fields)
+
+	// Basic settings
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// HMAC settings
+	Secret            string `json:"secret,omitempty"`
+	Algorithm         string `json:"algorithm,omitempty"`          // "sha256" (default), "sha1" or "sha512"
+	CanonicalTemplate string `json:"canonical_template,omitempty"` // Go template of the signed string, defaults to method, path, timestamp and body on separate lines
+	SignatureHeader   string `json:"signature_header,omitempty"`   // Defaults to "X-Signature"
+	SignaturePrefix   string `json:"signature_prefix,omitempty"`   // Prepended to the signature, e.g. "sha256="
+	SignatureEncoding string `json:"signature_encoding,omitempty"` // "hex" (default) or "base64"
+	TimestampHeader   string `json:"timestamp_header,omitempty"`   // Defaults to "X-Timestamp"
+	TimestampFormat   string `json:"timestamp_format,omitempty"`   // "unix" (default), "unix_ms" or "rfc3339"
+
+	// AWS SigV4 settings. Credentials default to the AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+	Region          string `json:"region,omitempty"`
+	Service         string `json:"service,omitempty"` // e.g. "execute-api" for API Gateway
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+// ServerAuthConfig defines how clients of the SSE and streamable HTTP
+// transports authenticate. Requests without valid credentials are rejected.
+type ServerAuthConfig struct {
+	APIKeyHeader string         `json:"api_key_header,omitempty"` // Defaults to "X-API-Key"; keys are also accepted as bearer tokens
+	APIKeys      []APIKeyConfig `json:"api_keys,omitempty"`
+	JWT          *JWTConfig     `json:"jwt,omitempty"`
+}
+
+// APIKeyConfig is a static API key and the client identity it grants.
+type APIKeyConfig struct {
+	Key      string   `json:"key"`
+	ClientID string   `json:"client_id"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// JWTConfig defines how bearer JWTs are validated.
+type JWTConfig struct {
+	HS256Secret  string `json:"hs256_secret,omitempty"`  // Shared secret for HS256 tokens
+	JWKSFile     string `json:"jwks_file,omitempty"`     // Local JWKS file with the RSA keys for RS256 tokens
+	Issuer       string `json:"issuer,omitempty"`        // Required "iss" claim, if set
+	Audience     string `json:"audience,omitempty"`      // Required "aud" claim entry, if set
+	SubjectClaim string `json:"subject_claim,omitempty"` // Claim holding the client identity, defaults to "sub"
+	RolesClaim   string `json:"roles_claim,omitempty"`   // Claim holding the roles (array or space-separated string), defaults to "roles"
+	Leeway       string `json:"leeway,omitempty"`        // Allowed clock skew for exp and nbf, defaults to "30s"
+	AllowNoExp   bool   `json:"allow_no_exp,omitempty"`  // Accept tokens without an "exp" claim, which never expire
+}
+
+// AccessControlConfig maps authenticated clients to the tools they may list and call.
+type AccessControlConfig struct {
+	DefaultPolicy string       `json:"default_policy,omitempty"` // "deny" (default) or "allow" for clients no rule applies to
+	Rules         []AccessRule `json:"rules"`
+}
+
+// AccessRule grants or denies tools to clients by client ID or role.
+type AccessRule struct {
+	Clients []string `json:"clients,omitempty"` // Client IDs the rule applies to
+	Roles   []string `json:"roles,omitempty"`   // Roles the rule applies to
+	Allow   []string `json:"allow,omitempty"`   // Tool names or glob patterns, e.g. "get_*"
+	Deny    []string `json:"deny,omitempty"`    // Tool names or glob patterns; deny wins over allow
+}
+
+// RateLimitsConfig defines the rate limits and concurrency caps of tool calls.
+// A call must pass every limit that applies to it.
+type RateLimitsConfig struct {
+	Tools      map[string]RateLimitConfig `json:"tools,omitempty"`       // By tool name; "*" applies to every other tool separately
+	Hosts      map[string]RateLimitConfig `json:"hosts,omitempty"`       // By upstream host name of generic tools
+	PerSession *RateLimitConfig           `json:"per_session,omitempty"` // Applies to each client session separately
+}
+
+// RateLimitConfig is a token bucket and a cap on concurrent calls.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"` // Bucket refill rate; 0 disables the rate limit
+	Burst             int     `json:"burst,omitempty"`               // Bucket size, defaults to requests_per_second rounded up
+	MaxInFlight       int     `json:"max_in_flight,omitempty"`       // Maximum concurrent calls; 0 disables the cap
+}
+
+// CORSConfig defines the CORS policy of the SSE and streamable HTTP transports.
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins,omitempty"` // Defaults to all origins ("*")
+	AllowedHeaders   []string `json:"allowed_headers,omitempty"` // Defaults to all headers
+	AllowCredentials bool     `json:"allow_credentials,omitempty"`
+	MaxAge           int      `json:"max_age,omitempty"` // Preflight cache duration in seconds
+}
+
 // LoggingConfig defines the structure for logging settings.
 type LoggingConfig struct {
 	FilePath string `json:"file_path"`
 }
 
+// HotReloadConfig defines how config.json changes are picked up at runtime.
+type HotReloadConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+	Interval int  `json:"interval_seconds,omitempty"` // Polling interval, defaults to 2 seconds
+}
+
 // ConfigType is the top-level structure for the entire config.json file.
 type ConfigType struct {
-	ServerName    string              `json:"server_name"`
-	ServerVersion string              `json:"server_version"`
-	SseAddress    string              `json:"sse_address"`
-	SseBaseUrl    string              `json:"sse_base_url"`
-	Logging       LoggingConfig       `json:"logging"`
-	McpTools      []GenericToolConfig `json:"mcp_tools"`
+	ServerName     string                      `json:"server_name"`
+	ServerVersion  string                      `json:"server_version"`
+	SseAddress     string                      `json:"sse_address"`
+	SseBaseUrl     string                      `json:"sse_base_url"`
+	HttpAddress    string                      `json:"http_address"`
+	HttpEndpoint   string                      `json:"http_endpoint_path"`
+	Logging        LoggingConfig               `json:"logging"`
+	HotReload      HotReloadConfig             `json:"hot_reload"`
+	ServerAuth     *ServerAuthConfig           `json:"server_auth,omitempty"` // Inbound authentication of the network transports
+	CORS           *CORSConfig                 `json:"cors,omitempty"`
+	AccessControl  *AccessControlConfig        `json:"access_control,omitempty"` // Per-client tool ACLs
+	RateLimits     *RateLimitsConfig           `json:"rate_limits,omitempty"`
+	Timeout        string                      `json:"timeout,omitempty"`       // Default per-attempt timeout of upstream requests, e.g. "30s"
+	Retry          *RetryConfig                `json:"retry,omitempty"`         // Default retry policy of all tools
+	HTTPClient     *HTTPClientConfig           `json:"http_client,omitempty"`   // Default outbound HTTP client
+	HTTPClients    map[string]HTTPClientConfig `json:"http_clients,omitempty"`  // Named clients selected by a tool's http_client
+	AuthProfiles   map[string]AuthConfig       `json:"auth_profiles,omitempty"` // Shared auth settings selected by a tool's auth.profile
+	OutputStyle    *OutputStyleConfig          `json:"output_style,omitempty"`  // Default text formatting of output_mapping results
+	McpTools       []GenericToolConfig         `json:"mcp_tools"`
+	OpenAPISources []OpenAPISource             `json:"openapi_sources,omitempty"`
+
+	// ReferencedFiles lists the secret files and OpenAPI documents the config
+	// was built from, so that hot reload can watch them along with the config.
+	ReferencedFiles []string `json:"-"`
 
 	// Deprecated fields, kept for compatibility with old static tools if needed.
 	WebSearchURL string `yaml:"web_search_url"`
@@ -62,34 +309,558 @@ type ConfigType struct {
 }
 
 // Config holds the single, global instance of the application's configuration.
+// Once the server is running, it is replaced as a whole by PublishConfig and
+// must be read through CurrentConfig; a published config is never modified.
 var Config = &ConfigType{}
 
+// configMu guards the Config pointer against concurrent reloads.
+var configMu sync.RWMutex
+
+// CurrentConfig returns the configuration in effect.
+func CurrentConfig() *ConfigType {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return Config
+}
+
+// PublishConfig makes next the configuration in effect. Readers that already
+// hold the previous config keep a consistent view of it.
+func PublishConfig(next *ConfigType) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	Config = next
+}
+
 // LoadConfig loads all configuration from the config.json file
 // located in the same directory as the executable.
 func LoadConfig(configPath string) error {
-	var finalPath string
+	finalPath, err := ResolveConfigPath(configPath)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := ParseConfig(finalPath)
+	if err != nil {
+		return err
+	}
+
+	PublishConfig(parsed)
+	return nil
+}
+
+// ResolveConfigPath returns the absolute path of the config file. Relative
+// paths are resolved against the directory of the executable.
+func ResolveConfigPath(configPath string) (string, error) {
 	if filepath.IsAbs(configPath) {
-		finalPath = configPath
-	} else {
-		exePath, err := os.Executable()
-		if err != nil {
-			return fmt.Errorf("failed to get executable path: %w", err)
-		}
-		exeDir := filepath.Dir(exePath)
-		finalPath = filepath.Join(exeDir, configPath)
+		return configPath, nil
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	exeDir := filepath.Dir(exePath)
+	return filepath.Join(exeDir, configPath), nil
+}
+
+// ParseConfig reads, expands and validates the config file at finalPath
+// without touching the global Config.
+func ParseConfig(finalPath string) (*ConfigType, error) {
+	configBytes, err := os.ReadFile(finalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file at %s: %w", finalPath, err)
+	}
+
+	// Decode into a generic document first so that ${...} references can be
+	// expanded in every string field before the typed decode.
+	decoder := json.NewDecoder(bytes.NewReader(configBytes))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("failed to decode config file: unexpected data after the top-level object")
 	}
 
-	configFile, err := os.Open(finalPath)
+	expanded, files, err := interpolateConfig(raw)
 	if err != nil {
-		return fmt.Errorf("failed to open config file at %s: %w", finalPath, err)
+		return nil, fmt.Errorf("failed to resolve config file %s: %w", finalPath, err)
 	}
-	defer configFile.Close()
 
-	decoder := json.NewDecoder(configFile)
-	err = decoder.Decode(Config)
+	expandedBytes, err := json.Marshal(expanded)
 	if err != nil {
-		return fmt.Errorf("failed to decode config file: %w", err)
+		return nil, fmt.Errorf("failed to encode expanded config: %w", err)
+	}
+
+	parsed := &ConfigType{}
+	err = json.Unmarshal(expandedBytes, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	}
+	parsed.ReferencedFiles = files
+
+	if err := parsed.expandOpenAPISources(filepath.Dir(finalPath)); err != nil {
+		return nil, err
+	}
+
+	if err := parsed.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", finalPath, err)
 	}
 
+	return parsed, nil
+}
+
+// Validate checks the tool definitions for mistakes that would otherwise only
+// surface when a tool is called.
+func (c *ConfigType) Validate() error {
+	var problems []string
+	problems = append(problems, validateRetry("", c.Timeout, c.Retry)...)
+	if c.ServerAuth != nil {
+		problems = append(problems, validateServerAuth(*c.ServerAuth)...)
+	}
+	if c.AccessControl != nil {
+		problems = append(problems, validateAccessControl(*c.AccessControl)...)
+		if c.ServerAuth == nil {
+			// Without authenticated clients no rule could apply.
+			problems = append(problems, "access_control requires server_auth")
+		}
+	}
+	if c.RateLimits != nil {
+		problems = append(problems, validateRateLimits(*c.RateLimits)...)
+	}
+	if c.HTTPClient != nil {
+		problems = append(problems, validateHTTPClient("http_client: ", *c.HTTPClient)...)
+	}
+	if c.OutputStyle != nil {
+		problems = append(problems, validateOutputStyle("output_style: ", *c.OutputStyle)...)
+	}
+	clientNames := make([]string, 0, len(c.HTTPClients))
+	for name := range c.HTTPClients {
+		clientNames = append(clientNames, name)
+	}
+	sort.Strings(clientNames)
+	for _, name := range clientNames {
+		problems = append(problems, validateHTTPClient(fmt.Sprintf("http_clients[%q]: ", name), c.HTTPClients[name])...)
+	}
+	profileNames := make([]string, 0, len(c.AuthProfiles))
+	for name := range c.AuthProfiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+	for _, name := range profileNames {
+		profile := c.AuthProfiles[name]
+		if profile.Profile != "" {
+			problems = append(problems, fmt.Sprintf("auth_profiles[%q]: profiles cannot reference other profiles", name))
+			continue
+		}
+		problems = append(problems, validateAuth(fmt.Sprintf("auth_profiles[%q]: ", name), profile)...)
+	}
+	seen := make(map[string]bool)
+	for i, tool := range c.McpTools {
+		if tool.ToolName == "" {
+			problems = append(problems, fmt.Sprintf("mcp_tools[%d]: tool_name is required", i))
+			continue
+		}
+		if seen[tool.ToolName] {
+			problems = append(problems, fmt.Sprintf("mcp_tools[%d]: duplicate tool_name %q", i, tool.ToolName))
+		}
+		seen[tool.ToolName] = true
+		if len(tool.Steps) > 0 {
+			problems = append(problems, validateSteps(fmt.Sprintf("tool %q: ", tool.ToolName), tool)...)
+		} else if tool.Request.URL == "" {
+			problems = append(problems, fmt.Sprintf("tool %q: request.url is required", tool.ToolName))
+		}
+		problems = append(problems, validateRetry(fmt.Sprintf("tool %q: ", tool.ToolName), tool.Request.Timeout, tool.Retry)...)
+		problems = append(problems, validateBodyTemplate(fmt.Sprintf("tool %q: ", tool.ToolName), tool.Request)...)
+		if tool.Cache != nil {
+			problems = append(problems, validateCache(fmt.Sprintf("tool %q: ", tool.ToolName), tool.Request.Method, *tool.Cache)...)
+		}
+		if tool.Pagination != nil {
+			problems = append(problems, validatePagination(fmt.Sprintf("tool %q: ", tool.ToolName), *tool.Pagination)...)
+		}
+		if tool.Response != nil {
+			problems = append(problems, validateResponse(fmt.Sprintf("tool %q: response.", tool.ToolName), *tool.Response)...)
+		}
+		if tool.OutputStyle != nil {
+			problems = append(problems, validateOutputStyle(fmt.Sprintf("tool %q: output_style: ", tool.ToolName), *tool.OutputStyle)...)
+		}
+		switch tool.OutputFormat {
+		case "", "text":
+		case "json":
+			problems = append(problems, validateOutputNames(fmt.Sprintf("tool %q: output_mapping", tool.ToolName), tool.OutputMapping)...)
+		default:
+			problems = append(problems, fmt.Sprintf("tool %q: output_format must be text or json, got %q", tool.ToolName, tool.OutputFormat))
+		}
+		if _, ok := c.HTTPClients[tool.HTTPClient]; tool.HTTPClient != "" && !ok {
+			problems = append(problems, fmt.Sprintf("tool %q: unknown http_client %q", tool.ToolName, tool.HTTPClient))
+		}
+		if tool.Auth != nil {
+			if tool.Auth.Profile != "" {
+				if _, ok := c.AuthProfiles[tool.Auth.Profile]; !ok {
+					problems = append(problems, fmt.Sprintf("tool %q: unknown auth profile %q", tool.ToolName, tool.Auth.Profile))
+				}
+			} else {
+				problems = append(problems, validateAuth(fmt.Sprintf("tool %q: auth: ", tool.ToolName), *tool.Auth)...)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateRetry checks the duration strings of a timeout and retry policy.
+func validateRetry(prefix, timeout string, retry *RetryConfig) []string {
+	durations := map[string]string{"timeout": timeout}
+	if retry != nil && retry.Backoff != nil {
+		durations["retry.backoff.initial"] = retry.Backoff.Initial
+		durations["retry.backoff.max"] = retry.Backoff.Max
+	}
+	var problems []string
+	for _, field := range []string{"timeout", "retry.backoff.initial", "retry.backoff.max"} {
+		value := durations[field]
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("%s%s: invalid duration %q", prefix, field, value))
+		}
+	}
+	return problems
+}
+
+// validateSteps checks that the steps of a multi-step tool have unique names
+// that do not shadow arguments, a URL and a supported on_error value, and
+// that the tool sets none of the response settings steps do not support.
+func validateSteps(prefix string, tool GenericToolConfig) []string {
+	var problems []string
+	// Step responses are decoded one by one, never cached, paged or
+	// returned as images.
+	if tool.Cache != nil {
+		problems = append(problems, prefix+"cache cannot be combined with steps")
+	}
+	if tool.Pagination != nil {
+		problems = append(problems, prefix+"pagination cannot be combined with steps")
+	}
+	if tool.Response != nil && tool.Response.ImageURL != "" {
+		problems = append(problems, prefix+"response.image_url cannot be combined with steps")
+	}
+	seen := make(map[string]bool)
+	for i, step := range tool.Steps {
+		if step.Name == "" {
+			problems = append(problems, fmt.Sprintf("%ssteps[%d]: name is required", prefix, i))
+			continue
+		}
+		stepPrefix := fmt.Sprintf("%sstep %q: ", prefix, step.Name)
+		if seen[step.Name] {
+			problems = append(problems, stepPrefix+"duplicate name")
+		}
+		seen[step.Name] = true
+		if _, ok := tool.InputSchema.Properties[step.Name]; ok {
+			problems = append(problems, stepPrefix+"name conflicts with an argument")
+		}
+		if step.Request.URL == "" {
+			problems = append(problems, stepPrefix+"request.url is required")
+		}
+		switch step.OnError {
+		case "", "fail", "continue", "stop":
+		default:
+			problems = append(problems, fmt.Sprintf("%sunsupported on_error %q", stepPrefix, step.OnError))
+		}
+		problems = append(problems, validateRetry(stepPrefix, step.Request.Timeout, nil)...)
+		problems = append(problems, validateBodyTemplate(stepPrefix, step.Request)...)
+	}
+	return problems
+}
+
+// validateBodyTemplate checks that a body_template can be sent with the
+// request's content_type: JSON templates render JSON, and multipart bodies
+// need the boundary that only the built-in encoder writes.
+func validateBodyTemplate(prefix string, request RequestConfig) []string {
+	template := bytes.TrimSpace(request.BodyTemplate)
+	if len(template) == 0 || string(template) == "null" || request.ContentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(request.ContentType)
+	if err != nil {
+		// Reported when the tool is built
+		return nil
+	}
+	switch {
+	case mediaType == "multipart/form-data":
+		return []string{prefix + "request.body_template cannot be combined with content_type multipart/form-data"}
+	case mediaType == "application/x-www-form-urlencoded" && template[0] != '"':
+		return []string{prefix + "request.body_template renders JSON and cannot be sent as application/x-www-form-urlencoded, use a string template"}
+	}
 	return nil
 }
+
+// validateOutputStyle checks the enumerated fields of an output style.
+func validateOutputStyle(prefix string, style OutputStyleConfig) []string {
+	var problems []string
+	for _, field := range []struct {
+		name, value string
+		allowed     []string
+	}{
+		{"preset", style.Preset, []string{"default", "markdown"}},
+		{"locale", style.Locale, []string{"zh", "en"}},
+		{"escape", style.Escape, []string{"none", "separators", "markdown", "json"}},
+	} {
+		if field.value != "" && !slices.Contains(field.allowed, field.value) {
+			problems = append(problems, fmt.Sprintf("%s%s must be one of %s, got %q", prefix, field.name, strings.Join(field.allowed, ", "), field.value))
+		}
+	}
+	return problems
+}
+
+// validateResponse checks the format and the format-specific settings of a response decoder.
+func validateResponse(prefix string, response ResponseConfig) []string {
+	var problems []string
+	formats := []string{"json", "xml", "csv", "yaml", "html", "text"}
+	if response.Format != "" && !slices.Contains(formats, response.Format) {
+		problems = append(problems, fmt.Sprintf("%sformat must be one of %s, got %q", prefix, strings.Join(formats, ", "), response.Format))
+	}
+	if response.Delimiter != "" && utf8.RuneCountInString(response.Delimiter) != 1 {
+		problems = append(problems, fmt.Sprintf("%sdelimiter must be a single character, got %q", prefix, response.Delimiter))
+	}
+	if response.MaxBytes < 0 {
+		problems = append(problems, prefix+"max_bytes must not be negative")
+	}
+	for name := range response.Selectors {
+		if name == "title" || name == "text" {
+			problems = append(problems, fmt.Sprintf("%sselectors: name %q is reserved", prefix, name))
+		}
+	}
+	return problems
+}
+
+// validateOutputNames checks that the mappings of a structured result, and
+// those of their items, have distinct names.
+func validateOutputNames(prefix string, mappings []OutputMap) []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, mapping := range mappings {
+		mappingPrefix := fmt.Sprintf("%s[%d]", prefix, i)
+		switch {
+		case mapping.Name == "":
+			problems = append(problems, mappingPrefix+": name is required for output_format json")
+		case seen[mapping.Name]:
+			problems = append(problems, fmt.Sprintf("%s: duplicate name %q", mappingPrefix, mapping.Name))
+		}
+		seen[mapping.Name] = true
+		problems = append(problems, validateOutputNames(mappingPrefix+".items", mapping.Items)...)
+	}
+	return problems
+}
+
+// validateCache checks the TTL and size of a response cache. Only GET and
+// HEAD requests are cached, as other methods may have side effects.
+func validateCache(prefix, method string, cache CacheConfig) []string {
+	var problems []string
+	switch strings.ToUpper(method) {
+	case "", "GET", "HEAD":
+	default:
+		problems = append(problems, fmt.Sprintf("%scache requires request.method GET or HEAD, got %q", prefix, method))
+	}
+	if cache.TTL != "" {
+		if d, err := time.ParseDuration(cache.TTL); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("%scache.ttl: invalid duration %q", prefix, cache.TTL))
+		}
+	}
+	if cache.MaxEntries < 0 {
+		problems = append(problems, prefix+"cache.max_entries must not be negative")
+	}
+	return problems
+}
+
+// validatePagination checks the type and the keys a pagination style needs.
+func validatePagination(prefix string, pagination PaginationConfig) []string {
+	var problems []string
+	switch pagination.Type {
+	case "cursor":
+		if pagination.NextKey == "" {
+			problems = append(problems, prefix+"pagination.next_key is required for type \"cursor\"")
+		}
+	case "page", "offset", "link":
+	case "":
+		problems = append(problems, prefix+"pagination.type is required")
+	default:
+		problems = append(problems, fmt.Sprintf("%sunsupported pagination.type %q", prefix, pagination.Type))
+	}
+	if pagination.JsonKey == "" {
+		problems = append(problems, prefix+"pagination.json_key is required")
+	} else if strings.Contains(pagination.JsonKey, "[") {
+		problems = append(problems, fmt.Sprintf("%spagination.json_key %q must be a dot-separated key without indexes", prefix, pagination.JsonKey))
+	}
+	if pagination.PageSize < 0 || pagination.MaxPages < 0 || pagination.MaxItems < 0 {
+		problems = append(problems, prefix+"pagination limits must not be negative")
+	}
+	return problems
+}
+
+// validateHTTPClient checks the enumerated and URL fields of an HTTP client config.
+func validateHTTPClient(prefix string, client HTTPClientConfig) []string {
+	var problems []string
+	if client.ProxyURL != "" {
+		if u, err := url.Parse(client.ProxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%sinvalid proxy_url %q", prefix, client.ProxyURL))
+		}
+	}
+	switch client.TLSMinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		problems = append(problems, fmt.Sprintf("%sunsupported tls_min_version %q", prefix, client.TLSMinVersion))
+	}
+	switch client.RedirectPolicy {
+	case "", "follow", "same_host", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("%sunsupported redirect_policy %q", prefix, client.RedirectPolicy))
+	}
+	if (client.CertFile == "") != (client.KeyFile == "") {
+		problems = append(problems, fmt.Sprintf("%scert_file and key_file must be set together", prefix))
+	}
+	return problems
+}
+
+// validateAuth checks that an auth config has the fields its type requires.
+func validateAuth(prefix string, auth AuthConfig) []string {
+	var problems []string
+	switch auth.Type {
+	case "oauth2":
+		if auth.TokenURL == "" {
+			problems = append(problems, prefix+"token_url is required")
+		}
+		switch auth.GrantType {
+		case "", "client_credentials":
+			if auth.ClientID == "" {
+				problems = append(problems, prefix+"client_id is required")
+			}
+		case "refresh_token":
+			if auth.RefreshToken == "" {
+				problems = append(problems, prefix+"refresh_token is required")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%sunsupported grant_type %q", prefix, auth.GrantType))
+		}
+		switch auth.ClientAuth {
+		case "", "basic", "body":
+		default:
+			problems = append(problems, fmt.Sprintf("%sunsupported client_auth %q", prefix, auth.ClientAuth))
+		}
+	case "basic":
+		if auth.Username == "" {
+			problems = append(problems, prefix+"username is required")
+		}
+	case "hmac":
+		if auth.Secret == "" {
+			problems = append(problems, prefix+"secret is required")
+		}
+		switch auth.Algorithm {
+		case "", "sha1", "sha256", "sha512":
+		default:
+			problems = append(problems, fmt.Sprintf("%sunsupported algorithm %q", prefix, auth.Algorithm))
+		}
+		switch auth.SignatureEncoding {
+		case "", "hex", "base64":
+		default:
+			problems = append(problems, fmt.Sprintf("%sunsupported signature_encoding %q", prefix, auth.SignatureEncoding))
+		}
+		switch auth.TimestampFormat {
+		case "", "unix", "unix_ms", "rfc3339":
+		default:
+			problems = append(problems, fmt.Sprintf("%sunsupported timestamp_format %q", prefix, auth.TimestampFormat))
+		}
+	case "aws_sigv4":
+		if auth.Region == "" {
+			problems = append(problems, prefix+"region is required")
+		}
+		if auth.Service == "" {
+			problems = append(problems, prefix+"service is required")
+		}
+	case "":
+		problems = append(problems, prefix+"type is required")
+	default:
+		problems = append(problems, fmt.Sprintf("%sunsupported type %q", prefix, auth.Type))
+	}
+	return problems
+}
+
+// validateServerAuth checks the API keys and JWT settings of server_auth.
+func validateServerAuth(auth ServerAuthConfig) []string {
+	var problems []string
+	keys := make(map[string]bool)
+	for i, key := range auth.APIKeys {
+		if key.Key == "" {
+			problems = append(problems, fmt.Sprintf("server_auth.api_keys[%d]: key is required", i))
+		} else if keys[key.Key] {
+			problems = append(problems, fmt.Sprintf("server_auth.api_keys[%d]: duplicate key", i))
+		}
+		keys[key.Key] = true
+		if key.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("server_auth.api_keys[%d]: client_id is required", i))
+		}
+	}
+	if auth.JWT != nil {
+		if auth.JWT.HS256Secret == "" && auth.JWT.JWKSFile == "" {
+			problems = append(problems, "server_auth.jwt: hs256_secret or jwks_file is required")
+		}
+		if auth.JWT.Leeway != "" {
+			if d, err := time.ParseDuration(auth.JWT.Leeway); err != nil || d < 0 {
+				problems = append(problems, fmt.Sprintf("server_auth.jwt.leeway: invalid duration %q", auth.JWT.Leeway))
+			}
+		}
+	}
+	if len(auth.APIKeys) == 0 && auth.JWT == nil {
+		problems = append(problems, "server_auth: api_keys or jwt is required")
+	}
+	return problems
+}
+
+// validateAccessControl checks the policy and the tool patterns of access_control.
+func validateAccessControl(acl AccessControlConfig) []string {
+	var problems []string
+	switch acl.DefaultPolicy {
+	case "", "deny", "allow":
+	default:
+		problems = append(problems, fmt.Sprintf("access_control: unsupported default_policy %q", acl.DefaultPolicy))
+	}
+	for i, rule := range acl.Rules {
+		if len(rule.Clients) == 0 && len(rule.Roles) == 0 {
+			problems = append(problems, fmt.Sprintf("access_control.rules[%d]: clients or roles is required", i))
+		}
+		for _, pattern := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("access_control.rules[%d]: invalid pattern %q", i, pattern))
+			}
+		}
+	}
+	return problems
+}
+
+// validateRateLimits rejects negative limits.
+func validateRateLimits(limits RateLimitsConfig) []string {
+	var problems []string
+	check := func(name string, limit RateLimitConfig) {
+		if limit.RequestsPerSecond < 0 || limit.Burst < 0 || limit.MaxInFlight < 0 {
+			problems = append(problems, fmt.Sprintf("rate_limits.%s: limits must not be negative", name))
+		}
+	}
+	for _, group := range []struct {
+		name   string
+		limits map[string]RateLimitConfig
+	}{{"tools", limits.Tools}, {"hosts", limits.Hosts}} {
+		keys := make([]string, 0, len(group.limits))
+		for key := range group.limits {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			check(fmt.Sprintf("%s[%q]", group.name, key), group.limits[key])
+		}
+	}
+	if limits.PerSession != nil {
+		check("per_session", *limits.PerSession)
+	}
+	return problems
+}
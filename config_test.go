@@ -0,0 +1,299 @@
+package hyancie
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "api_key")
+	require.NoError(t, os.WriteFile(secretPath, []byte("file-secret\n"), 0o600))
+
+	t.Setenv("HYANCIE_TEST_HOST", "api.example.com")
+	t.Setenv("HYANCIE_TEST_TOKEN", "env-token")
+
+	path := writeConfig(t, `{
+		"server_name": "test",
+		"sse_base_url": "${HYANCIE_TEST_BASE_URL:-http://localhost:8001}",
+		"mcp_tools": [{
+			"tool_name": "get_weather",
+			"request": {"method": "GET", "url": "https://${HYANCIE_TEST_HOST}/weather?city={city}"},
+			"headers": [
+				{"name": "Authorization", "value": "Bearer ${HYANCIE_TEST_TOKEN}"},
+				{"name": "X-Api-Key", "value": "${file:`+secretPath+`}"},
+				{"name": "X-Literal", "value": "$${NOT_EXPANDED}"}
+			],
+			"input_schema": {"type": "object", "properties": {"city": {"type": "string", "default": "Shanghai"}}}
+		}]
+	}`)
+
+	Config = &ConfigType{}
+	require.NoError(t, LoadConfig(path))
+
+	assert.Equal(t, "http://localhost:8001", Config.SseBaseUrl)
+	require.Len(t, Config.McpTools, 1)
+	tool := Config.McpTools[0]
+	assert.Equal(t, "https://api.example.com/weather?city={city}", tool.Request.URL)
+	assert.Equal(t, "Bearer env-token", tool.Headers[0].Value)
+	assert.Equal(t, "file-secret", tool.Headers[1].Value)
+	assert.Equal(t, "${NOT_EXPANDED}", tool.Headers[2].Value)
+	assert.Equal(t, []string{secretPath}, Config.ReferencedFiles)
+}
+
+func TestLoadSampleConfig(t *testing.T) {
+	path, err := filepath.Abs("config.sample.json")
+	require.NoError(t, err)
+
+	// The sample loads without any environment variables or secret files.
+	Config = &ConfigType{}
+	require.NoError(t, LoadConfig(path))
+	assert.NotEmpty(t, Config.McpTools)
+}
+
+func TestLoadConfigFileReferenceDefault(t *testing.T) {
+	path := writeConfig(t, `{
+		"server_name": "test",
+		"mcp_tools": [{
+			"tool_name": "search",
+			"request": {"method": "GET", "url": "https://api.example.com/search"},
+			"headers": [{"name": "X-Api-Key", "value": "${file:/nonexistent/secret:-fallback}"}]
+		}]
+	}`)
+
+	Config = &ConfigType{}
+	require.NoError(t, LoadConfig(path))
+	assert.Equal(t, "fallback", Config.McpTools[0].Headers[0].Value)
+	// A missing file is watched too, so that creating it triggers a reload.
+	assert.Equal(t, []string{"/nonexistent/secret"}, Config.ReferencedFiles)
+}
+
+func TestLoadConfigUnresolvedReferences(t *testing.T) {
+	path := writeConfig(t, `{
+		"server_name": "${HYANCIE_TEST_MISSING_A}",
+		"sse_base_url": "${HYANCIE_TEST_MISSING_B}",
+		"mcp_tools": [{"headers": [{"name": "X-Api-Key", "value": "${file:/nonexistent/secret}"}]}]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "${HYANCIE_TEST_MISSING_A}")
+	assert.Contains(t, err.Error(), "${HYANCIE_TEST_MISSING_B}")
+	assert.Contains(t, err.Error(), "${file:/nonexistent/secret}")
+}
+
+func TestLoadConfigInvalidDurations(t *testing.T) {
+	path := writeConfig(t, `{
+		"timeout": "soon",
+		"mcp_tools": [{
+			"tool_name": "slow",
+			"request": {"method": "GET", "url": "http://example.com", "timeout": "10s"},
+			"retry": {"max_attempts": 3, "backoff": {"initial": "fast"}},
+			"cache": {"ttl": "often"}
+		}]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `timeout: invalid duration "soon"`)
+	assert.Contains(t, err.Error(), `tool "slow": retry.backoff.initial: invalid duration "fast"`)
+	assert.Contains(t, err.Error(), `tool "slow": cache.ttl: invalid duration "often"`)
+}
+
+func TestLoadConfigCacheMethod(t *testing.T) {
+	path := writeConfig(t, `{
+		"mcp_tools": [
+			{"tool_name": "create_order", "request": {"method": "POST", "url": "http://example.com/orders"}, "cache": {"ttl": "1m"}},
+			{"tool_name": "get_order", "request": {"method": "get", "url": "http://example.com/orders/1"}, "cache": {"ttl": "1m"}}
+		]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `tool "create_order": cache requires request.method GET or HEAD, got "POST"`)
+	assert.NotContains(t, err.Error(), `tool "get_order"`)
+}
+
+func TestLoadConfigInvalidAuth(t *testing.T) {
+	path := writeConfig(t, `{
+		"auth_profiles": {"crm": {"type": "oauth2", "client_id": "id"}},
+		"mcp_tools": [
+			{"tool_name": "a", "request": {"url": "http://example.com"}, "auth": {"profile": "missing"}},
+			{"tool_name": "b", "request": {"url": "http://example.com"}, "auth": {"type": "kerberos"}}
+		]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `auth_profiles["crm"]: token_url is required`)
+	assert.Contains(t, err.Error(), `tool "a": unknown auth profile "missing"`)
+	assert.Contains(t, err.Error(), `tool "b": auth: unsupported type "kerberos"`)
+}
+
+func TestLoadConfigInvalidPagination(t *testing.T) {
+	path := writeConfig(t, `{
+		"mcp_tools": [
+			{"tool_name": "a", "request": {"url": "http://example.com"}, "pagination": {"type": "cursor", "json_key": "items[0]"}},
+			{"tool_name": "b", "request": {"url": "http://example.com"}, "pagination": {"type": "scroll", "json_key": "items"}}
+		]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `tool "a": pagination.next_key is required for type "cursor"`)
+	assert.Contains(t, err.Error(), `tool "a": pagination.json_key "items[0]" must be a dot-separated key without indexes`)
+	assert.Contains(t, err.Error(), `tool "b": unsupported pagination.type "scroll"`)
+}
+
+func TestLoadConfigInvalidSteps(t *testing.T) {
+	path := writeConfig(t, `{
+		"mcp_tools": [{
+			"tool_name": "order_details",
+			"input_schema": {"type": "object", "properties": {"lookup": {"type": "string"}}},
+			"steps": [
+				{"name": "lookup", "request": {"url": "http://example.com/orders"}},
+				{"name": "details", "request": {}, "on_error": "retry"},
+				{"name": "details", "request": {"url": "http://example.com/details", "timeout": "later"}}
+			],
+			"cache": {"ttl": "1m"},
+			"pagination": {"type": "page", "json_key": "items"},
+			"response": {"image_url": "photo"}
+		}]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), `tool "order_details": request.url is required`)
+	assert.Contains(t, err.Error(), `tool "order_details": step "lookup": name conflicts with an argument`)
+	assert.Contains(t, err.Error(), `tool "order_details": step "details": request.url is required`)
+	assert.Contains(t, err.Error(), `tool "order_details": step "details": unsupported on_error "retry"`)
+	assert.Contains(t, err.Error(), `tool "order_details": step "details": duplicate name`)
+	assert.Contains(t, err.Error(), `tool "order_details": step "details": timeout: invalid duration "later"`)
+	assert.Contains(t, err.Error(), `tool "order_details": cache cannot be combined with steps`)
+	assert.Contains(t, err.Error(), `tool "order_details": pagination cannot be combined with steps`)
+	assert.Contains(t, err.Error(), `tool "order_details": response.image_url cannot be combined with steps`)
+}
+
+func TestLoadConfigInvalidOutputFormat(t *testing.T) {
+	path := writeConfig(t, `{
+		"mcp_tools": [
+			{
+				"tool_name": "forecast",
+				"request": {"url": "http://example.com/forecast"},
+				"output_format": "json",
+				"output_mapping": [
+					{"json_key": "city", "name": "city", "type": "primitive"},
+					{"json_key": "days", "name": "city", "type": "array", "items": [{"json_key": "high", "type": "primitive"}]}
+				]
+			},
+			{"tool_name": "alerts", "request": {"url": "http://example.com/alerts"}, "output_format": "xml"}
+		]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `tool "forecast": output_mapping[1]: duplicate name "city"`)
+	assert.Contains(t, err.Error(), `tool "forecast": output_mapping[1].items[0]: name is required for output_format json`)
+	assert.Contains(t, err.Error(), `tool "alerts": output_format must be text or json, got "xml"`)
+}
+
+func TestLoadConfigInvalidOutputStyle(t *testing.T) {
+	path := writeConfig(t, `{
+		"output_style": {"preset": "html", "locale": "en"},
+		"mcp_tools": [{"tool_name": "forecast", "request": {"url": "http://example.com/forecast"}, "output_style": {"locale": "fr", "escape": "html"}}]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `output_style: preset must be one of default, markdown, got "html"`)
+	assert.Contains(t, err.Error(), `tool "forecast": output_style: locale must be one of zh, en, got "fr"`)
+	assert.Contains(t, err.Error(), `tool "forecast": output_style: escape must be one of none, separators, markdown, json, got "html"`)
+}
+
+func TestLoadConfigInvalidResponse(t *testing.T) {
+	path := writeConfig(t, `{
+		"mcp_tools": [{"tool_name": "page", "request": {"url": "http://example.com/page"}, "response": {"format": "pdf", "delimiter": "||", "selectors": {"title": "h1"}, "max_bytes": -1}}]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `tool "page": response.format must be one of json, xml, csv, yaml, html, text, got "pdf"`)
+	assert.Contains(t, err.Error(), `tool "page": response.delimiter must be a single character, got "||"`)
+	assert.Contains(t, err.Error(), `tool "page": response.selectors: name "title" is reserved`)
+	assert.Contains(t, err.Error(), `tool "page": response.max_bytes must not be negative`)
+}
+
+func TestLoadConfigInvalidBodyTemplate(t *testing.T) {
+	path := writeConfig(t, `{
+		"mcp_tools": [
+			{"tool_name": "signup", "request": {"method": "POST", "url": "http://example.com/signup", "content_type": "application/x-www-form-urlencoded", "body_template": {"name": "{{ .name }}"}}},
+			{"tool_name": "login", "request": {"method": "POST", "url": "http://example.com/login", "content_type": "application/x-www-form-urlencoded", "body_template": "user={{ .user }}"}},
+			{"tool_name": "upload", "steps": [{"name": "send", "request": {"method": "POST", "url": "http://example.com/upload", "content_type": "multipart/form-data", "body_template": "{{ .file }}"}}]}
+		]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `tool "signup": request.body_template renders JSON and cannot be sent as application/x-www-form-urlencoded, use a string template`)
+	assert.NotContains(t, err.Error(), `tool "login"`)
+	assert.Contains(t, err.Error(), `tool "upload": step "send": request.body_template cannot be combined with content_type multipart/form-data`)
+}
+
+func TestLoadConfigAccessControlWithoutServerAuth(t *testing.T) {
+	path := writeConfig(t, `{
+		"access_control": {"rules": [{"roles": ["support"], "allow": ["get_*"]}]},
+		"mcp_tools": [{"tool_name": "get_weather", "request": {"url": "http://example.com/weather"}}]
+	}`)
+
+	Config = &ConfigType{}
+	err := LoadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "access_control requires server_auth")
+}
+
+func TestPublishConfig(t *testing.T) {
+	previous := CurrentConfig()
+	defer PublishConfig(previous)
+
+	// Readers running during a reload see either config, never a mix of both.
+	first := &ConfigType{ServerName: "first", McpTools: []GenericToolConfig{{ToolName: "a"}}}
+	second := &ConfigType{ServerName: "second", McpTools: []GenericToolConfig{{ToolName: "b"}}}
+	PublishConfig(first)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			current := CurrentConfig()
+			assert.Equal(t, current.ServerName == "first", current.McpTools[0].ToolName == "a")
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			PublishConfig(second)
+		} else {
+			PublishConfig(first)
+		}
+	}
+	<-done
+	assert.Same(t, first, CurrentConfig())
+}
@@ -0,0 +1,123 @@
+package hyancie
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// interpolation collects what expanding the references of a config found.
+type interpolation struct {
+	unresolved []string // References without a value
+	files      []string // Paths of ${file:...} references, whether they exist or not
+}
+
+// interpolateConfig walks a decoded JSON document and expands ${...} references
+// in every string value. It returns the paths of the referenced files, or an
+// error listing all references that could not be resolved.
+func interpolateConfig(data interface{}) (interface{}, []string, error) {
+	var in interpolation
+	result := interpolateValue(data, &in)
+	if len(in.unresolved) > 0 {
+		sort.Strings(in.unresolved)
+		return nil, nil, fmt.Errorf("unresolved config references: %s", strings.Join(dedupe(in.unresolved), ", "))
+	}
+	sort.Strings(in.files)
+	return result, dedupe(in.files), nil
+}
+
+// interpolateValue recursively expands references in maps, arrays and strings.
+func interpolateValue(value interface{}, in *interpolation) interface{} {
+	switch v := value.(type) {
+	case string:
+		return expandReferences(v, in)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = interpolateValue(item, in)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = interpolateValue(item, in)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// expandReferences expands the references found in a single string.
+//
+// Supported forms are ${ENV_VAR}, ${ENV_VAR:-default}, ${file:/path/to/secret}
+// and ${file:/path/to/secret:-default}.
+// A literal "${" can be written as "$${".
+func expandReferences(s string, in *interpolation) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			sb.WriteString(s)
+			break
+		}
+		if start > 0 && s[start-1] == '$' {
+			// Escaped reference, keep "${" literally.
+			sb.WriteString(s[:start-1])
+			sb.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			sb.WriteString(s)
+			break
+		}
+		end += start
+
+		sb.WriteString(s[:start])
+		ref := s[start+2 : end]
+		value, ok := resolveReference(ref, &in.files)
+		if !ok {
+			in.unresolved = append(in.unresolved, "${"+ref+"}")
+		}
+		sb.WriteString(value)
+		s = s[end+1:]
+	}
+	return sb.String()
+}
+
+// resolveReference resolves the content of a single ${...} reference. The
+// path of a file reference is added to files.
+func resolveReference(ref string, files *[]string) (string, bool) {
+	if path, isFile := strings.CutPrefix(ref, "file:"); isFile {
+		path, defaultValue, hasDefault := strings.Cut(path, ":-")
+		*files = append(*files, path)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return defaultValue, hasDefault
+		}
+		return strings.TrimRight(string(content), "\r\n"), true
+	}
+
+	name, defaultValue, hasDefault := strings.Cut(ref, ":-")
+	value, ok := os.LookupEnv(name)
+	if hasDefault && value == "" {
+		return defaultValue, true
+	}
+	return value, ok
+}
+
+// dedupe removes adjacent duplicates from a sorted slice.
+func dedupe(values []string) []string {
+	var out []string
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,486 @@
+package hyancie
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPISource defines an OpenAPI 3 or Swagger 2 document whose operations
+// are turned into generic tools when the config is loaded.
+type OpenAPISource struct {
+	Path       string   `json:"path"`                  // Relative paths are resolved against the config file directory
+	BaseURL    string   `json:"base_url,omitempty"`    // Overrides the servers/host declared in the document
+	ToolPrefix string   `json:"tool_prefix,omitempty"` // Prepended to every generated tool_name
+	Operations []string `json:"operations,omitempty"`  // Only import these operationIds when set
+	Headers    []Header `json:"headers,omitempty"`     // Added to every generated tool
+}
+
+// ImportOptions controls how an OpenAPI document is converted into tools.
+type ImportOptions struct {
+	BaseURL    string
+	ToolPrefix string
+	Operations []string
+	Headers    []Header
+}
+
+// maxRefDepth bounds $ref inlining so recursive schemas terminate.
+const maxRefDepth = 8
+
+// openAPIMethods lists the operations looked up on each path item, in output order.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// schemaKeywords are the JSON Schema keywords copied from Swagger 2 non-body parameters.
+var schemaKeywords = []string{
+	"type", "format", "items", "enum", "default", "pattern",
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+	"minLength", "maxLength", "minItems", "maxItems", "uniqueItems",
+}
+
+var toolNameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ImportOpenAPIFile reads an OpenAPI 3 or Swagger 2 document (JSON or YAML)
+// and converts every operation into a GenericToolConfig.
+func ImportOpenAPIFile(path string, opts ImportOptions) ([]GenericToolConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document %s: %w", path, err)
+	}
+	tools, err := ImportOpenAPI(content, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import OpenAPI document %s: %w", path, err)
+	}
+	return tools, nil
+}
+
+// ImportOpenAPI converts the operations of an OpenAPI 3 or Swagger 2 document into tools.
+func ImportOpenAPI(content []byte, opts ImportOptions) ([]GenericToolConfig, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	doc, ok := normalizeYAML(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("document root must be an object")
+	}
+
+	imp := &openAPIImporter{doc: doc, swagger2: doc["swagger"] != nil}
+	if !imp.swagger2 && doc["openapi"] == nil {
+		return nil, fmt.Errorf("document is neither OpenAPI 3 nor Swagger 2")
+	}
+
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = imp.baseURL()
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	wanted := make(map[string]bool, len(opts.Operations))
+	for _, op := range opts.Operations {
+		wanted[op] = true
+	}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	pathNames := make([]string, 0, len(paths))
+	for p := range paths {
+		pathNames = append(pathNames, p)
+	}
+	sort.Strings(pathNames)
+
+	var tools []GenericToolConfig
+	for _, p := range pathNames {
+		pathItem, _ := imp.resolve(paths[p], 0).(map[string]interface{})
+		if pathItem == nil {
+			continue
+		}
+		for _, method := range openAPIMethods {
+			operation, ok := pathItem[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tool := imp.convertOperation(baseURL, p, method, pathItem, operation)
+			if len(wanted) > 0 && !wanted[tool.ToolName] {
+				continue
+			}
+			tool.ToolName = opts.ToolPrefix + tool.ToolName
+			tool.Headers = append(tool.Headers, opts.Headers...)
+			tools = append(tools, tool)
+		}
+	}
+	return tools, nil
+}
+
+// openAPIImporter holds the parsed document while operations are converted.
+type openAPIImporter struct {
+	doc      map[string]interface{}
+	swagger2 bool
+}
+
+// baseURL derives the API base URL from servers (OpenAPI 3) or host/basePath (Swagger 2).
+func (imp *openAPIImporter) baseURL() string {
+	if imp.swagger2 {
+		host, _ := imp.doc["host"].(string)
+		basePath, _ := imp.doc["basePath"].(string)
+		scheme := "https"
+		if schemes, ok := imp.doc["schemes"].([]interface{}); ok && len(schemes) > 0 {
+			if s, ok := schemes[0].(string); ok {
+				scheme = s
+			}
+		}
+		if host == "" {
+			return basePath
+		}
+		return scheme + "://" + host + basePath
+	}
+
+	servers, _ := imp.doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		return ""
+	}
+	server, _ := servers[0].(map[string]interface{})
+	serverURL, _ := server["url"].(string)
+	// Substitute server variables with their defaults.
+	if variables, ok := server["variables"].(map[string]interface{}); ok {
+		for name, v := range variables {
+			if variable, ok := v.(map[string]interface{}); ok {
+				serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", fmt.Sprintf("%v", variable["default"]))
+			}
+		}
+	}
+	return serverURL
+}
+
+// convertOperation builds a single tool from an operation.
+func (imp *openAPIImporter) convertOperation(baseURL, path, method string, pathItem, operation map[string]interface{}) GenericToolConfig {
+	name, _ := operation["operationId"].(string)
+	if name == "" {
+		name = method + "_" + path
+	}
+	name = strings.Trim(toolNameSanitizer.ReplaceAllString(name, "_"), "_")
+
+	description, _ := operation["summary"].(string)
+	if description == "" {
+		description, _ = operation["description"].(string)
+	}
+
+	schema := mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}}
+
+	// Path-level parameters apply to every operation unless overridden.
+	params := make(map[string]map[string]interface{})
+	var order []string
+	for _, list := range []interface{}{pathItem["parameters"], operation["parameters"]} {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			param, ok := imp.resolve(item, 0).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("%v:%v", param["in"], param["name"])
+			if _, exists := params[key]; !exists {
+				order = append(order, key)
+			}
+			params[key] = param
+		}
+	}
+
+	for _, key := range order {
+		param := params[key]
+		paramName, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		required, _ := param["required"].(bool)
+
+		if in == "body" {
+			// Swagger 2 request body.
+			imp.mergeBodySchema(&schema, imp.resolve(param["schema"], 0), required)
+			continue
+		}
+		if in == "formData" {
+			in = "body"
+		}
+
+		property := imp.parameterSchema(param)
+		property["in"] = in
+		schema.Properties[paramName] = property
+		if required || in == "path" {
+			schema.Required = append(schema.Required, paramName)
+		}
+	}
+
+	if requestBody, ok := imp.resolve(operation["requestBody"], 0).(map[string]interface{}); ok {
+		required, _ := requestBody["required"].(bool)
+		imp.mergeBodySchema(&schema, imp.mediaSchema(requestBody["content"]), required)
+	}
+
+	return GenericToolConfig{
+		ToolName:      name,
+		Description:   description,
+		Request:       RequestConfig{Method: strings.ToUpper(method), URL: baseURL + path},
+		InputSchema:   schema,
+		OutputMapping: imp.outputMapping(operation),
+	}
+}
+
+// parameterSchema returns the JSON Schema of a non-body parameter.
+func (imp *openAPIImporter) parameterSchema(param map[string]interface{}) map[string]interface{} {
+	property := make(map[string]interface{})
+	if s, ok := imp.resolve(param["schema"], 0).(map[string]interface{}); ok {
+		for k, v := range s {
+			property[k] = v
+		}
+	} else {
+		for _, keyword := range schemaKeywords {
+			if v, ok := param[keyword]; ok {
+				property[keyword] = v
+			}
+		}
+	}
+	if property["type"] == "file" {
+		property["type"] = "string"
+	}
+	if description, ok := param["description"].(string); ok {
+		property["description"] = description
+	}
+	return property
+}
+
+// mergeBodySchema adds the properties of an object request body to the tool
+// arguments, or a single "body" argument for non-object bodies.
+func (imp *openAPIImporter) mergeBodySchema(schema *mcp.ToolInputSchema, body interface{}, required bool) {
+	bodySchema, ok := body.(map[string]interface{})
+	if !ok {
+		return
+	}
+	properties, isObject := bodySchema["properties"].(map[string]interface{})
+	if !isObject {
+		property := copySchema(bodySchema)
+		property["in"] = "body"
+		schema.Properties["body"] = property
+		if required {
+			schema.Required = append(schema.Required, "body")
+		}
+		return
+	}
+
+	for name, p := range properties {
+		property := copySchema(p)
+		property["in"] = "body"
+		schema.Properties[name] = property
+	}
+	if requiredList, ok := bodySchema["required"].([]interface{}); ok && required {
+		for _, r := range requiredList {
+			if name, ok := r.(string); ok {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+}
+
+// mediaSchema picks the schema of the JSON media type (or the first one) from a content map.
+func (imp *openAPIImporter) mediaSchema(content interface{}) interface{} {
+	media, ok := content.(map[string]interface{})
+	if !ok || len(media) == 0 {
+		return nil
+	}
+	types := make([]string, 0, len(media))
+	for t := range media {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	chosen := types[0]
+	for _, t := range types {
+		if strings.Contains(t, "json") {
+			chosen = t
+			break
+		}
+	}
+	mediaType, _ := media[chosen].(map[string]interface{})
+	return imp.resolve(mediaType["schema"], 0)
+}
+
+// outputMapping generates a default output mapping from the success response schema.
+func (imp *openAPIImporter) outputMapping(operation map[string]interface{}) []OutputMap {
+	responses, _ := operation["responses"].(map[string]interface{})
+	var response map[string]interface{}
+	for _, code := range []string{"200", "201", "2XX", "default"} {
+		if r, ok := imp.resolve(responses[code], 0).(map[string]interface{}); ok {
+			response = r
+			break
+		}
+	}
+	if response == nil {
+		return nil
+	}
+
+	var schema interface{}
+	if imp.swagger2 {
+		schema = imp.resolve(response["schema"], 0)
+	} else {
+		schema = imp.mediaSchema(response["content"])
+	}
+	s, _ := schema.(map[string]interface{})
+	return mappingsFromSchema(s, "", 0)
+}
+
+// mappingsFromSchema flattens an object schema into output mappings. Nested
+// objects are addressed with dot notation and arrays of objects become
+// "array" mappings.
+func mappingsFromSchema(schema map[string]interface{}, prefix string, depth int) []OutputMap {
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties == nil || depth > 2 {
+		return nil
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mappings []OutputMap
+	for _, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		description, _ := property["description"].(string)
+		if description == "" {
+			description = name
+		}
+		key := prefix + name
+
+		switch property["type"] {
+		case "object":
+			mappings = append(mappings, mappingsFromSchema(property, key+".", depth+1)...)
+		case "array":
+			items, _ := property["items"].(map[string]interface{})
+			itemMappings := mappingsFromSchema(items, "", depth+1)
+			if len(itemMappings) == 0 {
+				mappings = append(mappings, OutputMap{JsonKey: key, Description: description, Type: "primitive"})
+				continue
+			}
+			mappings = append(mappings, OutputMap{JsonKey: key, Description: description, Type: "array", Items: itemMappings})
+		default:
+			if _, isObject := property["properties"]; isObject {
+				mappings = append(mappings, mappingsFromSchema(property, key+".", depth+1)...)
+				continue
+			}
+			mappings = append(mappings, OutputMap{JsonKey: key, Description: description, Type: "primitive"})
+		}
+	}
+	return mappings
+}
+
+// resolve inlines local $ref pointers ("#/components/schemas/Pet") recursively.
+func (imp *openAPIImporter) resolve(node interface{}, depth int) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if depth >= maxRefDepth {
+				return map[string]interface{}{"type": "object"}
+			}
+			target, ok := imp.lookup(ref)
+			if !ok {
+				return map[string]interface{}{}
+			}
+			return imp.resolve(target, depth+1)
+		}
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = imp.resolve(item, depth)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = imp.resolve(item, depth)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// lookup follows a local JSON pointer reference.
+func (imp *openAPIImporter) lookup(ref string) (interface{}, bool) {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, false
+	}
+	var current interface{} = imp.doc
+	for _, part := range strings.Split(pointer, "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// copySchema shallow-copies a schema so that import metadata can be added to it.
+func copySchema(schema interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	if m, ok := schema.(map[string]interface{}); ok {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// normalizeYAML converts map[interface{}]interface{} nodes (e.g. responses
+// keyed by unquoted status codes) into map[string]interface{}.
+func normalizeYAML(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[fmt.Sprintf("%v", k)] = normalizeYAML(item)
+		}
+		return out
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// expandOpenAPISources appends the tools generated from every openapi_sources
+// entry to McpTools. configDir is used to resolve relative document paths.
+func (c *ConfigType) expandOpenAPISources(configDir string) error {
+	for i, source := range c.OpenAPISources {
+		path := source.Path
+		if path == "" {
+			return fmt.Errorf("openapi_sources[%d]: path is required", i)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		c.ReferencedFiles = append(c.ReferencedFiles, path)
+		tools, err := ImportOpenAPIFile(path, ImportOptions{
+			BaseURL:    source.BaseURL,
+			ToolPrefix: source.ToolPrefix,
+			Operations: source.Operations,
+			Headers:    source.Headers,
+		})
+		if err != nil {
+			return fmt.Errorf("openapi_sources[%d]: %w", i, err)
+		}
+		c.McpTools = append(c.McpTools, tools...)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package hyancie
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const petstoreOpenAPI3 = `
+openapi: 3.0.0
+servers:
+  - url: https://{env}.example.com/v1
+    variables:
+      env:
+        default: api
+paths:
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        required: true
+        schema:
+          type: string
+    get:
+      operationId: getPet
+      summary: Get a pet by id
+      parameters:
+        - name: X-Request-ID
+          in: header
+          schema:
+            type: string
+        - name: verbose
+          in: query
+          schema:
+            type: boolean
+      responses:
+        200:
+          description: ok
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+  /pets:
+    post:
+      operationId: createPet
+      description: Create a pet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name:
+                  type: string
+                tag:
+                  type: string
+      responses:
+        "201":
+          description: created
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        name:
+          type: string
+          description: Pet name
+        owner:
+          type: object
+          properties:
+            email:
+              type: string
+        toys:
+          type: array
+          items:
+            type: object
+            properties:
+              label:
+                type: string
+`
+
+const petstoreSwagger2 = `{
+  "swagger": "2.0",
+  "host": "petstore.example.com",
+  "basePath": "/api",
+  "schemes": ["http"],
+  "paths": {
+    "/pets": {
+      "get": {
+        "operationId": "listPets",
+        "summary": "List pets",
+        "parameters": [{"name": "limit", "in": "query", "type": "integer", "maximum": 100}],
+        "responses": {"200": {"description": "ok", "schema": {"type": "object", "properties": {"total": {"type": "integer"}}}}}
+      },
+      "post": {
+        "operationId": "addPet",
+        "parameters": [{"name": "pet", "in": "body", "required": true, "schema": {"$ref": "#/definitions/NewPet"}}],
+        "responses": {"200": {"description": "ok"}}
+      }
+    }
+  },
+  "definitions": {
+    "NewPet": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}
+  }
+}`
+
+func TestImportOpenAPI3(t *testing.T) {
+	tools, err := ImportOpenAPI([]byte(petstoreOpenAPI3), ImportOptions{ToolPrefix: "pets_"})
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+
+	create := tools[0]
+	assert.Equal(t, "pets_createPet", create.ToolName)
+	assert.Equal(t, "Create a pet", create.Description)
+	assert.Equal(t, RequestConfig{Method: "POST", URL: "https://api.example.com/v1/pets"}, create.Request)
+	assert.Equal(t, []string{"name"}, create.InputSchema.Required)
+	assert.Equal(t, "body", create.InputSchema.Properties["tag"].(map[string]interface{})["in"])
+
+	get := tools[1]
+	assert.Equal(t, "pets_getPet", get.ToolName)
+	assert.Equal(t, "Get a pet by id", get.Description)
+	assert.Equal(t, RequestConfig{Method: "GET", URL: "https://api.example.com/v1/pets/{petId}"}, get.Request)
+	assert.Equal(t, []string{"petId"}, get.InputSchema.Required)
+	assert.Equal(t, "path", get.InputSchema.Properties["petId"].(map[string]interface{})["in"])
+	assert.Equal(t, "header", get.InputSchema.Properties["X-Request-ID"].(map[string]interface{})["in"])
+	assert.Equal(t, "query", get.InputSchema.Properties["verbose"].(map[string]interface{})["in"])
+
+	assert.Equal(t, []OutputMap{
+		{JsonKey: "id", Description: "id", Type: "primitive"},
+		{JsonKey: "name", Description: "Pet name", Type: "primitive"},
+		{JsonKey: "owner.email", Description: "email", Type: "primitive"},
+		{JsonKey: "toys", Description: "toys", Type: "array", Items: []OutputMap{
+			{JsonKey: "label", Description: "label", Type: "primitive"},
+		}},
+	}, get.OutputMapping)
+}
+
+func TestImportSwagger2(t *testing.T) {
+	tools, err := ImportOpenAPI([]byte(petstoreSwagger2), ImportOptions{Operations: []string{"listPets", "addPet"}})
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+
+	list := tools[0]
+	assert.Equal(t, "listPets", list.ToolName)
+	assert.Equal(t, "http://petstore.example.com/api/pets", list.Request.URL)
+	limit := list.InputSchema.Properties["limit"].(map[string]interface{})
+	assert.Equal(t, "integer", limit["type"])
+	assert.Equal(t, 100, limit["maximum"])
+	assert.Equal(t, []OutputMap{{JsonKey: "total", Description: "total", Type: "primitive"}}, list.OutputMapping)
+
+	add := tools[1]
+	assert.Equal(t, "POST", add.Request.Method)
+	assert.Equal(t, []string{"name"}, add.InputSchema.Required)
+	assert.Equal(t, "body", add.InputSchema.Properties["name"].(map[string]interface{})["in"])
+}
+
+func TestLoadConfigOpenAPISources(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "petstore.yaml"), []byte(petstoreOpenAPI3), 0o600))
+	configPath := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{
+		"server_name": "test",
+		"openapi_sources": [{
+			"path": "petstore.yaml",
+			"base_url": "http://localhost:9000",
+			"operations": ["getPet"],
+			"headers": [{"name": "X-Api-Key", "value": "${HYANCIE_TEST_PET_KEY:-dev}"}]
+		}]
+	}`), 0o600))
+
+	Config = &ConfigType{}
+	require.NoError(t, LoadConfig(configPath))
+	require.Len(t, Config.McpTools, 1)
+	assert.Equal(t, "getPet", Config.McpTools[0].ToolName)
+	assert.Equal(t, "http://localhost:9000/pets/{petId}", Config.McpTools[0].Request.URL)
+	assert.Equal(t, []Header{{Name: "X-Api-Key", Value: "dev"}}, Config.McpTools[0].Headers)
+	// Hot reload watches the document along with the config.
+	assert.Equal(t, []string{filepath.Join(dir, "petstore.yaml")}, Config.ReferencedFiles)
+}
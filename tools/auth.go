@@ -0,0 +1,348 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+)
+
+const (
+	// tokenRefreshWindow is how long before expiry a cached token is replaced.
+	tokenRefreshWindow = time.Minute
+	// defaultTokenLifetime is assumed when the token endpoint omits expires_in.
+	defaultTokenLifetime = time.Hour
+	// tokenRequestTimeout bounds token requests made in the background.
+	tokenRequestTimeout = 30 * time.Second
+)
+
+// authenticator adds credentials to an outgoing request. It is called for
+// every attempt after the request and its body have been built.
+type authenticator interface {
+	Apply(req *http.Request, payload []byte) error
+}
+
+// invalidator is implemented by authenticators whose credentials can be
+// renewed after the upstream rejects them with 401 Unauthorized.
+type invalidator interface {
+	// Invalidate drops the credentials used by req and reports whether a
+	// retry with fresh credentials is worthwhile.
+	Invalidate(req *http.Request) bool
+}
+
+// closer is implemented by authenticators that run in the background. Close
+// is called when no tool uses the authenticator anymore.
+type closer interface {
+	Close()
+}
+
+// authenticators caches authenticators by their settings, so that tools
+// sharing an auth profile also share its tokens, also across config reloads.
+// pruneAuthenticators drops the ones no tool uses anymore.
+var authenticators = struct {
+	sync.Mutex
+	byKey map[string]authenticator
+}{byKey: make(map[string]authenticator)}
+
+// authForTool resolves the tool's auth settings, following auth.profile, and
+// returns the shared authenticator for them, or nil if the tool has no auth.
+func authForTool(global *hyancie.ConfigType, config hyancie.GenericToolConfig, client *http.Client) (authenticator, error) {
+	if config.Auth == nil {
+		return nil, nil
+	}
+	settings, err := authSettings(global, config)
+	if err != nil {
+		return nil, err
+	}
+	key, err := authKey(settings, client)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticators.Lock()
+	defer authenticators.Unlock()
+	if auth, ok := authenticators.byKey[key]; ok {
+		return auth, nil
+	}
+	auth, err := newAuthenticator(settings, client)
+	if err != nil {
+		return nil, err
+	}
+	authenticators.byKey[key] = auth
+	return auth, nil
+}
+
+// authSettings returns the auth settings of a tool, following auth.profile.
+func authSettings(global *hyancie.ConfigType, config hyancie.GenericToolConfig) (hyancie.AuthConfig, error) {
+	settings := *config.Auth
+	if settings.Profile != "" {
+		profile, ok := global.AuthProfiles[settings.Profile]
+		if !ok {
+			return settings, fmt.Errorf("unknown auth profile %q", settings.Profile)
+		}
+		settings = profile
+	}
+	return settings, nil
+}
+
+// authKey identifies an authenticator by its settings and HTTP client.
+func authKey(settings hyancie.AuthConfig, client *http.Client) (string, error) {
+	fingerprint, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s|%p", fingerprint, client), nil
+}
+
+// pruneAuthenticators drops the cached authenticators that no tool of the
+// config uses and closes them. It runs after the tools were re-registered, so
+// that the clients of the config are cached.
+func pruneAuthenticators(global *hyancie.ConfigType) {
+	used := make(map[string]bool)
+	for _, config := range global.McpTools {
+		if config.Auth == nil {
+			continue
+		}
+		settings, err := authSettings(global, config)
+		if err != nil {
+			continue
+		}
+		client, err := clientForTool(global, config)
+		if err != nil {
+			continue
+		}
+		if key, err := authKey(settings, client); err == nil {
+			used[key] = true
+		}
+	}
+
+	authenticators.Lock()
+	defer authenticators.Unlock()
+	for key, auth := range authenticators.byKey {
+		if used[key] {
+			continue
+		}
+		if c, ok := auth.(closer); ok {
+			c.Close()
+		}
+		delete(authenticators.byKey, key)
+	}
+}
+
+// newAuthenticator builds the authenticator for auth.type.
+func newAuthenticator(settings hyancie.AuthConfig, client *http.Client) (authenticator, error) {
+	switch settings.Type {
+	case "oauth2":
+		return newOAuth2Auth(settings, client)
+	case "basic":
+		return &basicAuth{username: settings.Username, password: settings.Password}, nil
+	case "hmac":
+		return newHMACAuth(settings)
+	case "aws_sigv4":
+		return newSigV4Auth(settings)
+	}
+	return nil, fmt.Errorf("unsupported auth type %q", settings.Type)
+}
+
+// oauth2Auth injects bearer tokens obtained with the client credentials or
+// refresh token grant. Tokens are cached and renewed in the background
+// shortly before they expire, so that calls do not wait for the token
+// endpoint.
+type oauth2Auth struct {
+	settings hyancie.AuthConfig
+	client   *http.Client
+
+	mu           sync.Mutex
+	accessToken  string
+	expiry       time.Time
+	refreshToken string
+	refresh      *time.Timer // Renews the token before it expires
+	closed       bool
+}
+
+func newOAuth2Auth(settings hyancie.AuthConfig, client *http.Client) (*oauth2Auth, error) {
+	switch settings.GrantType {
+	case "", "client_credentials", "refresh_token":
+	default:
+		return nil, fmt.Errorf("unsupported oauth2 grant_type %q", settings.GrantType)
+	}
+	if settings.TokenURL == "" {
+		return nil, fmt.Errorf("oauth2 token_url is required")
+	}
+	return &oauth2Auth{settings: settings, client: client, refreshToken: settings.RefreshToken}, nil
+}
+
+// Apply sets the Authorization header, fetching a token first if needed.
+func (a *oauth2Auth) Apply(req *http.Request, payload []byte) error {
+	token, err := a.token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Invalidate forgets the token used by req. It reports false if req did not
+// carry a token of this authenticator, so there is nothing to renew. A token
+// that a concurrent call already dropped or replaced counts as cleared.
+func (a *oauth2Auth) Invalidate(req *http.Request) bool {
+	used, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || used == "" {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.accessToken == used {
+		a.accessToken = ""
+	}
+	return a.accessToken != used
+}
+
+// Close stops the background renewal of the token.
+func (a *oauth2Auth) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+	if a.refresh != nil {
+		a.refresh.Stop()
+	}
+}
+
+// token returns a cached token that is valid for at least tokenRefreshWindow,
+// or fetches a new one. Concurrent callers wait for a single token request.
+func (a *oauth2Auth) token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.accessToken != "" && time.Until(a.expiry) > tokenRefreshWindow {
+		return a.accessToken, nil
+	}
+	return a.fetch(ctx)
+}
+
+// renew fetches a new token ahead of the expiry of the cached one. If that
+// fails, the next call fetches the token itself.
+func (a *oauth2Auth) renew() {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	defer cancel()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	if _, err := a.fetch(ctx); err != nil {
+		logging.Logger.Warn("Failed to renew OAuth2 token", "token_url", a.settings.TokenURL, "error", err)
+	}
+}
+
+// fetch requests a new token from the token endpoint and caches it. The
+// caller holds a.mu.
+func (a *oauth2Auth) fetch(ctx context.Context) (string, error) {
+	form := url.Values{}
+	if a.settings.GrantType == "refresh_token" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", a.refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(a.settings.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.settings.Scopes, " "))
+	}
+	for name, value := range a.settings.ExtraParams {
+		form.Set(name, value)
+	}
+	if a.settings.ClientAuth == "body" {
+		form.Set("client_id", a.settings.ClientID)
+		if a.settings.ClientSecret != "" {
+			form.Set("client_secret", a.settings.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.settings.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create oauth2 token request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentTypeForm)
+	req.Header.Set("Accept", "application/json")
+	if a.settings.ClientAuth != "body" && a.settings.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(a.settings.ClientID), url.QueryEscape(a.settings.ClientSecret))
+	}
+
+	logging.Logger.Info("Requesting OAuth2 token", "token_url", a.settings.TokenURL, "grant_type", form.Get("grant_type"))
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oauth2 token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read oauth2 token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oauth2 token request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	token, err := parseTokenResponse(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return "", err
+	}
+	lifetime := defaultTokenLifetime
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	a.accessToken = token.AccessToken
+	a.expiry = time.Now().Add(lifetime)
+	if token.RefreshToken != "" {
+		// Servers may rotate refresh tokens on every use.
+		a.refreshToken = token.RefreshToken
+	}
+	if a.refresh != nil {
+		a.refresh.Stop()
+	}
+	// Tokens that live shorter than the refresh window are fetched per call.
+	if lifetime > tokenRefreshWindow && !a.closed {
+		a.refresh = time.AfterFunc(lifetime-tokenRefreshWindow, a.renew)
+	}
+	return a.accessToken, nil
+}
+
+// tokenResponse is the successful response of an OAuth2 token endpoint.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// parseTokenResponse decodes a JSON or form-encoded token response.
+func parseTokenResponse(contentType string, body []byte) (*tokenResponse, error) {
+	token := &tokenResponse{}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == contentTypeForm || mediaType == "text/plain" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode oauth2 token response: %w", err)
+		}
+		token.AccessToken = values.Get("access_token")
+		token.TokenType = values.Get("token_type")
+		token.RefreshToken = values.Get("refresh_token")
+		fmt.Sscanf(values.Get("expires_in"), "%d", &token.ExpiresIn)
+	} else if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("failed to decode oauth2 token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2 token response has no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported oauth2 token_type %q", token.TokenType)
+	}
+	return token, nil
+}
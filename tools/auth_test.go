@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenServer is a fake OAuth2 token endpoint that issues numbered tokens.
+type tokenServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	issued    int
+	expiresIn int
+	forms     []map[string]string
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{expiresIn: expiresIn}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form := map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		if id, secret, ok := r.BasicAuth(); ok {
+			form["basic"] = id + ":" + secret
+		}
+
+		ts.mu.Lock()
+		ts.issued++
+		ts.forms = append(ts.forms, form)
+		issued := ts.issued
+		ts.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": %d, "refresh_token": "refresh-%d"}`, issued, ts.expiresIn, issued)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *tokenServer) count() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.issued
+}
+
+// newAuthTestServer registers tools calling url with the given auth settings.
+func newAuthTestServer(t *testing.T, url string, auths map[string]*hyancieMCP.AuthConfig) *server.MCPServer {
+	t.Helper()
+	hyancieMCP.Config.McpTools = nil
+	for name, auth := range auths {
+		hyancieMCP.Config.McpTools = append(hyancieMCP.Config.McpTools, hyancieMCP.GenericToolConfig{
+			ToolName:      name,
+			Request:       hyancieMCP.RequestConfig{Method: "GET", URL: url},
+			InputSchema:   mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+			OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "user", Description: "User", Type: "primitive"}},
+			Auth:          auth,
+		})
+	}
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	return s
+}
+
+func TestGenericToolOAuth2ClientCredentials(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	var seen []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"user": "svc"}`))
+	}))
+	defer api.Close()
+
+	hyancieMCP.Config.AuthProfiles = map[string]hyancieMCP.AuthConfig{
+		"crm": {Type: "oauth2", TokenURL: tokens.URL, ClientID: "id", ClientSecret: "secret", Scopes: []string{"read", "write"}, ExtraParams: map[string]string{"audience": "crm"}},
+	}
+	defer func() { hyancieMCP.Config.AuthProfiles = nil }()
+	s := newAuthTestServer(t, api.URL, map[string]*hyancieMCP.AuthConfig{
+		"first":  {Profile: "crm"},
+		"second": {Profile: "crm"},
+	})
+
+	for _, name := range []string{"first", "second", "first"} {
+		result, err := getToolHandler(s, name)(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "User:svc", joinContents(result.Content))
+	}
+
+	// Both tools share the profile's cached token.
+	assert.Equal(t, 1, tokens.count())
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-1", "Bearer token-1"}, seen)
+	assert.Equal(t, map[string]string{
+		"grant_type": "client_credentials",
+		"scope":      "read write",
+		"audience":   "crm",
+		"basic":      "id:secret",
+	}, tokens.forms[0])
+}
+
+func TestGenericToolOAuth2RefreshAndRetry(t *testing.T) {
+	t.Run("retries once on 401 with a fresh token", func(t *testing.T) {
+		tokens := newTokenServer(t, 3600)
+		var seen []string
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") == "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"user": "svc"}`))
+		}))
+		defer api.Close()
+
+		s := newAuthTestServer(t, api.URL, map[string]*hyancieMCP.AuthConfig{
+			"revoked": {Type: "oauth2", TokenURL: tokens.URL, ClientID: "revoked", ClientAuth: "body"},
+		})
+		result, err := getToolHandler(s, "revoked")(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "User:svc", joinContents(result.Content))
+		assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, seen)
+		assert.Equal(t, "revoked", tokens.forms[0]["client_id"])
+	})
+
+	t.Run("gives up after one retry", func(t *testing.T) {
+		tokens := newTokenServer(t, 3600)
+		calls := 0
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer api.Close()
+
+		s := newAuthTestServer(t, api.URL, map[string]*hyancieMCP.AuthConfig{
+			"denied": {Type: "oauth2", TokenURL: tokens.URL, ClientID: "denied"},
+		})
+		_, err := getToolHandler(s, "denied")(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "status 401")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("refresh token grant renews expiring tokens and rotates refresh tokens", func(t *testing.T) {
+		// Tokens expiring within the refresh window are replaced before every call.
+		tokens := newTokenServer(t, 30)
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"user": "` + r.Header.Get("Authorization") + `"}`))
+		}))
+		defer api.Close()
+
+		s := newAuthTestServer(t, api.URL, map[string]*hyancieMCP.AuthConfig{
+			"refreshing": {Type: "oauth2", GrantType: "refresh_token", TokenURL: tokens.URL, ClientID: "app", RefreshToken: "initial"},
+		})
+		handler := getToolHandler(s, "refreshing")
+		for i := 1; i <= 2; i++ {
+			result, err := handler(context.Background(), mcp.CallToolRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("User:Bearer token-%d", i), joinContents(result.Content))
+		}
+		assert.Equal(t, "initial", tokens.forms[0]["refresh_token"])
+		assert.Equal(t, "refresh-1", tokens.forms[1]["refresh_token"])
+		assert.Equal(t, "refresh_token", tokens.forms[1]["grant_type"])
+	})
+
+	t.Run("token endpoint errors are reported", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_client"}`))
+		}))
+		defer failing.Close()
+
+		s := newAuthTestServer(t, "http://127.0.0.1:1/unused", map[string]*hyancieMCP.AuthConfig{
+			"broken": {Type: "oauth2", TokenURL: failing.URL, ClientID: "broken"},
+		})
+		_, err := getToolHandler(s, "broken")(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid_client")
+	})
+}
+
+func TestOAuth2TokenLifecycle(t *testing.T) {
+	t.Run("invalidate reports whether the token was cleared", func(t *testing.T) {
+		auth := &oauth2Auth{accessToken: "token-1"}
+		req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		assert.False(t, auth.Invalidate(req))
+		assert.Equal(t, "token-1", auth.accessToken)
+
+		req.Header.Set("Authorization", "Bearer token-1")
+		assert.True(t, auth.Invalidate(req))
+		assert.Empty(t, auth.accessToken)
+
+		// A concurrent call already replaced the rejected token.
+		auth.accessToken = "token-2"
+		assert.True(t, auth.Invalidate(req))
+		assert.Equal(t, "token-2", auth.accessToken)
+	})
+
+	t.Run("tokens are renewed before they expire", func(t *testing.T) {
+		// The token is renewed one second after it was issued.
+		tokens := newTokenServer(t, 61)
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"user": "` + r.Header.Get("Authorization") + `"}`))
+		}))
+		defer api.Close()
+
+		s := newAuthTestServer(t, api.URL, map[string]*hyancieMCP.AuthConfig{
+			"renewing": {Type: "oauth2", TokenURL: tokens.URL, ClientID: "renewing"},
+		})
+		handler := getToolHandler(s, "renewing")
+		result, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "User:Bearer token-1", joinContents(result.Content))
+
+		assert.Eventually(t, func() bool { return tokens.count() == 2 }, 5*time.Second, 50*time.Millisecond)
+		result, err = handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "User:Bearer token-2", joinContents(result.Content))
+		assert.Equal(t, 2, tokens.count())
+	})
+
+	t.Run("authenticators of removed tools are dropped on reload", func(t *testing.T) {
+		tokens := newTokenServer(t, 3600)
+		s := newAuthTestServer(t, "http://127.0.0.1:1/unused", map[string]*hyancieMCP.AuthConfig{
+			"removed": {Type: "oauth2", TokenURL: tokens.URL, ClientID: "removed"},
+		})
+		previous := &hyancieMCP.ConfigType{McpTools: hyancieMCP.Config.McpTools}
+		tool := previous.McpTools[0]
+		client, err := clientForTool(previous, tool)
+		require.NoError(t, err)
+		auth, err := authForTool(previous, tool, client)
+		require.NoError(t, err)
+		key, err := authKey(*tool.Auth, client)
+		require.NoError(t, err)
+
+		ReloadGenericTools(s, previous, &hyancieMCP.ConfigType{})
+		authenticators.Lock()
+		_, cached := authenticators.byKey[key]
+		authenticators.Unlock()
+		assert.False(t, cached)
+		assert.True(t, auth.(*oauth2Auth).closed)
+	})
+}
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultMaxBinaryBytes is the default limit of binary responses and fetched images.
+const defaultMaxBinaryBytes = 10 << 20
+
+// parseMediaType returns the lower-case media type of a Content-Type header, without parameters.
+func parseMediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return parsed
+}
+
+// isBinaryType reports whether a media type has content that cannot be shown as text,
+// such as images, audio, video, PDFs and archives.
+func isBinaryType(mediaType string) bool {
+	switch {
+	case mediaType == "", strings.HasPrefix(mediaType, "text/"), detectFormat(mediaType) != "":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "font/"):
+		return true
+	}
+	for _, textual := range []string{"javascript", "ecmascript", "x-www-form-urlencoded", "graphql", "x-ndjson", "jsonl"} {
+		if strings.Contains(mediaType, textual) {
+			return false
+		}
+	}
+	return strings.HasPrefix(mediaType, "application/")
+}
+
+// binaryType returns the media type of a response whose content is binary.
+// A response.format override always decodes the body as text.
+func (d *responseDecoder) binaryType(header http.Header) (string, bool) {
+	if d.format != "" {
+		return "", false
+	}
+	contentType := parseMediaType(header.Get("Content-Type"))
+	return contentType, isBinaryType(contentType)
+}
+
+// errResponseTooLarge reports a response body beyond response.max_bytes.
+var errResponseTooLarge = errors.New("exceeds response.max_bytes")
+
+// bodyLimit returns the largest response body read for the header:
+// response.max_bytes for binary responses, 0 (no limit) for the others.
+func (d *responseDecoder) bodyLimit(header http.Header) int64 {
+	if _, isBinary := d.binaryType(header); isBinary {
+		return d.maxBytes
+	}
+	return 0
+}
+
+// binaryContent returns images as image content and other binary data as
+// an embedded blob resource identified by uri.
+func binaryContent(uri, mediaType string, data []byte) mcp.Content {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if strings.HasPrefix(mediaType, "image/") {
+		return mcp.NewImageContent(encoded, mediaType)
+	}
+	return mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+		URI:      uri,
+		MIMEType: mediaType,
+		Blob:     encoded,
+	})
+}
+
+// imageURL returns the URL at response.image_url in the decoded response,
+// resolved against the URL of the request, or "" if there is none.
+func (d *responseDecoder) imageURL(data interface{}, requestURL string) (string, error) {
+	if d.imageURLKey == "" {
+		return "", nil
+	}
+	value, found := getValue(data, d.imageURLKey)
+	link, _ := value.(string)
+	if !found || link == "" {
+		return "", nil
+	}
+	base, err := url.Parse(requestURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid image URL %q: %w", link, err)
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", fmt.Errorf("invalid image URL %q: unsupported scheme", link)
+	}
+	return resolved.String(), nil
+}
+
+// fetchImage downloads an image with a plain GET request, without the
+// tool's headers and credentials, which are meant for the API and not for
+// the host of the image. Bodies beyond response.max_bytes are not read.
+func (d *responseDecoder) fetchImage(ctx context.Context, client *http.Client, imageURL string, timeout time.Duration) (mcp.Content, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitForUpstream(ctx, req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req = req.WithContext(attemptCtx)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+	if !isSuccess(resp.StatusCode) {
+		return nil, fmt.Errorf("failed to fetch image %s: status %d", imageURL, resp.StatusCode)
+	}
+	if resp.ContentLength > d.maxBytes {
+		return nil, fmt.Errorf("image %s of %d bytes exceeds response.max_bytes (%d)", imageURL, resp.ContentLength, d.maxBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, d.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %s: %w", imageURL, err)
+	}
+	if int64(len(data)) > d.maxBytes {
+		return nil, fmt.Errorf("image %s exceeds response.max_bytes (%d)", imageURL, d.maxBytes)
+	}
+
+	contentType := parseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		// Servers often send images as application/octet-stream.
+		contentType = parseMediaType(http.DetectContentType(data))
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%s is not an image, got %s", imageURL, contentType)
+	}
+	return binaryContent(imageURL, contentType, data), nil
+}
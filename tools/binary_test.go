@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader is enough of a PNG file for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestIsBinaryType(t *testing.T) {
+	for mediaType, binary := range map[string]bool{
+		"image/png":                true,
+		"image/svg+xml":            false,
+		"application/pdf":          true,
+		"application/octet-stream": true,
+		"application/zip":          true,
+		"audio/mpeg":               true,
+		"application/json":         false,
+		"application/vnd.api+json": false,
+		"application/javascript":   false,
+		"text/plain":               false,
+		"":                         false,
+	} {
+		assert.Equal(t, binary, isBinaryType(mediaType), mediaType)
+	}
+}
+
+func TestGenericToolBinaryResponses(t *testing.T) {
+	pdf := []byte("%PDF-1.4 binary \x00\x01\x02")
+	var authorization string
+	var streamed int
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chart":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(pngHeader)
+		case "/report":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(pdf)
+		case "/stream":
+			// Chunked, without a Content-Length
+			streamed++
+			w.Header().Set("Content-Type", "application/pdf")
+			w.(http.Flusher).Flush()
+			w.Write(pdf)
+		case "/photo":
+			fmt.Fprintf(w, `{"title": "Sunset", "urls": {"small": %q}}`, r.URL.Query().Get("image"))
+		case "/images/sunset":
+			authorization = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(pngHeader)
+		case "/images/proxied":
+			// Image proxies may answer with any 2xx status.
+			w.Header().Set("Content-Type", "image/png")
+			w.WriteHeader(http.StatusNonAuthoritativeInfo)
+			w.Write(pngHeader)
+		case "/images/missing":
+			http.NotFound(w, r)
+		case "/images/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html></html>")
+		}
+	}))
+	defer mockAPIServer.Close()
+
+	call := func(path string, response *hyancieMCP.ResponseConfig) (*mcp.CallToolResult, error) {
+		config := hyancieMCP.GenericToolConfig{
+			ToolName:      "binary",
+			Request:       hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + path},
+			Headers:       []hyancieMCP.Header{{Name: "Authorization", Value: "Bearer secret"}},
+			InputSchema:   mcp.ToolInputSchema{Type: "object"},
+			OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "title", Description: "标题", Type: "primitive"}},
+			Response:      response,
+		}
+		return newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+	}
+
+	// Images become image content.
+	result, err := call("/chart", nil)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+	assert.Equal(t, mcp.NewImageContent(base64.StdEncoding.EncodeToString(pngHeader), "image/png"), result.Content[0])
+	assert.Equal(t, mockAPIServer.URL+"/chart", result.Meta["expandedURL"])
+
+	// Other binary content becomes an embedded blob resource.
+	result, err = call("/report", nil)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+	assert.Equal(t, mcp.NewEmbeddedResource(mcp.BlobResourceContents{
+		URI:      mockAPIServer.URL + "/report",
+		MIMEType: "application/pdf",
+		Blob:     base64.StdEncoding.EncodeToString(pdf),
+	}), result.Content[0])
+
+	_, err = call("/report", &hyancieMCP.ResponseConfig{MaxBytes: 10})
+	assert.ErrorContains(t, err, "binary response of 19 bytes exceeds response.max_bytes (10)")
+
+	// Larger bodies are not read beyond the limit, and not retried.
+	_, err = newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName:    "stream",
+		Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/stream"},
+		InputSchema: mcp.ToolInputSchema{Type: "object"},
+		Retry:       &hyancieMCP.RetryConfig{MaxAttempts: 3},
+		Response:    &hyancieMCP.ResponseConfig{MaxBytes: 10},
+	})(context.Background(), mcp.CallToolRequest{})
+	assert.ErrorContains(t, err, "binary response exceeds response.max_bytes (10)")
+	assert.Equal(t, 1, streamed)
+
+	// An image URL in a JSON response is fetched, without the tool's headers, and
+	// returned after the text. Relative URLs are resolved against the request URL.
+	result, err = call("/photo?image=/images/sunset", &hyancieMCP.ResponseConfig{ImageURL: "urls.small"})
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	assert.Equal(t, "标题:Sunset", joinContents(result.Content))
+	assert.Equal(t, mcp.NewImageContent(base64.StdEncoding.EncodeToString(pngHeader), "image/png"), result.Content[1])
+	assert.Equal(t, mockAPIServer.URL+"/images/sunset", result.Meta["imageURL"])
+	assert.Empty(t, authorization)
+
+	// Without an image URL in the response, there is only the text.
+	result, err = call("/photo", &hyancieMCP.ResponseConfig{ImageURL: "urls.small"})
+	require.NoError(t, err)
+	assert.Len(t, result.Content, 1)
+
+	result, err = call("/photo?image=/images/proxied", &hyancieMCP.ResponseConfig{ImageURL: "urls.small"})
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	assert.Equal(t, mcp.NewImageContent(base64.StdEncoding.EncodeToString(pngHeader), "image/png"), result.Content[1])
+	_, err = call("/photo?image=/images/missing", &hyancieMCP.ResponseConfig{ImageURL: "urls.small"})
+	assert.ErrorContains(t, err, "status 404")
+
+	_, err = call("/photo?image=/images/sunset", &hyancieMCP.ResponseConfig{ImageURL: "urls.small", MaxBytes: 8})
+	assert.ErrorContains(t, err, "exceeds response.max_bytes (8)")
+	_, err = call("/photo?image=/images/page", &hyancieMCP.ResponseConfig{ImageURL: "urls.small"})
+	assert.ErrorContains(t, err, "is not an image, got text/html")
+	_, err = call("/photo?image=file:///etc/passwd", &hyancieMCP.ResponseConfig{ImageURL: "urls.small"})
+	assert.ErrorContains(t, err, "unsupported scheme")
+}
@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// singleFieldAction matches a template string consisting of a single argument
+// reference such as "{{ .user_id }}" or "{{ .lookup.id }}", whose value is
+// substituted with its type.
+var singleFieldAction = regexp.MustCompile(`^\{\{-?\s*\.([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\s*-?\}\}$`)
+
+// bodyTemplateFuncs are the helper functions available in body templates.
+var bodyTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. {{ json .tags }}.
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	// default returns fallback when value is missing or empty, e.g. {{ default "en" .lang }}.
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// bodyTemplate renders a request body from the tool arguments.
+//
+// A string template is a Go text/template whose output is sent verbatim. A
+// JSON template (object or array) is walked recursively: string values
+// containing {{ }} are rendered as templates, values that are exactly one
+// argument reference keep the argument's JSON type, and object keys whose
+// argument is missing are omitted.
+type bodyTemplate struct {
+	text *template.Template
+	tree interface{}
+}
+
+// bodyField is a compiled JSON template leaf that refers to a single argument,
+// or to a nested value with a dot-separated name.
+type bodyField struct {
+	name string
+}
+
+// newBodyTemplate compiles the body_template of a tool config. It returns nil
+// when no template is configured.
+func newBodyTemplate(raw json.RawMessage) (*bodyTemplate, error) {
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return nil, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid body_template: %w", err)
+	}
+
+	if text, ok := decoded.(string); ok {
+		t, err := template.New("body").Funcs(bodyTemplateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body_template: %w", err)
+		}
+		return &bodyTemplate{text: t}, nil
+	}
+
+	tree, err := compileBodyNode(decoded, "body")
+	if err != nil {
+		return nil, err
+	}
+	return &bodyTemplate{tree: tree}, nil
+}
+
+// compileBodyNode replaces template strings in a JSON template by compiled templates.
+func compileBodyNode(node interface{}, path string) (interface{}, error) {
+	switch v := node.(type) {
+	case string:
+		if m := singleFieldAction.FindStringSubmatch(v); m != nil {
+			return bodyField{name: m[1]}, nil
+		}
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		t, err := template.New(path).Funcs(bodyTemplateFuncs).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body_template at %s: %w", path, err)
+		}
+		return t, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			compiled, err := compileBodyNode(item, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = compiled
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			compiled, err := compileBodyNode(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = compiled
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// Render produces the request body for the given arguments.
+func (b *bodyTemplate) Render(args map[string]interface{}) ([]byte, error) {
+	if b.text != nil {
+		var buf bytes.Buffer
+		if err := b.text.Execute(&buf, args); err != nil {
+			return nil, fmt.Errorf("failed to render body_template: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	rendered, _, err := renderBodyNode(b.tree, args)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return out, nil
+}
+
+// renderBodyNode renders a compiled JSON template node. The boolean result is
+// false when the node refers to a missing argument and should be omitted.
+func renderBodyNode(node interface{}, args map[string]interface{}) (interface{}, bool, error) {
+	switch v := node.(type) {
+	case bodyField:
+		value, ok := getValueFromNestedMap(args, v.name)
+		return value, ok, nil
+	case *template.Template:
+		var buf bytes.Buffer
+		if err := v.Execute(&buf, args); err != nil {
+			return nil, false, fmt.Errorf("failed to render body_template: %w", err)
+		}
+		return buf.String(), true, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(map[string]interface{}, len(v))
+		for _, k := range keys {
+			value, ok, err := renderBodyNode(v[k], args)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				out[k] = value
+			}
+		}
+		return out, true, nil
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			value, ok, err := renderBodyNode(item, args)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				out = append(out, value)
+			}
+		}
+		return out, true, nil
+	default:
+		return v, true, nil
+	}
+}
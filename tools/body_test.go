@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyTemplate(t *testing.T) {
+	args := map[string]interface{}{
+		"name":  "Alice",
+		"age":   float64(30),
+		"admin": true,
+		"tags":  []interface{}{"a", "b"},
+	}
+
+	t.Run("JSON template preserves types and omits missing arguments", func(t *testing.T) {
+		tmpl, err := newBodyTemplate(json.RawMessage(`{
+			"data": {
+				"type": "users",
+				"attributes": {
+					"name": "{{ .name }}",
+					"age": "{{.age}}",
+					"admin": "{{ .admin }}",
+					"nickname": "{{ .nickname }}",
+					"greeting": "Hello {{ .name }}!",
+					"labels": ["fixed", "{{ .tags }}"]
+				}
+			}
+		}`))
+		require.NoError(t, err)
+
+		out, err := tmpl.Render(args)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"data": {
+				"type": "users",
+				"attributes": {
+					"name": "Alice",
+					"age": 30,
+					"admin": true,
+					"greeting": "Hello Alice!",
+					"labels": ["fixed", ["a", "b"]]
+				}
+			}
+		}`, string(out))
+	})
+
+	t.Run("string template with conditionals and helpers", func(t *testing.T) {
+		tmpl, err := newBodyTemplate(json.RawMessage(`"{\"name\": {{ json .name }}, \"lang\": {{ json (default \"en\" .lang) }}{{ if .admin }}, \"role\": \"admin\"{{ end }}, \"tags\": {{ json .tags }}}"`))
+		require.NoError(t, err)
+
+		out, err := tmpl.Render(args)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name": "Alice", "lang": "en", "role": "admin", "tags": ["a", "b"]}`, string(out))
+	})
+
+	t.Run("no template", func(t *testing.T) {
+		tmpl, err := newBodyTemplate(nil)
+		require.NoError(t, err)
+		assert.Nil(t, tmpl)
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := newBodyTemplate(json.RawMessage(`{"a": "{{ .name "}`))
+		require.Error(t, err)
+	})
+}
+
+func TestGenericToolBodyTemplate(t *testing.T) {
+	var method string
+	var body map[string]interface{}
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		raw, _ := io.ReadAll(r.Body)
+		body = nil
+		json.Unmarshal(raw, &body)
+		w.Write([]byte(`{"status": "deleted"}`))
+	}))
+	defer mockAPIServer.Close()
+
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{{
+		ToolName:    "delete_items",
+		Description: "Delete items",
+		Request: hyancieMCP.RequestConfig{
+			Method:       "DELETE",
+			URL:          mockAPIServer.URL + "/items",
+			BodyTemplate: json.RawMessage(`{"ids": "{{ .ids }}", "reason": "cleanup"}`),
+		},
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]interface{}{"ids": map[string]interface{}{"type": "array"}},
+		},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "status", Description: "Status", Type: "primitive"}},
+	}}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	handler := getToolHandler(s, "delete_items")
+	require.NotNil(t, handler)
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{
+		"ids": []interface{}{float64(1), float64(2)},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, "Status:deleted", joinContents(result.Content))
+	assert.Equal(t, http.MethodDelete, method)
+	assert.Equal(t, map[string]interface{}{"ids": []interface{}{float64(1), float64(2)}, "reason": "cleanup"}, body)
+}
@@ -0,0 +1,322 @@
+package tools
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+const (
+	// defaultCacheTTL is the freshness lifetime when the cache config sets none.
+	defaultCacheTTL = time.Minute
+	// defaultCacheEntries bounds a cache when max_entries is not configured.
+	defaultCacheEntries = 100
+)
+
+// Cache statuses reported in the result metadata.
+const (
+	cacheMiss        = "miss"        // Fetched from the upstream and stored if cacheable
+	cacheHit         = "hit"         // Served from the cache without contacting the upstream
+	cacheRevalidated = "revalidated" // The upstream confirmed the stale entry with 304 Not Modified
+	cacheCoalesced   = "coalesced"   // Shared the response of a concurrent identical call
+)
+
+// responseCache is the in-memory LRU cache of a tool's successful upstream
+// responses. Concurrent calls with the same key share a single upstream request.
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	keyHeaders []string
+	entries    map[string]*list.Element
+	order      *list.List // Most recently used first
+	calls      map[string]*cacheCall
+	now        func() time.Time
+}
+
+// cacheEntry is a stored response and its freshness.
+type cacheEntry struct {
+	key      string
+	response *upstreamResponse
+	stored   time.Time
+	expires  time.Time
+}
+
+// cacheCall is an upstream request that identical calls wait for.
+type cacheCall struct {
+	done     chan struct{}
+	response *upstreamResponse
+	err      error
+	canceled bool // The caller that sent the request gave up
+}
+
+// cacheOutcome describes how a response was obtained.
+type cacheOutcome struct {
+	status string
+	age    time.Duration
+}
+
+// meta returns the cache metadata added to the tool result.
+func (o cacheOutcome) meta() map[string]interface{} {
+	meta := map[string]interface{}{
+		"status": o.status,
+		"hit":    o.status != cacheMiss,
+	}
+	if o.status == cacheHit {
+		meta["ageSeconds"] = int(o.age.Seconds())
+	}
+	return meta
+}
+
+// fetchFunc sends the upstream request with additional conditional headers, which may be nil.
+type fetchFunc func(ctx context.Context, conditional http.Header) (*upstreamResponse, error)
+
+// isCacheableMethod reports whether responses to the method may be cached and
+// shared. Other methods may have side effects, so every call must reach the upstream.
+func isCacheableMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodHead:
+		return true
+	}
+	return false
+}
+
+// newResponseCache returns the cache of a tool, or nil if caching is not enabled.
+func newResponseCache(config *hyancie.CacheConfig) (*responseCache, error) {
+	if config == nil {
+		return nil, nil
+	}
+	cache := &responseCache{
+		ttl:        defaultCacheTTL,
+		maxEntries: defaultCacheEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		calls:      make(map[string]*cacheCall),
+		now:        time.Now,
+	}
+	if config.TTL != "" {
+		d, err := time.ParseDuration(config.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache.ttl %q: %w", config.TTL, err)
+		}
+		cache.ttl = d
+	}
+	if config.MaxEntries > 0 {
+		cache.maxEntries = config.MaxEntries
+	}
+	for _, name := range config.KeyHeaders {
+		cache.keyHeaders = append(cache.keyHeaders, http.CanonicalHeaderKey(name))
+	}
+	sort.Strings(cache.keyHeaders)
+	return cache, nil
+}
+
+// key identifies a request by its method, expanded URL, the configured key
+// headers and, if there is one, a hash of the body.
+func (c *responseCache) key(method, url string, header http.Header, payload []byte) string {
+	var key strings.Builder
+	key.WriteString(method + " " + url)
+	for _, name := range c.keyHeaders {
+		key.WriteString("\n" + name + ": " + strings.Join(header.Values(name), ", "))
+	}
+	if payload != nil {
+		sum := sha256.Sum256(payload)
+		key.WriteString("\nbody: " + hex.EncodeToString(sum[:]))
+	}
+	return key.String()
+}
+
+// do returns a fresh cached response for the key, or fetches one. A stale
+// entry with an ETag or Last-Modified validator is revalidated with a
+// conditional request. While a fetch is running, identical calls wait for it.
+// If the caller that sent the request gives up, the waiting calls retry.
+func (c *responseCache) do(ctx context.Context, key string, fetch fetchFunc) (*upstreamResponse, cacheOutcome, error) {
+	for {
+		c.mu.Lock()
+		now := c.now()
+		var stale *cacheEntry
+		if element, ok := c.entries[key]; ok {
+			entry := element.Value.(*cacheEntry)
+			switch {
+			case now.Before(entry.expires):
+				c.order.MoveToFront(element)
+				c.mu.Unlock()
+				return entry.response, cacheOutcome{status: cacheHit, age: now.Sub(entry.stored)}, nil
+			case validators(entry.response.Header) != nil:
+				stale = entry
+			default:
+				c.remove(element)
+			}
+		}
+		if call, ok := c.calls[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, cacheOutcome{}, ctx.Err()
+			}
+			switch {
+			case call.canceled:
+				continue
+			case call.err != nil:
+				return nil, cacheOutcome{}, call.err
+			}
+			return call.response, cacheOutcome{status: cacheCoalesced}, nil
+		}
+		call := &cacheCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+
+		response, outcome, err := c.fetch(ctx, key, stale, fetch)
+		call.response, call.err = response, err
+		call.canceled = err != nil && ctx.Err() != nil
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+		return response, outcome, err
+	}
+}
+
+// fetch sends the request, conditionally if there is a stale entry, and stores the result.
+func (c *responseCache) fetch(ctx context.Context, key string, stale *cacheEntry, fetch fetchFunc) (*upstreamResponse, cacheOutcome, error) {
+	var conditional http.Header
+	if stale != nil {
+		conditional = validators(stale.response.Header)
+	}
+	response, err := fetch(ctx, conditional)
+	if err != nil {
+		return nil, cacheOutcome{}, err
+	}
+
+	if stale != nil && response.StatusCode == http.StatusNotModified {
+		// Keep the stored body, but take the new freshness information.
+		refreshed := *stale.response
+		refreshed.Header = stale.response.Header.Clone()
+		for _, name := range []string{"Cache-Control", "Expires", "Date", "Etag", "Last-Modified"} {
+			if values := response.Header.Values(name); len(values) > 0 {
+				refreshed.Header[name] = values
+			}
+		}
+		refreshed.Attempts = response.Attempts
+		c.store(key, &refreshed)
+		return &refreshed, cacheOutcome{status: cacheRevalidated}, nil
+	}
+	if response.StatusCode == http.StatusOK {
+		c.store(key, response)
+	}
+	return response, cacheOutcome{status: cacheMiss}, nil
+}
+
+// store adds or replaces the entry of the key unless the upstream forbids
+// storing it, evicting the least recently used entries beyond maxEntries.
+// Responses that are stale immediately are only kept if they can be revalidated.
+func (c *responseCache) store(key string, response *upstreamResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	lifetime, storable := c.lifetime(response.Header, now)
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	if !storable || (lifetime <= 0 && validators(response.Header) == nil) {
+		return
+	}
+
+	entry := &cacheEntry{key: key, response: response, stored: now, expires: now.Add(lifetime)}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *responseCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// lifetime returns how long a response stays fresh: the configured TTL,
+// shortened by the upstream's Cache-Control max-age or Expires header.
+// no-store responses are not storable and no-cache responses must be
+// revalidated before every use.
+func (c *responseCache) lifetime(header http.Header, now time.Time) (time.Duration, bool) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return 0, true
+	}
+
+	lifetime := c.ttl
+	maxAge, hasMaxAge := directives["s-maxage"]
+	if !hasMaxAge {
+		maxAge, hasMaxAge = directives["max-age"]
+	}
+	if hasMaxAge {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return 0, true
+		}
+		upstream := time.Duration(seconds) * time.Second
+		if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+			upstream -= time.Duration(age) * time.Second
+		}
+		if upstream < lifetime {
+			lifetime = upstream
+		}
+	} else if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires value means "already expired".
+			return 0, true
+		}
+		date := now
+		if sent, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = sent
+		}
+		if upstream := at.Sub(date); upstream < lifetime {
+			lifetime = upstream
+		}
+	}
+	return lifetime, true
+}
+
+// parseCacheControl returns the lower-cased directives of a Cache-Control header and their values.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// validators returns the conditional request headers for a stored response,
+// or nil if it has neither an ETag nor a Last-Modified header.
+func validators(header http.Header) http.Header {
+	conditional := make(http.Header)
+	if etag := header.Get("ETag"); etag != "" {
+		conditional.Set("If-None-Match", etag)
+	}
+	if modified := header.Get("Last-Modified"); modified != "" {
+		conditional.Set("If-Modified-Since", modified)
+	}
+	if len(conditional) == 0 {
+		return nil
+	}
+	return conditional
+}
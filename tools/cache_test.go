@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUpstream returns a fetch function answering with the given responses in
+// turn, recording the conditional headers it was called with.
+func fakeUpstream(responses ...*upstreamResponse) (fetchFunc, *[]http.Header) {
+	var seen []http.Header
+	return func(ctx context.Context, conditional http.Header) (*upstreamResponse, error) {
+		seen = append(seen, conditional)
+		response := responses[0]
+		responses = responses[1:]
+		return response, nil
+	}, &seen
+}
+
+func okResponse(body string, header ...string) *upstreamResponse {
+	response := &upstreamResponse{StatusCode: http.StatusOK, Header: make(http.Header), Body: []byte(body)}
+	for i := 0; i+1 < len(header); i += 2 {
+		response.Header.Set(header[i], header[i+1])
+	}
+	return response
+}
+
+func TestResponseCacheFreshness(t *testing.T) {
+	now := time.Unix(1000, 0)
+	newCache := func(config hyancieMCP.CacheConfig) *responseCache {
+		cache, err := newResponseCache(&config)
+		require.NoError(t, err)
+		cache.now = func() time.Time { return now }
+		return cache
+	}
+	ctx := context.Background()
+
+	t.Run("ttl", func(t *testing.T) {
+		cache := newCache(hyancieMCP.CacheConfig{TTL: "10s"})
+		fetch, seen := fakeUpstream(okResponse("a"), okResponse("b"))
+
+		response, outcome, err := cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(response.Body))
+		assert.Equal(t, cacheMiss, outcome.status)
+
+		now = now.Add(9 * time.Second)
+		response, outcome, err = cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "a", string(response.Body))
+		assert.Equal(t, cacheOutcome{status: cacheHit, age: 9 * time.Second}, outcome)
+
+		now = now.Add(time.Second)
+		response, outcome, err = cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "b", string(response.Body))
+		assert.Equal(t, cacheMiss, outcome.status)
+		assert.Equal(t, []http.Header{nil, nil}, *seen)
+	})
+
+	t.Run("cache-control", func(t *testing.T) {
+		cache := newCache(hyancieMCP.CacheConfig{TTL: "1h"})
+		fetch, _ := fakeUpstream(
+			okResponse("short", "Cache-Control", "public, max-age=5"),
+			okResponse("secret", "Cache-Control", "no-store"),
+			okResponse("again"),
+		)
+
+		_, _, err := cache.do(ctx, "max-age", fetch)
+		require.NoError(t, err)
+		now = now.Add(6 * time.Second)
+		response, _, err := cache.do(ctx, "max-age", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(response.Body))
+		response, outcome, err := cache.do(ctx, "max-age", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "again", string(response.Body))
+		assert.Equal(t, cacheMiss, outcome.status)
+	})
+
+	t.Run("etag revalidation", func(t *testing.T) {
+		cache := newCache(hyancieMCP.CacheConfig{TTL: "1m"})
+		notModified := &upstreamResponse{StatusCode: http.StatusNotModified, Header: http.Header{"Cache-Control": {"max-age=30"}}}
+		fetch, seen := fakeUpstream(
+			okResponse("v1", "ETag", `"v1"`, "Cache-Control", "no-cache"),
+			notModified,
+			okResponse("v2", "ETag", `"v2"`),
+		)
+
+		_, _, err := cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+
+		// no-cache: stored, but revalidated before use; 304 refreshes it for max-age.
+		response, outcome, err := cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(response.Body))
+		assert.Equal(t, cacheRevalidated, outcome.status)
+		response, outcome, err = cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "v1", string(response.Body))
+		assert.Equal(t, cacheHit, outcome.status)
+
+		now = now.Add(31 * time.Second)
+		response, outcome, err = cache.do(ctx, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "v2", string(response.Body))
+		assert.Equal(t, cacheMiss, outcome.status)
+		assert.Equal(t, []http.Header{nil, {"If-None-Match": {`"v1"`}}, {"If-None-Match": {`"v1"`}}}, *seen)
+	})
+
+	t.Run("lru eviction", func(t *testing.T) {
+		cache := newCache(hyancieMCP.CacheConfig{MaxEntries: 2})
+		fetch, seen := fakeUpstream(okResponse("a"), okResponse("b"), okResponse("c"), okResponse("b2"))
+		for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+			_, _, err := cache.do(ctx, key, fetch)
+			require.NoError(t, err)
+		}
+		// "c" evicted "b", as "a" had been used more recently.
+		assert.Len(t, *seen, 4)
+		assert.Equal(t, 2, cache.order.Len())
+	})
+}
+
+func TestResponseCacheCoalescing(t *testing.T) {
+	cache, err := newResponseCache(&hyancieMCP.CacheConfig{})
+	require.NoError(t, err)
+
+	var calls int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, conditional http.Header) (*upstreamResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return okResponse("shared"), nil
+	}
+
+	var wg sync.WaitGroup
+	outcomes := make([]cacheOutcome, 5)
+	for i := range outcomes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, outcome, err := cache.do(context.Background(), "k", fetch)
+			assert.NoError(t, err)
+			assert.Equal(t, "shared", string(response.Body))
+			outcomes[i] = outcome
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	misses := 0
+	for _, outcome := range outcomes {
+		if outcome.status == cacheMiss {
+			misses++
+		} else {
+			assert.Contains(t, []string{cacheCoalesced, cacheHit}, outcome.status)
+		}
+	}
+	assert.Equal(t, 1, misses)
+}
+
+func TestResponseCacheCoalescingCanceled(t *testing.T) {
+	cache, err := newResponseCache(&hyancieMCP.CacheConfig{})
+	require.NoError(t, err)
+
+	var calls int32
+	started := make(chan struct{})
+	fetch := func(ctx context.Context, conditional http.Header) (*upstreamResponse, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return okResponse("retried"), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, _, err := cache.do(ctx, "k", fetch)
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan *upstreamResponse)
+	go func() {
+		response, outcome, err := cache.do(context.Background(), "k", fetch)
+		assert.NoError(t, err)
+		assert.Equal(t, cacheMiss, outcome.status)
+		waiter <- response
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	// The waiter does not fail with the leader's error, but sends the request itself.
+	assert.ErrorIs(t, <-leader, context.Canceled)
+	response := <-waiter
+	require.NotNil(t, response)
+	assert.Equal(t, "retried", string(response.Body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestGenericToolResponseCache(t *testing.T) {
+	var calls int32
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"city": %q, "call": %d}`, r.URL.Query().Get("city"), n)
+	}))
+	defer mockAPIServer.Close()
+
+	handler := newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName: "weather",
+		Request:  hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/weather"},
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{
+			"city":   map[string]interface{}{"type": "string"},
+			"locale": map[string]interface{}{"type": "string", "in": "header", "wire_name": "Accept-Language"},
+		}},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "call", Description: "Call", Type: "primitive"}},
+		Cache:         &hyancieMCP.CacheConfig{TTL: "1m", KeyHeaders: []string{"accept-language"}},
+	})
+
+	call := func(args map[string]interface{}) *mcp.CallToolResult {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := handler(context.Background(), request)
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call(map[string]interface{}{"city": "Beijing", "locale": "zh"})
+	assert.Equal(t, "Call:1", joinContents(result.Content))
+	assert.Equal(t, map[string]interface{}{"status": "miss", "hit": false}, result.Meta["cache"])
+
+	result = call(map[string]interface{}{"city": "Beijing", "locale": "zh"})
+	assert.Equal(t, "Call:1", joinContents(result.Content))
+	assert.Equal(t, map[string]interface{}{"status": "hit", "hit": true, "ageSeconds": 0}, result.Meta["cache"])
+
+	// Other arguments and other key headers are cached separately.
+	assert.Equal(t, "Call:2", joinContents(call(map[string]interface{}{"city": "Shanghai", "locale": "zh"}).Content))
+	assert.Equal(t, "Call:3", joinContents(call(map[string]interface{}{"city": "Beijing", "locale": "en"}).Content))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestGenericToolResponseCacheSkipsPost(t *testing.T) {
+	var calls int32
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"call": %d}`, n)
+	}))
+	defer mockAPIServer.Close()
+
+	handler := newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName:      "create_order",
+		Request:       hyancieMCP.RequestConfig{Method: "POST", URL: mockAPIServer.URL + "/orders"},
+		InputSchema:   mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "call", Description: "Call", Type: "primitive"}},
+		Cache:         &hyancieMCP.CacheConfig{TTL: "1m"},
+	})
+
+	// Every identical POST call reaches the upstream.
+	for i := 1; i <= 2; i++ {
+		result, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("Call:%d", i), joinContents(result.Content))
+		assert.Nil(t, result.Meta["cache"])
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
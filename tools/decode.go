@@ -0,0 +1,327 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	hyancie "github.com/liu599/hyancie"
+	"gopkg.in/yaml.v3"
+)
+
+// responseDecoder turns upstream response bodies into the generic tree of
+// maps, slices and scalars that output mappings, templates and pagination
+// read, whatever the format of the body. Binary bodies such as images are
+// not decoded but returned as they are, see binaryType.
+type responseDecoder struct {
+	format        string // Overrides the detected format
+	arrayElements map[string]bool
+	delimiter     rune
+	columns       []string
+	selectors     map[string]cssSelector
+	maxBytes      int64  // Limit of binary responses and fetched images
+	imageURLKey   string // json_key of an image URL to fetch
+}
+
+// newResponseDecoder compiles the response settings of a tool.
+func newResponseDecoder(config *hyancie.ResponseConfig) (*responseDecoder, error) {
+	d := &responseDecoder{maxBytes: defaultMaxBinaryBytes}
+	if config == nil {
+		return d, nil
+	}
+	d.format = config.Format
+	d.columns = config.Columns
+	d.imageURLKey = config.ImageURL
+	if config.MaxBytes > 0 {
+		d.maxBytes = config.MaxBytes
+	}
+	if config.Delimiter != "" {
+		d.delimiter, _ = utf8.DecodeRuneInString(config.Delimiter)
+	}
+	if len(config.ArrayElements) > 0 {
+		d.arrayElements = tagSet(config.ArrayElements...)
+	}
+	if len(config.Selectors) > 0 {
+		d.selectors = make(map[string]cssSelector, len(config.Selectors))
+		names := make([]string, 0, len(config.Selectors))
+		for name := range config.Selectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			selector, err := compileSelector(config.Selectors[name])
+			if err != nil {
+				return nil, fmt.Errorf("response.selectors[%q]: %w", name, err)
+			}
+			d.selectors[name] = selector
+		}
+	}
+	return d, nil
+}
+
+// detectFormat returns the response format of a Content-Type, or "" if the
+// type is unknown and the body should be tried as JSON.
+func detectFormat(contentType string) string {
+	mediaType := parseMediaType(contentType)
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return "html"
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		return "xml"
+	case mediaType == "text/csv", mediaType == "application/csv", mediaType == "text/tab-separated-values":
+		return "csv"
+	case mediaType == "application/yaml", mediaType == "application/x-yaml", mediaType == "text/yaml", mediaType == "text/x-yaml":
+		return "yaml"
+	}
+	return ""
+}
+
+// decode decodes a response body. Besides the data, it returns the text of
+// the result when no output mapping selects anything from the data: the
+// readable text of HTML pages, and the body itself for the other formats
+// unless it is a JSON or YAML object.
+func (d *responseDecoder) decode(header http.Header, body []byte) (interface{}, string, error) {
+	format := d.format
+	if format == "" {
+		format = detectFormat(header.Get("Content-Type"))
+	}
+	switch format {
+	case "xml":
+		data, err := decodeXML(body, d.arrayElements)
+		return data, string(body), err
+	case "csv":
+		delimiter := d.delimiter
+		if delimiter == 0 && strings.HasPrefix(header.Get("Content-Type"), "text/tab-separated-values") {
+			delimiter = '\t'
+		}
+		data, err := decodeCSV(body, delimiter, d.columns)
+		return data, string(body), err
+	case "yaml":
+		data, err := decodeYAML(body)
+		return data, objectFallback(data, body), err
+	case "html":
+		data, text := d.decodeHTML(body)
+		return data, text, nil
+	case "text":
+		return string(body), string(body), nil
+	}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, string(body), err
+	}
+	return data, objectFallback(data, body), nil
+}
+
+// objectFallback returns the body as the fallback text of data that is not an object.
+func objectFallback(data interface{}, body []byte) string {
+	if _, isObject := data.(map[string]interface{}); isObject {
+		return ""
+	}
+	return string(body)
+}
+
+// xmlElement is an element collected while decoding XML.
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlElement
+	text     strings.Builder
+}
+
+// decodeXML converts an XML document to {root: value}. An element with
+// neither attributes nor child elements becomes its text; other elements
+// become objects with "@name" keys for attributes, "#text" for their text and
+// a key per child element name. Child elements that occur more than once, or
+// are listed in arrayElements, become arrays. Namespace prefixes are dropped.
+func decodeXML(body []byte, arrayElements map[string]bool) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Only UTF-8 and ASCII compatible documents are supported.
+		return input, nil
+	}
+
+	var root *xmlElement
+	var open []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			element := &xmlElement{name: token.Name.Local, attrs: token.Attr}
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.children = append(parent.children, element)
+			} else if root == nil {
+				root = element
+			}
+			open = append(open, element)
+		case xml.EndElement:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case xml.CharData:
+			if len(open) > 0 {
+				open[len(open)-1].text.Write(token)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("invalid XML: no root element")
+	}
+	return map[string]interface{}{root.name: root.value(arrayElements)}, nil
+}
+
+func (e *xmlElement) value(arrayElements map[string]bool) interface{} {
+	text := strings.TrimSpace(e.text.String())
+	if len(e.attrs) == 0 && len(e.children) == 0 {
+		return text
+	}
+	object := make(map[string]interface{})
+	for _, attr := range e.attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		object["@"+attr.Name.Local] = attr.Value
+	}
+	counts := make(map[string]int)
+	for _, child := range e.children {
+		counts[child.name]++
+	}
+	for _, child := range e.children {
+		value := child.value(arrayElements)
+		if counts[child.name] > 1 || arrayElements[child.name] {
+			list, _ := object[child.name].([]interface{})
+			object[child.name] = append(list, value)
+		} else {
+			object[child.name] = value
+		}
+	}
+	if text != "" {
+		object["#text"] = text
+	}
+	return object
+}
+
+// decodeCSV converts CSV records to an array of objects, keyed by the names
+// in columns or else in the header row. Missing fields are left out, and
+// fields beyond the named columns are ignored.
+func decodeCSV(body []byte, delimiter rune, columns []string) (interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(body, []byte("\ufeff"))))
+	if delimiter != 0 {
+		reader.Comma = delimiter
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(columns) == 0 && len(records) > 0 {
+		columns, records = records[0], records[1:]
+	}
+	rows := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeYAML decodes the first YAML document to the types encoding/json
+// produces: numbers become float64, keys strings and timestamps RFC 3339 strings.
+func decodeYAML(body []byte) (interface{}, error) {
+	var data interface{}
+	if err := yaml.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	return normalizeYAML(data), nil
+}
+
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprintf("%v", key)] = normalizeYAML(item)
+		}
+		return object
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// decodeHTML converts an HTML page to an object with its "title", the
+// readable "text" of its body and, for each selector, the matching elements
+// as objects with their "tag", readable "text" and "attrs".
+func (d *responseDecoder) decodeHTML(body []byte) (interface{}, string) {
+	doc := parseHTML(string(body))
+	page := make(map[string]interface{})
+	if title := doc.find("title"); title != nil {
+		page["title"] = readableText(title)
+	} else {
+		page["title"] = ""
+	}
+	content := doc.find("body")
+	if content == nil {
+		content = doc
+	}
+	text := readableText(content)
+	page["text"] = text
+
+	for name, selector := range d.selectors {
+		matches := selector.selectAll(doc)
+		elements := make([]interface{}, len(matches))
+		for i, element := range matches {
+			attrs := make(map[string]interface{}, len(element.attrs))
+			for attr, value := range element.attrs {
+				attrs[attr] = value
+			}
+			elements[i] = map[string]interface{}{
+				"tag":   element.tag,
+				"text":  readableText(element),
+				"attrs": attrs,
+			}
+		}
+		page[name] = elements
+	}
+	return page, text
+}
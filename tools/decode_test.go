@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectFormat(t *testing.T) {
+	for contentType, format := range map[string]string{
+		"application/json; charset=utf-8": "json",
+		"application/problem+json":        "json",
+		"text/html; charset=UTF-8":        "html",
+		"application/xhtml+xml":           "html",
+		"application/xml":                 "xml",
+		"application/atom+xml":            "xml",
+		"text/csv":                        "csv",
+		"text/tab-separated-values":       "csv",
+		"application/x-yaml":              "yaml",
+		"text/plain":                      "",
+		"":                                "",
+	} {
+		assert.Equal(t, format, detectFormat(contentType), contentType)
+	}
+}
+
+func TestResponseDecoder(t *testing.T) {
+	decode := func(config *hyancieMCP.ResponseConfig, contentType, body string) (interface{}, string) {
+		decoder, err := newResponseDecoder(config)
+		require.NoError(t, err)
+		data, fallback, err := decoder.decode(http.Header{"Content-Type": {contentType}}, []byte(body))
+		require.NoError(t, err)
+		return data, fallback
+	}
+
+	data, fallback := decode(nil, "application/xml", `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:m="urn:m">
+  <title>News</title>
+  <entry id="1"><title>First</title><m:tag>a</m:tag><m:tag>b</m:tag></entry>
+  <entry id="2"><title>Second</title><link href="/2">more</link></entry>
+  <empty/>
+</feed>`)
+	assert.Equal(t, map[string]interface{}{"feed": map[string]interface{}{
+		"title": "News",
+		"entry": []interface{}{
+			map[string]interface{}{"@id": "1", "title": "First", "tag": []interface{}{"a", "b"}},
+			map[string]interface{}{"@id": "2", "title": "Second", "link": map[string]interface{}{"@href": "/2", "#text": "more"}},
+		},
+		"empty": "",
+	}}, data)
+	assert.Contains(t, fallback, "<feed")
+
+	// array_elements makes single elements arrays, too.
+	data, _ = decode(&hyancieMCP.ResponseConfig{ArrayElements: []string{"item"}}, "text/xml", `<list><item>only</item></list>`)
+	assert.Equal(t, map[string]interface{}{"list": map[string]interface{}{"item": []interface{}{"only"}}}, data)
+
+	data, _ = decode(nil, "text/csv", "\ufeffname,stars\nalpha,10\n\"beta, gamma\",2\n")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "alpha", "stars": "10"},
+		map[string]interface{}{"name": "beta, gamma", "stars": "2"},
+	}, data)
+	data, _ = decode(&hyancieMCP.ResponseConfig{Format: "csv", Delimiter: ";", Columns: []string{"name", "stars"}}, "text/plain", "alpha;10\nbeta\n")
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "alpha", "stars": "10"},
+		map[string]interface{}{"name": "beta"},
+	}, data)
+	data, _ = decode(nil, "text/tab-separated-values", "name\tstars\nalpha\t10\n")
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "alpha", "stars": "10"}}, data)
+
+	data, fallback = decode(nil, "application/yaml", "name: hyancie\nstars: 42\nratio: 0.5\nreleased: 2024-05-01T10:00:00Z\ntags: [mcp, go]\n1: one\n")
+	assert.Equal(t, map[string]interface{}{
+		"name": "hyancie", "stars": float64(42), "ratio": 0.5, "released": "2024-05-01T10:00:00Z",
+		"tags": []interface{}{"mcp", "go"}, "1": "one",
+	}, data)
+	assert.Empty(t, fallback)
+
+	data, fallback = decode(&hyancieMCP.ResponseConfig{Selectors: map[string]string{"links": "li > a"}}, "text/html", testPage)
+	page := data.(map[string]interface{})
+	assert.Equal(t, "Search & results", page["title"])
+	assert.Equal(t, readableText(parseHTML(testPage).find("body")), page["text"])
+	assert.Equal(t, page["text"], fallback)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"tag": "a", "text": "Alpha", "attrs": map[string]interface{}{"href": "/a", "data-rank": "1"}},
+		map[string]interface{}{"tag": "a", "text": "Beta", "attrs": map[string]interface{}{"href": "/b", "data-rank": "2"}},
+	}, page["links"])
+
+	// A format override wins over the Content-Type.
+	data, fallback = decode(&hyancieMCP.ResponseConfig{Format: "text"}, "application/json", `{"a": 1}`)
+	assert.Equal(t, `{"a": 1}`, data)
+	assert.Equal(t, `{"a": 1}`, fallback)
+
+	_, err := newResponseDecoder(&hyancieMCP.ResponseConfig{Selectors: map[string]string{"links": "a["}})
+	assert.ErrorContains(t, err, `response.selectors["links"]: invalid selector "a["`)
+}
+
+func TestGenericToolResponseFormats(t *testing.T) {
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/xml":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<weather><city>Hangzhou</city><day><name>Tue</name><high>18</high></day><day><name>Wed</name><high>21</high></day></weather>`)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, testPage)
+		case "/broken":
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<weather><city>`)
+		}
+	}))
+	defer mockAPIServer.Close()
+
+	call := func(config hyancieMCP.GenericToolConfig) string {
+		config.InputSchema = mcp.ToolInputSchema{Type: "object"}
+		result, err := newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		return joinContents(result.Content)
+	}
+
+	// output_mapping reads XML like JSON.
+	assert.Equal(t, "城市:Hangzhou|天气:[项1:{日期:Tue, 最高:18} | 项2:{日期:Wed, 最高:21}]", call(hyancieMCP.GenericToolConfig{
+		ToolName: "xml_weather",
+		Request:  hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/xml"},
+		OutputMapping: []hyancieMCP.OutputMap{
+			{JsonKey: "weather.city", Description: "城市", Type: "primitive"},
+			{JsonKey: "weather.day", Description: "天气", Type: "array", Items: []hyancieMCP.OutputMap{
+				{JsonKey: "name", Description: "日期", Type: "primitive"},
+				{JsonKey: "high", Description: "最高", Type: "primitive"},
+			}},
+		},
+	}))
+
+	// HTML without mappings is returned as readable text.
+	text := call(hyancieMCP.GenericToolConfig{
+		ToolName: "html_page",
+		Request:  hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/html"},
+	})
+	assert.Contains(t, text, "- Alpha\n- Beta logo")
+	assert.NotContains(t, text, "<")
+
+	assert.Equal(t, "标题:Search & results|链接:[项1:{名称:Alpha, 地址:/a} | 项2:{名称:Beta, 地址:/b}]", call(hyancieMCP.GenericToolConfig{
+		ToolName: "html_links",
+		Request:  hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/html"},
+		Response: &hyancieMCP.ResponseConfig{Selectors: map[string]string{"links": "li.result a"}},
+		OutputMapping: []hyancieMCP.OutputMap{
+			{JsonKey: "title", Description: "标题", Type: "primitive"},
+			{JsonKey: "links", Description: "链接", Type: "array", Items: []hyancieMCP.OutputMap{
+				{JsonKey: "text", Description: "名称", Type: "primitive"},
+				{JsonKey: "attrs.href", Description: "地址", Type: "primitive"},
+			}},
+		},
+	}))
+
+	// Bodies that cannot be decoded are returned as they are.
+	assert.Equal(t, "<weather><city>", call(hyancieMCP.GenericToolConfig{
+		ToolName:      "broken",
+		Request:       hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/broken"},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "weather.city", Description: "城市", Type: "primitive"}},
+	}))
+}
@@ -0,0 +1,237 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+// Request body content types supported by request.content_type.
+const (
+	contentTypeJSON      = "application/json"
+	contentTypeForm      = "application/x-www-form-urlencoded"
+	contentTypeMultipart = "multipart/form-data"
+)
+
+// bodyEncoder serializes the body arguments according to request.content_type.
+type bodyEncoder struct {
+	contentType string
+	files       []filePart
+}
+
+// filePart is a multipart file field resolved to the body (wire) names of its arguments.
+type filePart struct {
+	field        string // Body field holding the base64 content
+	partName     string // Multipart field name
+	fileName     string
+	fileNameFrom string // Body field holding the file name, if any
+	contentType  string
+}
+
+// newBodyEncoder validates the configured content type and resolves file
+// parts to the wire names of their arguments.
+func newBodyEncoder(request hyancie.RequestConfig, placements map[string]placement) (*bodyEncoder, error) {
+	contentType := request.ContentType
+	if contentType == "" {
+		contentType = contentTypeJSON
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request.content_type %q: %w", contentType, err)
+	}
+	switch mediaType {
+	case contentTypeJSON, contentTypeForm, contentTypeMultipart:
+	default:
+		if !strings.HasSuffix(mediaType, "+json") {
+			return nil, fmt.Errorf("unsupported request.content_type %q", contentType)
+		}
+	}
+	if len(request.Files) > 0 && mediaType != contentTypeMultipart {
+		return nil, fmt.Errorf("request.files requires content_type %q", contentTypeMultipart)
+	}
+
+	wireName := func(argument string) string {
+		if p, ok := placements[argument]; ok {
+			return p.WireName
+		}
+		return argument
+	}
+
+	encoder := &bodyEncoder{contentType: contentType}
+	for _, file := range request.Files {
+		if file.Argument == "" {
+			return nil, fmt.Errorf("request.files: argument is required")
+		}
+		part := filePart{
+			field:       wireName(file.Argument),
+			partName:    file.FieldName,
+			fileName:    file.FileName,
+			contentType: file.ContentType,
+		}
+		if part.partName == "" {
+			part.partName = part.field
+		}
+		if part.fileName == "" {
+			part.fileName = part.partName
+		}
+		if file.FileNameArgument != "" {
+			part.fileNameFrom = wireName(file.FileNameArgument)
+		}
+		encoder.files = append(encoder.files, part)
+	}
+	return encoder, nil
+}
+
+// Encode serializes the body fields and returns the payload and the
+// Content-Type header to send with it.
+func (e *bodyEncoder) Encode(body map[string]interface{}) ([]byte, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(e.contentType)
+	switch mediaType {
+	case contentTypeForm:
+		return []byte(formValues(body).Encode()), e.contentType, nil
+	case contentTypeMultipart:
+		return e.encodeMultipart(body)
+	default:
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		return payload, e.contentType, nil
+	}
+}
+
+// encodeMultipart writes file parts from base64 arguments and every other body field as a form field.
+func (e *bodyEncoder) encodeMultipart(body map[string]interface{}) ([]byte, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	consumed := make(map[string]bool)
+	for _, file := range e.files {
+		consumed[file.field] = true
+		if file.fileNameFrom != "" {
+			consumed[file.fileNameFrom] = true
+		}
+
+		value, ok := body[file.field]
+		if !ok {
+			continue
+		}
+		encoded, ok := value.(string)
+		if !ok {
+			return nil, "", fmt.Errorf("file argument %q must be a base64 string", file.field)
+		}
+		content, dataURLType, err := decodeBase64File(encoded)
+		if err != nil {
+			return nil, "", fmt.Errorf("file argument %q: %w", file.field, err)
+		}
+
+		fileName := file.fileName
+		if name, ok := body[file.fileNameFrom].(string); ok && name != "" {
+			fileName = name
+		}
+		contentType := file.contentType
+		if contentType == "" {
+			contentType = dataURLType
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+			"name":     file.partName,
+			"filename": fileName,
+		}))
+		header.Set("Content-Type", contentType)
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create multipart file part: %w", err)
+		}
+		if _, err := partWriter.Write(content); err != nil {
+			return nil, "", fmt.Errorf("failed to write multipart file part: %w", err)
+		}
+	}
+
+	fields := make(map[string]interface{}, len(body))
+	for k, v := range body {
+		if !consumed[k] {
+			fields[k] = v
+		}
+	}
+	values := formValues(fields)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range values[k] {
+			if err := writer.WriteField(k, v); err != nil {
+				return nil, "", fmt.Errorf("failed to write multipart field: %w", err)
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to finish multipart body: %w", err)
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// formValues flattens body fields into form values. Arrays become repeated
+// keys and objects are sent as JSON.
+func formValues(body map[string]interface{}) url.Values {
+	values := make(url.Values)
+	for k, v := range body {
+		switch typed := v.(type) {
+		case []interface{}:
+			for _, item := range typed {
+				values.Add(k, formatFormValue(item))
+			}
+		default:
+			values.Set(k, formatFormValue(typed))
+		}
+	}
+	return values
+}
+
+func formatFormValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		out, err := json.Marshal(value)
+		if err == nil {
+			return string(out)
+		}
+	}
+	return formatParam(value)
+}
+
+// decodeBase64File decodes a file argument given as plain base64 or as a
+// data URL ("data:image/png;base64,..."), returning the data URL media type.
+func decodeBase64File(encoded string) ([]byte, string, error) {
+	var mediaType string
+	if rest, ok := strings.CutPrefix(encoded, "data:"); ok {
+		meta, data, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, "", fmt.Errorf("only base64 data URLs are supported")
+		}
+		mediaType = strings.TrimSuffix(meta, ";base64")
+		encoded = data
+	}
+	encoded = strings.TrimSpace(encoded)
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if content, err := encoding.DecodeString(encoded); err == nil {
+			return content, mediaType, nil
+		}
+	}
+	return nil, "", fmt.Errorf("invalid base64 content")
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyEncoderForm(t *testing.T) {
+	encoder, err := newBodyEncoder(hyancieMCP.RequestConfig{ContentType: contentTypeForm}, nil)
+	require.NoError(t, err)
+
+	payload, contentType, err := encoder.Encode(map[string]interface{}{
+		"name":  "Alice Smith",
+		"age":   float64(30),
+		"tags":  []interface{}{"a", "b"},
+		"extra": map[string]interface{}{"k": "v"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, contentTypeForm, contentType)
+	assert.Equal(t, "age=30&extra=%7B%22k%22%3A%22v%22%7D&name=Alice+Smith&tags=a&tags=b", string(payload))
+}
+
+func TestBodyEncoderValidation(t *testing.T) {
+	_, err := newBodyEncoder(hyancieMCP.RequestConfig{ContentType: "text/xml"}, nil)
+	require.Error(t, err)
+
+	_, err = newBodyEncoder(hyancieMCP.RequestConfig{Files: []hyancieMCP.FilePart{{Argument: "file"}}}, nil)
+	require.Error(t, err)
+
+	encoder, err := newBodyEncoder(hyancieMCP.RequestConfig{ContentType: "application/vnd.api+json"}, nil)
+	require.NoError(t, err)
+	payload, contentType, err := encoder.Encode(map[string]interface{}{"a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "application/vnd.api+json", contentType)
+	assert.Equal(t, `{"a":1}`, string(payload))
+}
+
+func TestGenericToolMultipartUpload(t *testing.T) {
+	type upload struct {
+		fieldName, fileName, contentType, content string
+	}
+	var files []upload
+	var fields map[string][]string
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		fields = r.MultipartForm.Value
+		files = nil
+		for fieldName, headers := range r.MultipartForm.File {
+			for _, header := range headers {
+				f, _ := header.Open()
+				content, _ := io.ReadAll(f)
+				f.Close()
+				files = append(files, upload{fieldName, header.Filename, header.Header.Get("Content-Type"), string(content)})
+			}
+		}
+		w.Write([]byte(`{"status": "uploaded"}`))
+	}))
+	defer mockAPIServer.Close()
+
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{{
+		ToolName:    "upload_avatar",
+		Description: "Upload an avatar",
+		Request: hyancieMCP.RequestConfig{
+			Method:      "POST",
+			URL:         mockAPIServer.URL + "/users/{id}/avatar",
+			ContentType: contentTypeMultipart,
+			Files: []hyancieMCP.FilePart{
+				{Argument: "image", FieldName: "avatar", FileName: "avatar.bin", FileNameArgument: "image_name"},
+			},
+		},
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"id":         map[string]interface{}{"type": "string"},
+				"image":      map[string]interface{}{"type": "string", "description": "Base64 image"},
+				"image_name": map[string]interface{}{"type": "string"},
+				"caption":    map[string]interface{}{"type": "string"},
+			},
+		},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "status", Description: "Status", Type: "primitive"}},
+	}}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	handler := getToolHandler(s, "upload_avatar")
+	require.NotNil(t, handler)
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{
+		"id":         "42",
+		"image":      "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("PNGDATA")),
+		"image_name": "me.png",
+		"caption":    "hello",
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, "Status:uploaded", joinContents(result.Content))
+	assert.Equal(t, []upload{{"avatar", "me.png", "image/png", "PNGDATA"}}, files)
+	assert.Equal(t, map[string][]string{"caption": {"hello"}}, fields)
+}
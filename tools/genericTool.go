@@ -1,13 +1,10 @@
 package tools
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 
 	hyancie "github.com/liu599/hyancie"
@@ -16,202 +13,335 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
-// expandURL replaces placeholders in a URL template with values from a map and adds the rest as query parameters.
-func expandURL(templateURL string, params map[string]interface{}) (string, error) {
-	// Create a replacer for placeholders in the URL.
-	var replacerArgs []string
-	// Keep track of params that are not part of the URL template.
-	remainingParams := make(map[string]interface{})
-	for k, v := range params {
-		placeholder := "{" + k + "}"
-		if strings.Contains(templateURL, placeholder) {
-			replacerArgs = append(replacerArgs, placeholder, url.PathEscape(fmt.Sprintf("%v", v)))
-		} else {
-			remainingParams[k] = v
-		}
+// AddGenericTools registers all tools defined in the global config with the MCP server.
+func AddGenericTools(s *server.MCPServer) error {
+	for _, config := range hyancie.Config.McpTools {
+		s.AddTools(newGenericTool(hyancie.Config, config))
 	}
-	replacer := strings.NewReplacer(replacerArgs...)
-	expandedURL := replacer.Replace(templateURL)
 
-	// Parse the URL after placeholder replacement.
-	u, err := url.Parse(expandedURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse URL after replacement: %w", err)
-	}
+	return nil
+}
 
-	// Add remaining params as query parameters.
-	q := u.Query()
-	for k, v := range remainingParams {
-		q.Set(k, fmt.Sprintf("%v", v))
+// newGenericTool builds the MCP tool definition and HTTP-backed handler for a
+// single tool config. Global settings such as timeouts are taken from global.
+func newGenericTool(global *hyancie.ConfigType, config hyancie.GenericToolConfig) server.ServerTool {
+	tool := mcp.Tool{
+		Name:        config.ToolName,
+		Description: config.Description,
+		InputSchema: advertisedSchema(config.InputSchema),
 	}
-	u.RawQuery = q.Encode()
 
-	return u.String(), nil
+	return server.ServerTool{Tool: tool, Handler: newGenericToolHandler(global, config)}
 }
 
-// AddGenericTools registers all tools defined in the global config with the MCP server.
-func AddGenericTools(s *server.MCPServer) error {
-	configs := hyancie.Config.McpTools
-
-	for _, config := range configs {
-		currentConfig := config
+// newGenericToolHandler returns the handler that calls the configured HTTP API.
+func newGenericToolHandler(global *hyancie.ConfigType, currentConfig hyancie.GenericToolConfig) server.ToolHandlerFunc {
+	validator, err := newSchemaValidator(currentConfig.InputSchema)
+	if err != nil {
+		logging.Logger.Error("Argument validation disabled", "tool_name", currentConfig.ToolName, "error", err)
+	}
+	placements, placementErr := parsePlacements(currentConfig.InputSchema)
+	body, bodyErr := newBodyTemplate(currentConfig.Request.BodyTemplate)
+	encoder, encoderErr := newBodyEncoder(currentConfig.Request, placements)
+	policy, policyErr := newRetryPolicy(global, currentConfig)
+	client, clientErr := clientForTool(global, currentConfig)
+	if clientErr != nil {
+		logging.Logger.Error("HTTP client unavailable", "tool_name", currentConfig.ToolName, "error", clientErr)
+	}
+	auth, authErr := authForTool(global, currentConfig, client)
+	if authErr != nil {
+		logging.Logger.Error("Upstream authentication unavailable", "tool_name", currentConfig.ToolName, "error", authErr)
+	}
+	cache, cacheErr := newResponseCache(currentConfig.Cache)
+	if cache != nil && !isCacheableMethod(currentConfig.Request.Method) {
+		logging.Logger.Warn("Response cache disabled, method is not GET or HEAD", "tool_name", currentConfig.ToolName, "method", currentConfig.Request.Method)
+		cache = nil
+	}
+	decoder, decoderErr := newResponseDecoder(currentConfig.Response)
+	if decoderErr != nil {
+		logging.Logger.Error("Invalid response settings", "tool_name", currentConfig.ToolName, "error", decoderErr)
+	} else if policyErr == nil {
+		policy.bodyLimit = decoder.bodyLimit
+	}
+	output, outputErr := newToolOutput(global, currentConfig)
+	if outputErr != nil {
+		logging.Logger.Error("Invalid output settings", "tool_name", currentConfig.ToolName, "error", outputErr)
+	}
+	paginator := newPaginator(currentConfig.Pagination, decoder)
+	flow, flowErr := newWorkflow(global, currentConfig, client, auth, decoder, output)
 
-		tool := mcp.Tool{
-			Name:        currentConfig.ToolName,
-			Description: currentConfig.Description,
-			InputSchema: currentConfig.InputSchema,
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args, ok := request.Params.Arguments.(map[string]interface{})
+		if !ok {
+			args = make(map[string]interface{})
 		}
 
-		handler := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			args, ok := request.Params.Arguments.(map[string]interface{})
-			if !ok {
-				args = make(map[string]interface{})
-			}
-
-			// Apply default values
-			if currentConfig.InputSchema.Properties != nil {
-				for propName, propDetailsInterface := range currentConfig.InputSchema.Properties {
-					if _, argProvided := args[propName]; !argProvided {
-						if propDetails, ok := propDetailsInterface.(map[string]interface{}); ok {
-							if defaultValue, defaultExists := propDetails["default"]; defaultExists {
-								args[propName] = defaultValue
-							}
+		// Apply default values
+		if currentConfig.InputSchema.Properties != nil {
+			for propName, propDetailsInterface := range currentConfig.InputSchema.Properties {
+				if _, argProvided := args[propName]; !argProvided {
+					if propDetails, ok := propDetailsInterface.(map[string]interface{}); ok {
+						if defaultValue, defaultExists := propDetails["default"]; defaultExists {
+							args[propName] = defaultValue
 						}
 					}
 				}
 			}
+		}
 
-			// Log incoming request
-			logging.Logger.Info("Tool called", "tool_name", currentConfig.ToolName, "arguments", args)
+		// Log incoming request
+		logging.Logger.Info("Tool called", "tool_name", currentConfig.ToolName, "arguments", args)
 
-			// Expand URL template
-			logging.Logger.Info("Expanding URL template", "url", currentConfig.Request.URL)
-			fmt.Println("Attempting to expand URL template:", currentConfig.Request.URL)
-			expandedURL, err := expandURL(currentConfig.Request.URL, args)
+		// Reject invalid arguments before calling the upstream API
+		if validator != nil {
+			if validationErrors := validator.Validate(args); len(validationErrors) > 0 {
+				logging.Logger.Info("Tool arguments rejected", "tool_name", currentConfig.ToolName, "errors", validationErrors)
+				return newValidationErrorResult(validationErrors), nil
+			}
+		}
+
+		if placementErr != nil {
+			return nil, fmt.Errorf("invalid parameter placement: %w", placementErr)
+		}
+		if bodyErr != nil {
+			return nil, bodyErr
+		}
+		if encoderErr != nil {
+			return nil, encoderErr
+		}
+		if policyErr != nil {
+			return nil, policyErr
+		}
+		if clientErr != nil {
+			return nil, fmt.Errorf("invalid http client configuration: %w", clientErr)
+		}
+		if authErr != nil {
+			return nil, fmt.Errorf("invalid auth configuration: %w", authErr)
+		}
+		if cacheErr != nil {
+			return nil, cacheErr
+		}
+		if decoderErr != nil {
+			return nil, decoderErr
+		}
+		if outputErr != nil {
+			return nil, outputErr
+		}
+		if flowErr != nil {
+			return nil, flowErr
+		}
+		if flow != nil {
+			return flow.run(ctx, args)
+		}
+
+		method := strings.ToUpper(currentConfig.Request.Method)
+
+		// Expand URL template and distribute arguments over the request
+		logging.Logger.Info("Expanding URL template", "url", currentConfig.Request.URL)
+		parts, err := placeArguments(currentConfig.Request.URL, method, placements, args)
+		if err != nil {
+			return nil, err
+		}
+		expandedURL := parts.URL
+
+		var payload []byte
+		var contentType string
+		if body != nil {
+			// The template replaces the default body built from the arguments
+			payload, err = body.Render(args)
 			if err != nil {
 				return nil, err
 			}
+			contentType = encoder.contentType
+		} else if parts.Body != nil {
+			payload, contentType, err = encoder.Encode(parts.Body)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-			var req *http.Request
-			method := strings.ToUpper(currentConfig.Request.Method)
+		// Argument headers first, so that configured headers (e.g. credentials) take precedence
+		headers := make(http.Header)
+		for name, value := range parts.Headers {
+			headers.Set(name, value)
+		}
+		cookies := &http.Request{Header: headers}
+		for _, cookie := range parts.Cookies {
+			cookies.AddCookie(cookie)
+		}
+		for _, header := range currentConfig.Headers {
+			headers.Set(header.Name, header.Value)
+		}
 
-			if method == "POST" || method == "PUT" {
-				jsonBody, err := json.Marshal(args)
-				if err != nil {
-					return nil, fmt.Errorf("failed to marshal request body: %w", err)
-				}
-				req, err = http.NewRequestWithContext(ctx, method, expandedURL, bytes.NewBuffer(jsonBody))
-				if err == nil {
-					req.Header.Set("Content-Type", "application/json")
-				}
-			} else {
-				req, err = http.NewRequestWithContext(ctx, method, expandedURL, nil)
+		configure := func(req *http.Request) error {
+			if payload != nil {
+				req.Header.Set("Content-Type", contentType)
 			}
-
-			if err != nil {
-				return nil, fmt.Errorf("failed to create http request: %w", err)
+			for name, values := range headers {
+				req.Header[name] = append([]string(nil), values...)
 			}
 
-			if currentConfig.Headers != nil {
-				for _, header := range currentConfig.Headers {
-					req.Header.Set(header.Name, header.Value)
-				}
+			// Credentials last, as signatures may cover the headers set above
+			if auth != nil {
+				return auth.Apply(req, payload)
 			}
+			return nil
+		}
 
-			client := &http.Client{}
-			// Log the request details just before sending
-			if req.Body != nil {
-				buf := new(bytes.Buffer)
-				buf.ReadFrom(req.Body)
-				bodyStr := buf.String()
-				// And now set a new body, since you can't read it twice.
-				req.Body = io.NopCloser(bytes.NewBuffer(buf.Bytes()))
-				logging.Logger.Info("Sending HTTP request", "method", req.Method, "url", req.URL.String(), "body", bodyStr)
-			} else {
-				logging.Logger.Info("Sending HTTP request", "method", req.Method, "url", req.URL.String())
+		// get requests a URL with the configured method, body and headers,
+		// through the cache if there is one. Further pages use it, too.
+		get := func(ctx context.Context, pageURL string) (*upstreamResponse, cacheOutcome, error) {
+			build := newBodyBuilder(method, pageURL, payload, configure)
+			fetch := func(ctx context.Context, conditional http.Header) (*upstreamResponse, error) {
+				build := build
+				if conditional != nil {
+					build = withHeaders(build, conditional)
+				}
+				return sendAuthenticated(ctx, currentConfig.ToolName, policy, client, auth, method, build)
 			}
-			resp, err := client.Do(req)
-			if err != nil {
-				logging.Logger.Error("HTTP request failed", "error", err)
-				return nil, fmt.Errorf("http request failed: %w", err)
+			if cache != nil {
+				return cache.do(ctx, cache.key(method, pageURL, headers, payload), fetch)
 			}
-			defer resp.Body.Close()
+			resp, err := fetch(ctx, nil)
+			return resp, cacheOutcome{}, err
+		}
 
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				logging.Logger.Error("Failed to read response body", "error", err)
-				return nil, fmt.Errorf("failed to read response body: %w", err)
-			}
+		// Log the request details just before sending
+		if payload != nil {
+			logging.Logger.Info("Sending HTTP request", "method", method, "url", expandedURL, "body", string(payload))
+		} else {
+			logging.Logger.Info("Sending HTTP request", "method", method, "url", expandedURL)
+		}
+		resp, cached, err := get(ctx, expandedURL)
+		if err != nil {
+			logging.Logger.Error("HTTP request failed", "error", err)
+			return nil, err
+		}
+		if cache != nil {
+			logging.Logger.Info("Response cache lookup", "tool_name", currentConfig.ToolName, "status", cached.status)
+		}
+		bodyBytes := resp.Body
 
-			// Log the response
-			logging.Logger.Info("Received HTTP response", "status_code", resp.StatusCode, "body", string(bodyBytes))
+		// Log the response
+		binaryType, isBinary := decoder.binaryType(resp.Header)
+		if isBinary {
+			logging.Logger.Info("Received HTTP response", "status_code", resp.StatusCode, "attempts", resp.Attempts, "content_type", binaryType, "bytes", len(bodyBytes))
+		} else {
+			logging.Logger.Info("Received HTTP response", "status_code", resp.StatusCode, "attempts", resp.Attempts, "body", string(bodyBytes))
+		}
 
-			if resp.StatusCode != http.StatusOK {
-				return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		if !isSuccess(resp.StatusCode) {
+			if isBinary {
+				return nil, fmt.Errorf("request failed with status %d: %d bytes of %s", resp.StatusCode, len(bodyBytes), binaryType)
 			}
+			return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		}
 
-			var responseData map[string]interface{}
-			if err := json.Unmarshal(bodyBytes, &responseData); err != nil {
-				// If unmarshaling fails, treat the body as a plain string.
-				// This handles cases where the API returns a non-JSON response, like a simple string.
-				results := []string{string(bodyBytes)}
-				result := &mcp.CallToolResult{
-					Content: []mcp.Content{
-						mcp.TextContent{
-							Type: "text",
-							Text: strings.Join(results, "|"),
-						},
-					},
-				}
-				return result, nil
+		// Images and other binary content are returned as they are, base64-encoded.
+		if isBinary {
+			result := &mcp.CallToolResult{
+				Content: []mcp.Content{binaryContent(expandedURL, binaryType, bodyBytes)},
 			}
-
-			results, err := processMappings(responseData, currentConfig.OutputMapping)
-			if err != nil {
-				return nil, fmt.Errorf("failed to process output mappings: %w", err)
+			result.Meta = map[string]interface{}{
+				"expandedURL": expandedURL,
+				"args":        args,
 			}
+			if cache != nil {
+				result.Meta["cache"] = cached.meta()
+			}
+			return result, nil
+		}
 
+		responseData, fallback, err := decoder.decode(resp.Header, bodyBytes)
+		if err != nil {
+			// If decoding fails, treat the body as a plain string.
+			// This handles cases where the API returns an unexpected format, like a simple string.
+			logging.Logger.Info("Returning undecoded response", "tool_name", currentConfig.ToolName, "error", err)
 			result := &mcp.CallToolResult{
 				Content: []mcp.Content{
 					mcp.TextContent{
 						Type: "text",
-						Text: strings.Join(results, "|"),
+						Text: string(bodyBytes),
 					},
 				},
 			}
-			result.Meta = map[string]interface{}{
-				"expandedURL":      expandedURL,
-				"args": args,
-			}
 			return result, nil
 		}
 
-		s.AddTool(tool, handler)
+		var pages pagination
+		if paginator != nil {
+			responseData, pages, err = paginator.collect(ctx, expandedURL, resp, responseData, func(ctx context.Context, pageURL string) (*upstreamResponse, error) {
+				resp, _, err := get(ctx, pageURL)
+				return resp, err
+			})
+			if err != nil {
+				logging.Logger.Error("Pagination failed", "tool_name", currentConfig.ToolName, "pages", pages.pages, "error", err)
+				return nil, err
+			}
+			logging.Logger.Info("Collected pages", "tool_name", currentConfig.ToolName, "pages", pages.pages, "items", pages.items, "complete", pages.complete)
+		}
+
+		text, structured, err := output.render(responseData, fallback)
+		if err != nil {
+			return nil, err
+		}
+		result := output.result(text, structured)
+		imageURL, err := decoder.imageURL(responseData, expandedURL)
+		if err != nil {
+			return nil, err
+		}
+		if imageURL != "" {
+			image, err := decoder.fetchImage(ctx, client, imageURL, policy.timeout)
+			if err != nil {
+				logging.Logger.Error("Image fetch failed", "tool_name", currentConfig.ToolName, "url", imageURL, "error", err)
+				return nil, err
+			}
+			result.Content = append(result.Content, image)
+			result.Meta["imageURL"] = imageURL
+		}
+		result.Meta["expandedURL"] = expandedURL
+		result.Meta["args"] = args
+		if cache != nil {
+			result.Meta["cache"] = cached.meta()
+		}
+		if paginator != nil {
+			result.Meta["pagination"] = pages.meta()
+		}
+		return result, nil
 	}
+}
 
-	return nil
+// sendAuthenticated sends a request with the retry policy. If the upstream
+// rejects the credentials and auth can renew them, it is sent once more.
+func sendAuthenticated(ctx context.Context, toolName string, policy *retryPolicy, client *http.Client, auth authenticator, method string, build requestBuilder) (*upstreamResponse, error) {
+	resp, err := policy.send(ctx, client, method, build)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// Renew rejected credentials and try once more
+		if renewable, ok := auth.(invalidator); ok && renewable.Invalidate(resp.Request) {
+			logging.Logger.Info("Upstream rejected credentials, retrying with fresh ones", "tool_name", toolName)
+			resp, err = policy.send(ctx, client, method, build)
+		}
+	}
+	return resp, err
 }
 
-// processMappings recursively processes data according to the mapping configuration.
-func processMappings(contextData interface{}, mappings []hyancie.OutputMap) ([]string, error) {
+// processMappings recursively processes data according to the mapping
+// configuration, formatting the values with style.
+func processMappings(contextData interface{}, mappings []hyancie.OutputMap, style *outputStyle) ([]string, error) {
 	var results []string
-	contextMap, isMap := contextData.(map[string]interface{})
 
 	for _, mapping := range mappings {
-		var value interface{}
-		var found bool
-
-		if isMap {
-			value, found = getValueFromNestedMap(contextMap, mapping.JsonKey)
+		value, found, err := mappedValue(contextData, mapping)
+		if err != nil {
+			return nil, err
 		}
-
 		if !found {
 			continue
 		}
 
 		switch mapping.Type {
 		case "primitive":
-			results = append(results, fmt.Sprintf("%s:%v", mapping.Description, value))
+			results = append(results, style.field(mapping.Description, style.value(value)))
 		case "array":
 			arrayValue, ok := value.([]interface{})
 			if !ok {
@@ -226,18 +356,76 @@ func processMappings(contextData interface{}, mappings []hyancie.OutputMap) ([]s
 			var allItemsFormatted []string
 			for i := 0; i < limit; i++ {
 				itemContext := arrayValue[i]
-				subResults, err := processMappings(itemContext, mapping.Items)
+				subResults, err := processMappings(itemContext, mapping.Items, style)
 				if err != nil {
 					return nil, err
 				}
-				allItemsFormatted = append(allItemsFormatted, fmt.Sprintf("项%d:{%s}", i+1, strings.Join(subResults, ", ")))
+				allItemsFormatted = append(allItemsFormatted, style.item(i+1, subResults))
+			}
+			results = append(results, style.array(mapping.Description, allItemsFormatted))
+		case "object":
+			subResults, err := processMappings(value, mapping.Items, style)
+			if err != nil {
+				return nil, err
 			}
-			results = append(results, fmt.Sprintf("%s:[%s]", mapping.Description, strings.Join(allItemsFormatted, " | ")))
+			results = append(results, style.field(mapping.Description, style.object(subResults)))
 		}
 	}
 	return results, nil
 }
 
+// mappedValue returns the value a mapping selects with its expr or, by default, its json_key.
+func mappedValue(data interface{}, mapping hyancie.OutputMap) (interface{}, bool, error) {
+	if mapping.Expr != "" {
+		return evaluateExpr(mapping.Expr, data)
+	}
+	value, found := getValue(data, mapping.JsonKey)
+	return value, found, nil
+}
+
+// isSuccess reports whether an upstream status code is a 2xx success, such
+// as 200 OK, 201 Created or 204 No Content.
+func isSuccess(statusCode int) bool {
+	return statusCode >= 200 && statusCode <= 299
+}
+
+// getValue extracts a value from any decoded JSON value. "$" selects the value
+// itself, and keys starting with an index such as "[0].name" or "$[0].name"
+// select from an array. Other keys are resolved with getValueFromNestedMap.
+func getValue(data interface{}, key string) (interface{}, bool) {
+	switch {
+	case key == "$":
+		return data, true
+	case strings.HasPrefix(key, "$."):
+		key = key[2:]
+	case strings.HasPrefix(key, "$["):
+		key = key[1:]
+	}
+
+	if strings.HasPrefix(key, "[") {
+		end := strings.Index(key, "]")
+		if end < 0 {
+			return nil, false
+		}
+		index, err := strconv.Atoi(key[1:end])
+		items, ok := data.([]interface{})
+		if err != nil || !ok || index < 0 || index >= len(items) {
+			return nil, false
+		}
+		rest := strings.TrimPrefix(key[end+1:], ".")
+		if rest == "" {
+			return items[index], true
+		}
+		return getValue(items[index], rest)
+	}
+
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return getValueFromNestedMap(dataMap, key)
+}
+
 // getValueFromNestedMap extracts a value from a nested map[string]interface{} using a dot-separated key.
 func getValueFromNestedMap(data map[string]interface{}, key string) (interface{}, bool) {
 	if !strings.ContainsAny(key, ".[") {
@@ -6,12 +6,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 	"unsafe"
 
 	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/assert"
@@ -30,24 +32,36 @@ func joinContents(contents []mcp.Content) string {
 
 type toolHandler func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
 
-// getToolHandler uses reflection to access the private toolHandlers map in the MCPServer.
+// getToolHandler uses reflection to access the private tools map in the MCPServer.
 func getToolHandler(s *server.MCPServer, toolName string) toolHandler {
 	serverValue := reflect.ValueOf(s).Elem()
-	handlersField := serverValue.FieldByName("toolHandlers")
+	toolsField := serverValue.FieldByName("tools")
 
 	// Use unsafe to access the unexported field.
 	// This is necessary because the field is not exported.
-	handlersFieldPtr := unsafe.Pointer(handlersField.UnsafeAddr())
-	handlersMap := *(*map[string]toolHandler)(handlersFieldPtr)
+	toolsFieldPtr := unsafe.Pointer(toolsField.UnsafeAddr())
+	toolsMap := *(*map[string]server.ServerTool)(toolsFieldPtr)
 
-	if handlersMap == nil {
+	if toolsMap == nil {
 		return nil
 	}
 
-	return handlersMap[toolName]
+	entry, ok := toolsMap[toolName]
+	if !ok {
+		return nil
+	}
+	return toolHandler(entry.Handler)
+}
+
+// TestMain initializes the logger used by the generic tool handlers.
+func TestMain(m *testing.M) {
+	if err := logging.InitLogger(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
 }
 
-// TestMain sets up a mock server for all tests in this package.
+// TestAddGenericTools sets up a mock server and exercises the generic tool handler.
 func TestAddGenericTools(t *testing.T) {
 	// Mock server that will act as the external API
 	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -87,7 +101,11 @@ func TestAddGenericTools(t *testing.T) {
 		case "/not-found":
 			http.Error(w, "Not Found", http.StatusNotFound)
 		case "/malformed-json":
-			fmt.Fprintln(w, `{"key": "value"`) // Intentionally malformed
+			fmt.Fprint(w, `{"key": "value"`) // Intentionally malformed
+		case "/list":
+			fmt.Fprintln(w, `[{"name": "A", "tags": ["x", "y"]}, {"name": "B", "tags": []}]`)
+		case "/scalar":
+			fmt.Fprintln(w, `"pong"`)
 		default:
 			http.NotFound(w, r)
 		}
@@ -256,4 +274,117 @@ func TestAddGenericTools(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "Name:test-user", joinContents(result.Content)) // The mock server returns a fixed user, we just check the call succeeds.
 	})
+	t.Run("Top-level Array and Scalar Responses", func(t *testing.T) {
+		hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{
+			{
+				ToolName:    "list_things",
+				Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/list"},
+				InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+				OutputMapping: []hyancieMCP.OutputMap{
+					{JsonKey: "[0].name", Description: "First", Type: "primitive"},
+					{JsonKey: "$", Description: "Things", Type: "array", Items: []hyancieMCP.OutputMap{
+						{JsonKey: "name", Description: "Name", Type: "primitive"},
+						{JsonKey: "tags", Description: "Tags", Type: "array", Items: []hyancieMCP.OutputMap{
+							{JsonKey: "$", Description: "Tag", Type: "primitive"},
+						}},
+					}},
+				},
+			},
+			{
+				ToolName:    "ping",
+				Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/scalar"},
+				InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+				OutputMapping: []hyancieMCP.OutputMap{
+					{JsonKey: "$", Description: "Reply", Type: "primitive"},
+				},
+			},
+			{
+				ToolName:    "list_unmapped",
+				Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/list"},
+				InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+			},
+		}
+
+		s := server.NewMCPServer("test", "1.0")
+		require.NoError(t, AddGenericTools(s))
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{}}}
+
+		result, err := getToolHandler(s, "list_things")(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "First:A|Things:[项1:{Name:A, Tags:[项1:{Tag:x} | 项2:{Tag:y}]} | 项2:{Name:B, Tags:[]}]", joinContents(result.Content))
+
+		result, err = getToolHandler(s, "ping")(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, "Reply:pong", joinContents(result.Content))
+
+		// Without a matching mapping the body is returned as before.
+		result, err = getToolHandler(s, "list_unmapped")(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, `[{"name": "A", "tags": ["x", "y"]}, {"name": "B", "tags": []}]`+"\n", joinContents(result.Content))
+	})
+}
+
+func TestGetValue(t *testing.T) {
+	data := []interface{}{
+		map[string]interface{}{"name": "A", "tags": []interface{}{"x", []interface{}{"y", "z"}}},
+		"plain",
+	}
+	for key, expected := range map[string]interface{}{
+		"$":            data,
+		"[1]":          "plain",
+		"$[0].name":    "A",
+		"[0].tags[0]":  "x",
+		"[0].tags[1]":  []interface{}{"y", "z"},
+		"[2]":          nil,
+		"name":         nil,
+		"[0].missing":  nil,
+		"[x]":          nil,
+		"[0].tags.foo": nil,
+	} {
+		value, found := getValue(data, key)
+		assert.Equal(t, expected != nil, found, key)
+		assert.Equal(t, expected, value, key)
+	}
+
+	value, found := getValue(map[string]interface{}{"$": "dollar", "a": map[string]interface{}{"b": 1}}, "$.a.b")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+}
+
+func TestGenericToolSuccessStatus(t *testing.T) {
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 7}`))
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer mockAPIServer.Close()
+
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{
+		{
+			ToolName:      "create_item",
+			Request:       hyancieMCP.RequestConfig{Method: "POST", URL: mockAPIServer.URL + "/items"},
+			InputSchema:   mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+			OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "id", Description: "ID", Type: "primitive"}},
+		},
+		{
+			ToolName:    "delete_item",
+			Request:     hyancieMCP.RequestConfig{Method: "DELETE", URL: mockAPIServer.URL + "/items/7"},
+			InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		},
+	}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{}}}
+
+	result, err := getToolHandler(s, "create_item")(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "ID:7", joinContents(result.Content))
+
+	_, err = getToolHandler(s, "delete_item")(context.Background(), req)
+	require.NoError(t, err)
 }
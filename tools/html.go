@@ -0,0 +1,379 @@
+package tools
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// htmlNode is an element or text node of a parsed HTML document.
+type htmlNode struct {
+	tag      string // Lower-case element name; empty for text nodes and the document
+	attrs    map[string]string
+	text     string // Text of text nodes, with character references decoded
+	parent   *htmlNode
+	children []*htmlNode
+}
+
+// tagSet returns the set of the given element names.
+func tagSet(tags ...string) map[string]bool {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return set
+}
+
+var (
+	// voidElements have no content and no end tag.
+	voidElements = tagSet("area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr")
+	// rawTextElements contain text up to their end tag, without markup.
+	rawTextElements = tagSet("script", "style", "textarea", "title")
+	// inlineElements do not end an open paragraph.
+	inlineElements = tagSet("a", "abbr", "audio", "b", "bdi", "bdo", "br", "button", "canvas", "cite", "code", "data", "dfn", "em", "embed", "font", "i", "iframe", "img", "input", "kbd", "label", "mark", "noscript", "object", "picture", "q", "s", "samp", "script", "select", "small", "span", "strong", "sub", "sup", "svg", "template", "textarea", "time", "u", "var", "video", "wbr")
+	// paragraphElements are separated from the surrounding text by a blank line.
+	paragraphElements = tagSet("p", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "blockquote", "table", "ul", "ol", "dl", "figure")
+	// blockElements start on a new line.
+	blockElements = tagSet("address", "article", "aside", "body", "caption", "dd", "details", "dialog", "div", "dt", "fieldset", "figcaption", "footer", "form", "header", "hr", "li", "main", "nav", "section", "summary", "tr")
+	// skippedElements have no readable text.
+	skippedElements = tagSet("head", "script", "style", "noscript", "template", "svg", "iframe", "object", "canvas", "button", "select")
+	// impliedEnds lists the open elements a start tag closes, and the elements
+	// beyond which they are not searched, e.g. a <li> ends the previous <li> of the same list.
+	impliedEnds = map[string][2]map[string]bool{
+		"li":     {tagSet("li"), tagSet("ul", "ol")},
+		"dt":     {tagSet("dt", "dd"), tagSet("dl")},
+		"dd":     {tagSet("dt", "dd"), tagSet("dl")},
+		"tr":     {tagSet("tr"), tagSet("table", "thead", "tbody", "tfoot")},
+		"td":     {tagSet("td", "th"), tagSet("tr", "table")},
+		"th":     {tagSet("td", "th"), tagSet("tr", "table")},
+		"option": {tagSet("option"), tagSet("select", "datalist")},
+	}
+)
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// parseHTML parses an HTML document leniently into a tree: unknown or
+// misnested end tags are ignored, unclosed elements are closed at the end,
+// and the common implied end tags of paragraphs, list items and table cells are applied.
+func parseHTML(src string) *htmlNode {
+	doc := &htmlNode{}
+	current := doc
+	for i := 0; i < len(src); {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			current.appendText(html.UnescapeString(src[i:]))
+			break
+		}
+		if lt > 0 {
+			current.appendText(html.UnescapeString(src[i : i+lt]))
+			i += lt
+		}
+
+		rest := src[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return doc
+			}
+			i += 4 + end + 3
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+			// Doctype, CDATA section or processing instruction
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return doc
+			}
+			i += end + 1
+		case strings.HasPrefix(rest, "</"):
+			name := tagName(rest[2:])
+			end := strings.IndexByte(rest, '>')
+			if name == "" || end < 0 {
+				current.appendText("<")
+				i++
+				continue
+			}
+			current = current.closeElement(name)
+			i += end + 1
+		default:
+			name, attrs, selfClosing, length := parseStartTag(rest)
+			if name == "" {
+				current.appendText("<")
+				i++
+				continue
+			}
+			i += length
+			element := &htmlNode{tag: name, attrs: attrs}
+			current = current.openElement(element)
+			if rawTextElements[name] && !selfClosing {
+				end := indexFold(src[i:], "</"+name)
+				if end < 0 {
+					end = len(src) - i
+				}
+				text := src[i : i+end]
+				if name == "textarea" || name == "title" {
+					text = html.UnescapeString(text)
+				}
+				current.appendText(text)
+				i += end
+				continue
+			}
+			if voidElements[name] || selfClosing {
+				current = current.parent
+			}
+		}
+	}
+	return doc
+}
+
+// tagName returns the lower-case tag name at the start of s.
+func tagName(s string) string {
+	end := 0
+	for end < len(s) && (isASCIILetter(s[end]) || end > 0 && (s[end] >= '0' && s[end] <= '9' || s[end] == '-' || s[end] == ':')) {
+		end++
+	}
+	return strings.ToLower(s[:end])
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// parseStartTag parses the start tag at the start of s. It returns an empty
+// name if s does not start with a start tag.
+func parseStartTag(s string) (name string, attrs map[string]string, selfClosing bool, length int) {
+	name = tagName(s[1:])
+	if name == "" {
+		return "", nil, false, 0
+	}
+	attrs = make(map[string]string)
+	i := 1 + len(name)
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '>':
+			return name, attrs, selfClosing, i + 1
+		case c == '/':
+			selfClosing = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		}
+		selfClosing = false
+
+		start := i
+		for i < len(s) && !strings.ContainsRune(" \t\n\r\f/>=", rune(s[i])) {
+			i++
+		}
+		attrName := strings.ToLower(s[start:i])
+		for i < len(s) && strings.ContainsRune(" \t\n\r\f", rune(s[i])) {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && strings.ContainsRune(" \t\n\r\f", rune(s[i])) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				end := strings.IndexByte(s[i+1:], quote)
+				if end < 0 {
+					end = len(s) - i - 1
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !strings.ContainsRune(" \t\n\r\f>", rune(s[i])) {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		if _, exists := attrs[attrName]; attrName != "" && !exists {
+			attrs[attrName] = html.UnescapeString(value)
+		}
+	}
+	// An unterminated start tag runs to the end of the document.
+	return name, attrs, selfClosing, len(s)
+}
+
+// indexFold returns the index of the first case-insensitive occurrence of substr in s, or -1.
+func indexFold(s, substr string) int {
+	return strings.Index(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// appendText adds text to n, merging it with a preceding text node.
+func (n *htmlNode) appendText(text string) {
+	if text == "" {
+		return
+	}
+	if last := len(n.children) - 1; last >= 0 && n.children[last].tag == "" {
+		n.children[last].text += text
+		return
+	}
+	n.children = append(n.children, &htmlNode{text: text, parent: n})
+}
+
+// openElement adds element below n, or below the ancestor left open after
+// the end tags that element implies, and returns it.
+func (n *htmlNode) openElement(element *htmlNode) *htmlNode {
+	parent := n
+	if ends, ok := impliedEnds[element.tag]; ok {
+		parent = parent.closeImplied(ends[0], ends[1])
+	} else if !inlineElements[element.tag] {
+		// A block ends the paragraph it appears in.
+		for ancestor := parent; ancestor.tag != ""; ancestor = ancestor.parent {
+			if ancestor.tag == "p" {
+				parent = ancestor.parent
+				break
+			}
+			if !inlineElements[ancestor.tag] {
+				break
+			}
+		}
+	}
+	element.parent = parent
+	parent.children = append(parent.children, element)
+	return element
+}
+
+// closeImplied closes the nearest open element in names, unless one in
+// boundaries comes first, and returns the element left open.
+func (n *htmlNode) closeImplied(names, boundaries map[string]bool) *htmlNode {
+	for ancestor := n; ancestor.tag != ""; ancestor = ancestor.parent {
+		if names[ancestor.tag] {
+			return ancestor.parent
+		}
+		if boundaries[ancestor.tag] {
+			break
+		}
+	}
+	return n
+}
+
+// closeElement handles the end tag of name: it closes the nearest open
+// element of that name and the elements inside it, and returns the element
+// left open. End tags without an open element are ignored.
+func (n *htmlNode) closeElement(name string) *htmlNode {
+	for ancestor := n; ancestor.tag != ""; ancestor = ancestor.parent {
+		if ancestor.tag == name {
+			return ancestor.parent
+		}
+	}
+	return n
+}
+
+// elements calls fn for n and the elements below it, in document order.
+func (n *htmlNode) elements(fn func(*htmlNode)) {
+	if n.tag != "" {
+		fn(n)
+	}
+	for _, child := range n.children {
+		child.elements(fn)
+	}
+}
+
+// find returns the first element named tag in n, or nil.
+func (n *htmlNode) find(tag string) *htmlNode {
+	var found *htmlNode
+	n.elements(func(element *htmlNode) {
+		if found == nil && element.tag == tag {
+			found = element
+		}
+	})
+	return found
+}
+
+// textBuilder collects readable text line by line.
+type textBuilder struct {
+	lines []string
+	line  strings.Builder
+}
+
+func (b *textBuilder) write(s string) {
+	if b.line.Len() == 0 {
+		s = strings.TrimLeft(s, " ")
+	}
+	b.line.WriteString(s)
+}
+
+// newline ends the current line, if it has any text.
+func (b *textBuilder) newline() {
+	if line := strings.TrimRight(b.line.String(), " "); line != "" {
+		b.lines = append(b.lines, line)
+	}
+	b.line.Reset()
+}
+
+// blankLine ends the current line and separates the following text by an empty line.
+func (b *textBuilder) blankLine() {
+	b.newline()
+	if len(b.lines) > 0 && b.lines[len(b.lines)-1] != "" {
+		b.lines = append(b.lines, "")
+	}
+}
+
+// readableText returns the text of n as it would be read: without scripts
+// and styles, with collapsed whitespace, blocks on separate lines, and list
+// items starting with "- ".
+func readableText(n *htmlNode) string {
+	b := &textBuilder{}
+	b.walk(n, false)
+	b.newline()
+	for len(b.lines) > 0 && b.lines[len(b.lines)-1] == "" {
+		b.lines = b.lines[:len(b.lines)-1]
+	}
+	return strings.Join(b.lines, "\n")
+}
+
+func (b *textBuilder) walk(n *htmlNode, pre bool) {
+	if n.tag == "" && n.parent != nil {
+		if pre {
+			for i, line := range strings.Split(n.text, "\n") {
+				if i > 0 {
+					b.lines = append(b.lines, b.line.String())
+					b.line.Reset()
+				}
+				b.line.WriteString(line)
+			}
+			return
+		}
+		b.write(whitespace.ReplaceAllString(n.text, " "))
+		return
+	}
+	if skippedElements[n.tag] {
+		return
+	}
+
+	switch {
+	case n.tag == "br":
+		b.newline()
+	case n.tag == "td" || n.tag == "th":
+		if b.line.Len() > 0 {
+			b.write(" | ")
+		}
+	case n.tag == "img" && n.attrs["alt"] != "":
+		if line := b.line.String(); line != "" && !strings.HasSuffix(line, " ") {
+			b.write(" ")
+		}
+		b.write(n.attrs["alt"] + " ")
+	case paragraphElements[n.tag]:
+		b.blankLine()
+	case blockElements[n.tag]:
+		b.newline()
+	}
+	if n.tag == "li" {
+		b.write("- ")
+	}
+	for _, child := range n.children {
+		b.walk(child, pre || n.tag == "pre")
+	}
+	switch {
+	case paragraphElements[n.tag]:
+		b.blankLine()
+	case blockElements[n.tag]:
+		b.newline()
+	}
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPage = `<!DOCTYPE html>
+<html>
+<head><title>Search &amp; results</title><style>p { color: red }</style></head>
+<body>
+<!-- navigation -->
+<nav><a href="/">Home</a></nav>
+<h1>Results</h1>
+<p>Found <b>2</b>
+   results for &quot;go&quot;.
+<div id="list">
+  <ul>
+    <li class="result first"><a href="/a" data-rank="1">Alpha</a>
+    <li class="result"><a href="/b" data-rank="2">Beta</a><img src="b.png" alt="logo">
+  </ul>
+</div>
+<table><tr><th>Name<th>Stars<tr><td>Alpha<td>10</table>
+<pre>line 1
+  line 2</pre>
+<script>if (a < b) { document.write("</p>") }</script>
+<p>Bye<br>now</p>
+</body>
+</html>`
+
+func TestParseHTML(t *testing.T) {
+	doc := parseHTML(testPage)
+
+	title := doc.find("title")
+	require.NotNil(t, title)
+	assert.Equal(t, "Search & results", readableText(title))
+
+	// The <div> ends the open paragraph, and the second <li> the first one.
+	list := doc.find("div")
+	require.NotNil(t, list)
+	assert.Equal(t, "body", list.parent.tag)
+	items := list.find("ul").elementChildren()
+	require.Len(t, items, 2)
+	assert.Equal(t, "/b", items[1].find("a").attrs["href"])
+
+	// Script content is raw text, whatever markup it contains.
+	script := doc.find("script")
+	require.NotNil(t, script)
+	assert.Equal(t, `if (a < b) { document.write("</p>") }`, script.children[0].text)
+}
+
+func TestReadableText(t *testing.T) {
+	doc := parseHTML(testPage)
+	assert.Equal(t, "Home\n"+
+		"\n"+
+		"Results\n"+
+		"\n"+
+		"Found 2 results for \"go\".\n"+
+		"\n"+
+		"- Alpha\n"+
+		"- Beta logo\n"+
+		"\n"+
+		"Name | Stars\n"+
+		"Alpha | 10\n"+
+		"\n"+
+		"line 1\n"+
+		"  line 2\n"+
+		"\n"+
+		"Bye\n"+
+		"now", readableText(doc.find("body")))
+}
+
+func TestSelector(t *testing.T) {
+	doc := parseHTML(testPage)
+	selectText := func(selector string) []string {
+		compiled, err := compileSelector(selector)
+		require.NoError(t, err, selector)
+		var texts []string
+		for _, element := range compiled.selectAll(doc) {
+			texts = append(texts, readableText(element))
+		}
+		return texts
+	}
+
+	assert.Equal(t, []string{"Alpha", "Beta"}, selectText("li.result > a"))
+	assert.Equal(t, []string{"- Alpha"}, selectText("#list li.first"))
+	assert.Equal(t, []string{"Beta"}, selectText(`a[data-rank="2"]`))
+	assert.Equal(t, []string{"Alpha", "Beta"}, selectText("a[href^='/'][data-rank]"))
+	assert.Equal(t, []string{"- Beta logo"}, selectText("li:last-child"))
+	assert.Equal(t, []string{"Stars", "10"}, selectText("tr td:nth-child(2), tr th:nth-child(2)"))
+	assert.Equal(t, []string{"Found 2 results for \"go\"."}, selectText("h1 + p"))
+	assert.Equal(t, []string{"Found 2 results for \"go\".", "Bye\nnow"}, selectText("h1 ~ p"))
+	assert.Equal(t, []string{"Alpha", "10"}, selectText("tr:nth-child(even) > *"))
+	assert.Nil(t, selectText("ol li"))
+
+	for _, invalid := range []string{"", "a >", "li..x", "a[href", "p:hover", "li:nth-child(2n)", "a, "} {
+		_, err := compileSelector(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
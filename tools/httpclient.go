@@ -0,0 +1,337 @@
+package tools
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultMaxRedirects        = 10
+)
+
+// httpClients caches clients by their settings and the state of the files they
+// load, so that every tool using the same settings shares one connection pool,
+// also across config reloads. A rotated CA bundle or certificate yields a new
+// key, and pruneHTTPClients drops the clients no tool uses anymore.
+var httpClients = struct {
+	sync.Mutex
+	byKey map[string]*http.Client
+}{byKey: make(map[string]*http.Client)}
+
+// clientForTool returns the shared client configured for a tool: the named
+// entry of http_clients if the tool selects one, otherwise the default client.
+func clientForTool(global *hyancie.ConfigType, config hyancie.GenericToolConfig) (*http.Client, error) {
+	settings, err := clientSettings(global, config)
+	if err != nil {
+		return nil, err
+	}
+	return sharedHTTPClient(settings)
+}
+
+// clientSettings returns the HTTP client settings that apply to a tool.
+func clientSettings(global *hyancie.ConfigType, config hyancie.GenericToolConfig) (hyancie.HTTPClientConfig, error) {
+	settings := hyancie.HTTPClientConfig{}
+	if global.HTTPClient != nil {
+		settings = *global.HTTPClient
+	}
+	if config.HTTPClient != "" {
+		named, ok := global.HTTPClients[config.HTTPClient]
+		if !ok {
+			return settings, fmt.Errorf("unknown http_client %q", config.HTTPClient)
+		}
+		settings = named
+	}
+	return settings, nil
+}
+
+// sharedHTTPClient returns the cached client for the settings, building it on first use.
+func sharedHTTPClient(settings hyancie.HTTPClientConfig) (*http.Client, error) {
+	key, err := clientKey(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClients.Lock()
+	defer httpClients.Unlock()
+	if client, ok := httpClients.byKey[key]; ok {
+		return client, nil
+	}
+	client, err := newHTTPClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	httpClients.byKey[key] = client
+	return client, nil
+}
+
+// clientKey identifies a client by its settings and the modification time and
+// size of its CA, certificate and key files.
+func clientKey(settings hyancie.HTTPClientConfig) (string, error) {
+	var files []fileState
+	for _, path := range []string{settings.CAFile, settings.CertFile, settings.KeyFile} {
+		files = append(files, statFile(path))
+	}
+	key, err := json.Marshal(struct {
+		Settings hyancie.HTTPClientConfig
+		Files    []fileState
+	}{settings, files})
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// fileState identifies a version of a file on disk.
+type fileState struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// statFile returns the state of the file at path, or the zero state if there
+// is none. Missing files are reported when the client is built.
+func statFile(path string) fileState {
+	if path == "" {
+		return fileState{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{ModTime: info.ModTime(), Size: info.Size()}
+}
+
+// staleHTTPClients returns the tools of the config whose client is not cached
+// under its current key, because a file it loads changed since it was built.
+func staleHTTPClients(global *hyancie.ConfigType) map[string]bool {
+	stale := make(map[string]bool)
+	httpClients.Lock()
+	defer httpClients.Unlock()
+	for _, config := range global.McpTools {
+		settings, err := clientSettings(global, config)
+		if err != nil {
+			continue
+		}
+		key, err := clientKey(settings)
+		if err != nil {
+			continue
+		}
+		if _, ok := httpClients.byKey[key]; !ok {
+			stale[config.ToolName] = true
+		}
+	}
+	return stale
+}
+
+// pruneHTTPClients drops the cached clients that no tool of the config uses
+// and closes their idle connections.
+func pruneHTTPClients(global *hyancie.ConfigType) {
+	used := make(map[string]bool)
+	for _, config := range global.McpTools {
+		settings, err := clientSettings(global, config)
+		if err != nil {
+			continue
+		}
+		if key, err := clientKey(settings); err == nil {
+			used[key] = true
+		}
+	}
+
+	httpClients.Lock()
+	defer httpClients.Unlock()
+	for key, client := range httpClients.byKey {
+		if !used[key] {
+			client.CloseIdleConnections()
+			delete(httpClients.byKey, key)
+		}
+	}
+}
+
+// newHTTPClient builds a client with its own transport from the settings.
+func newHTTPClient(settings hyancie.HTTPClientConfig) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConns = defaultMaxIdleConns
+	if settings.MaxIdleConns > 0 {
+		transport.MaxIdleConns = settings.MaxIdleConns
+	}
+	transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if settings.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	}
+	if settings.ProxyURL != "" {
+		proxyURL, err := url.Parse(settings.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_url %q: %w", settings.ProxyURL, err)
+		}
+		noProxy := newNoProxyMatcher(settings.NoProxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if noProxy.matches(req.URL) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	client := &http.Client{Transport: transport}
+	client.CheckRedirect, err = newRedirectPolicy(settings)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// newTLSConfig loads the CA bundle and client certificate of the settings.
+func newTLSConfig(settings hyancie.HTTPClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	switch settings.TLSMinVersion {
+	case "", "1.2":
+	case "1.0":
+		tlsConfig.MinVersion = tls.VersionTLS10
+	case "1.1":
+		tlsConfig.MinVersion = tls.VersionTLS11
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported tls_min_version %q", settings.TLSMinVersion)
+	}
+
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s contains no PEM certificates", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// newRedirectPolicy returns the CheckRedirect function for the redirect settings.
+func newRedirectPolicy(settings hyancie.HTTPClientConfig) (func(*http.Request, []*http.Request) error, error) {
+	maxRedirects := defaultMaxRedirects
+	if settings.MaxRedirects > 0 {
+		maxRedirects = settings.MaxRedirects
+	}
+	limit := func(via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+
+	switch settings.RedirectPolicy {
+	case "", "follow":
+		return func(req *http.Request, via []*http.Request) error {
+			return limit(via)
+		}, nil
+	case "same_host":
+		return func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host != via[0].URL.Host {
+				return fmt.Errorf("redirect to another host %s is not allowed", req.URL.Host)
+			}
+			return limit(via)
+		}, nil
+	case "none":
+		return func(req *http.Request, via []*http.Request) error {
+			// Hand the redirect response itself back to the caller.
+			return http.ErrUseLastResponse
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported redirect_policy %q", settings.RedirectPolicy)
+}
+
+// noProxyMatcher decides which hosts bypass the configured proxy.
+type noProxyMatcher struct {
+	all      bool
+	networks []*net.IPNet
+	hosts    []string // Exact host names, optionally with ":port"
+	domains  []string // Domain suffixes starting with "."
+}
+
+func newNoProxyMatcher(entries []string) *noProxyMatcher {
+	m := &noProxyMatcher{}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			m.all = true
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				m.networks = append(m.networks, network)
+			}
+		case strings.HasPrefix(entry, "*."):
+			m.domains = append(m.domains, entry[1:])
+		case strings.HasPrefix(entry, "."):
+			m.domains = append(m.domains, entry)
+		default:
+			// "example.com" matches the host itself and its subdomains.
+			m.hosts = append(m.hosts, entry)
+			if !strings.Contains(entry, ":") {
+				m.domains = append(m.domains, "."+entry)
+			}
+		}
+	}
+	return m
+}
+
+func (m *noProxyMatcher) matches(u *url.URL) bool {
+	if m.all {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	hostPort := strings.ToLower(u.Host)
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range m.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	for _, h := range m.hosts {
+		if h == host || h == hostPort {
+			return true
+		}
+	}
+	for _, domain := range m.domains {
+		if strings.HasSuffix(host, domain) {
+			return true
+		}
+	}
+	return false
+}
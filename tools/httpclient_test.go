@@ -0,0 +1,225 @@
+package tools
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM writes a PEM block to a temporary file and returns its path.
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+// newClientCertificate creates a self-signed client certificate and returns it with its cert and key files.
+func newClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "hyancie-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return cert, writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestGenericToolMutualTLS(t *testing.T) {
+	clientCert, certFile, keyFile := newClientCertificate(t)
+
+	mockAPIServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NotEmpty(t, r.TLS.PeerCertificates)
+		w.Write([]byte(`{"status": "` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	mockAPIServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mockAPIServer.StartTLS()
+	defer mockAPIServer.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", mockAPIServer.Certificate().Raw)
+
+	hyancieMCP.Config.HTTPClients = map[string]hyancieMCP.HTTPClientConfig{
+		"internal": {CAFile: caFile, CertFile: certFile, KeyFile: keyFile, TLSMinVersion: "1.2"},
+	}
+	defer func() { hyancieMCP.Config.HTTPClients = nil }()
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{
+		{
+			ToolName:      "internal_status",
+			Request:       hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL},
+			InputSchema:   mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+			OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "status", Description: "Client", Type: "primitive"}},
+			HTTPClient:    "internal",
+		},
+		{
+			ToolName:      "default_status",
+			Request:       hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL},
+			InputSchema:   mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+			OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "status", Description: "Client", Type: "primitive"}},
+		},
+	}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+
+	result, err := getToolHandler(s, "internal_status")(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "Client:hyancie-client", joinContents(result.Content))
+
+	// The default client neither trusts the test CA nor presents a certificate.
+	_, err = getToolHandler(s, "default_status")(context.Background(), mcp.CallToolRequest{})
+	require.Error(t, err)
+}
+
+func TestHTTPClientSharing(t *testing.T) {
+	a, err := sharedHTTPClient(hyancieMCP.HTTPClientConfig{MaxIdleConns: 7})
+	require.NoError(t, err)
+	b, err := sharedHTTPClient(hyancieMCP.HTTPClientConfig{MaxIdleConns: 7})
+	require.NoError(t, err)
+	c, err := sharedHTTPClient(hyancieMCP.HTTPClientConfig{MaxIdleConns: 8})
+	require.NoError(t, err)
+	assert.Same(t, a, b)
+	assert.NotSame(t, a, c)
+	assert.Equal(t, 7, a.Transport.(*http.Transport).MaxIdleConns)
+
+	_, err = sharedHTTPClient(hyancieMCP.HTTPClientConfig{CAFile: "/nonexistent/ca.pem"})
+	require.Error(t, err)
+}
+
+func TestHTTPClientProxyAndRedirects(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	client, err := newHTTPClient(hyancieMCP.HTTPClientConfig{
+		ProxyURL: proxy.URL,
+		NoProxy:  []string{"internal.example.com", "10.0.0.0/8"},
+	})
+	require.NoError(t, err)
+	resp, err := client.Get("http://api.example.com/items")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"http://api.example.com/items"}, proxied)
+
+	matcher := newNoProxyMatcher([]string{"internal.example.com", ".corp", "10.0.0.0/8", "localhost:8080"})
+	for rawURL, expected := range map[string]bool{
+		"http://internal.example.com/x":    true,
+		"http://a.internal.example.com/x":  true,
+		"http://host.corp/x":               true,
+		"http://10.1.2.3/x":                true,
+		"http://localhost:8080/x":          true,
+		"http://localhost:9090/x":          false,
+		"http://api.example.com/x":         false,
+		"http://notinternal.example.com/x": false,
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, matcher.matches(u), rawURL)
+	}
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Write([]byte("new"))
+	}))
+	defer redirecting.Close()
+
+	client, err = newHTTPClient(hyancieMCP.HTTPClientConfig{RedirectPolicy: "none"})
+	require.NoError(t, err)
+	resp, err = client.Get(redirecting.URL + "/old")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	client, err = newHTTPClient(hyancieMCP.HTTPClientConfig{RedirectPolicy: "same_host"})
+	require.NoError(t, err)
+	resp, err = client.Get(redirecting.URL + "/old")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHTTPClientReload(t *testing.T) {
+	_, certFile, keyFile := newClientCertificate(t)
+	tool := hyancieMCP.GenericToolConfig{
+		ToolName:    "internal_status",
+		Request:     hyancieMCP.RequestConfig{Method: "GET", URL: "https://internal.example.com/status"},
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		HTTPClient:  "internal",
+	}
+	global := &hyancieMCP.ConfigType{
+		HTTPClients: map[string]hyancieMCP.HTTPClientConfig{"internal": {CertFile: certFile, KeyFile: keyFile}},
+		McpTools:    []hyancieMCP.GenericToolConfig{tool},
+	}
+
+	s := server.NewMCPServer("test", "1.0")
+	_, _, replaced := ReloadGenericTools(s, &hyancieMCP.ConfigType{}, global)
+	assert.Empty(t, replaced)
+	before, err := clientForTool(global, tool)
+	require.NoError(t, err)
+
+	// An unchanged config keeps the client.
+	_, _, replaced = ReloadGenericTools(s, global, global)
+	assert.Empty(t, replaced)
+
+	// A rotated certificate replaces the tool and its client.
+	_, rotatedCert, rotatedKey := newClientCertificate(t)
+	for from, to := range map[string]string{rotatedCert: certFile, rotatedKey: keyFile} {
+		content, err := os.ReadFile(from)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(to, content, 0o600))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(to, later, later))
+	}
+	_, _, replaced = ReloadGenericTools(s, global, global)
+	assert.Equal(t, []string{"internal_status"}, replaced)
+	after, err := clientForTool(global, tool)
+	require.NoError(t, err)
+	assert.NotSame(t, before, after)
+
+	// Clients no tool uses anymore are dropped.
+	ReloadGenericTools(s, global, &hyancieMCP.ConfigType{})
+	key, err := clientKey(global.HTTPClients["internal"])
+	require.NoError(t, err)
+	httpClients.Lock()
+	_, cached := httpClients.byKey[key]
+	httpClients.Unlock()
+	assert.False(t, cached)
+}
@@ -0,0 +1,697 @@
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+// jsonPath is a compiled JSONPath expression, as used by the expr field of
+// output mappings. It supports the RFC 9535 syntax: member names ($.a.b,
+// $['a.b']), wildcards ([*], .*), indexes including negative ones ([-1]),
+// slices ([1:5:2]), unions ([0,2]), descendants (..name) and filters such as
+// [?(@.status == 'active' && @.price < 10)]. Object members are visited in
+// key order, as decoded JSON objects do not keep their original order.
+type jsonPath struct {
+	segments []pathSegment
+}
+
+// pathSegment is one step of a path, selecting from the current nodes or,
+// for a descendant segment, from the current nodes and all their descendants.
+type pathSegment struct {
+	descendant bool
+	selectors  []pathSelector
+}
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectWildcard
+	selectIndex
+	selectSlice
+	selectFilter
+)
+
+// pathSelector selects children of a node.
+type pathSelector struct {
+	kind   selectorKind
+	name   string
+	index  int
+	slice  [3]*int // start, end and step
+	filter *filterNode
+}
+
+// filterNode is a node of a filter expression.
+type filterNode struct {
+	op          string // "||", "&&", "!", "exists" or a comparison operator
+	left, right *filterNode
+	a, b        filterOperand
+	pattern     *regexp.Regexp // For "=~"
+}
+
+// filterOperand is a path relative to the current node (@) or the root ($), or a literal.
+type filterOperand struct {
+	path   *jsonPath
+	rooted bool
+	value  interface{}
+}
+
+// jsonPaths caches compiled expressions by their source.
+var jsonPaths sync.Map
+
+// compileJSONPath compiles an expression, reusing earlier compilations. The
+// leading "$" may be omitted, e.g. "items[*].name".
+func compileJSONPath(expr string) (*jsonPath, error) {
+	if cached, ok := jsonPaths.Load(expr); ok {
+		return cached.(*jsonPath), nil
+	}
+	p := &pathParser{src: strings.TrimSpace(expr)}
+	path, _, err := p.parsePath(true)
+	if err == nil && p.pos < len(p.src) {
+		err = p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	jsonPaths.Store(expr, path)
+	return path, nil
+}
+
+// evaluateExpr evaluates an expression against data. A path that can only
+// select a single value (such as "a.b[0]") returns that value and whether
+// it exists. Other paths return the list of all selected values, which may be empty.
+func evaluateExpr(expr string, data interface{}) (interface{}, bool, error) {
+	path, err := compileJSONPath(expr)
+	if err != nil {
+		return nil, false, err
+	}
+	nodes := path.evaluate(data, data)
+	if path.singular() {
+		if len(nodes) == 0 {
+			return nil, false, nil
+		}
+		return nodes[0], true, nil
+	}
+	if nodes == nil {
+		nodes = []interface{}{}
+	}
+	return nodes, true, nil
+}
+
+// checkExprs compiles the expressions of the mappings and their items.
+func checkExprs(mappings []hyancie.OutputMap) error {
+	for _, mapping := range mappings {
+		if mapping.Expr != "" {
+			if _, err := compileJSONPath(mapping.Expr); err != nil {
+				return err
+			}
+		}
+		if err := checkExprs(mapping.Items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// singular reports whether the path selects at most one value.
+func (p *jsonPath) singular() bool {
+	for _, segment := range p.segments {
+		if segment.descendant || len(segment.selectors) != 1 {
+			return false
+		}
+		if kind := segment.selectors[0].kind; kind != selectName && kind != selectIndex {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate returns the values selected from start. root is the value "$"
+// refers to in filters.
+func (p *jsonPath) evaluate(start, root interface{}) []interface{} {
+	nodes := []interface{}{start}
+	for _, segment := range p.segments {
+		var next []interface{}
+		for _, node := range nodes {
+			targets := []interface{}{node}
+			if segment.descendant {
+				targets = descendants(node, nil)
+			}
+			for _, target := range targets {
+				for _, selector := range segment.selectors {
+					next = selector.apply(target, root, next)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// apply appends the children of node selected by s to out.
+func (s pathSelector) apply(node, root interface{}, out []interface{}) []interface{} {
+	switch s.kind {
+	case selectName:
+		if object, ok := node.(map[string]interface{}); ok {
+			if value, ok := object[s.name]; ok {
+				out = append(out, value)
+			}
+		}
+	case selectWildcard:
+		out = append(out, children(node)...)
+	case selectIndex:
+		if array, ok := node.([]interface{}); ok {
+			index := s.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				out = append(out, array[index])
+			}
+		}
+	case selectSlice:
+		if array, ok := node.([]interface{}); ok {
+			for _, index := range sliceIndexes(len(array), s.slice) {
+				out = append(out, array[index])
+			}
+		}
+	case selectFilter:
+		for _, child := range children(node) {
+			if s.filter.eval(child, root) {
+				out = append(out, child)
+			}
+		}
+	}
+	return out
+}
+
+// sliceIndexes returns the indexes selected by a start:end:step slice of an
+// array of the given length, with Python semantics.
+func sliceIndexes(length int, slice [3]*int) []int {
+	step := 1
+	if slice[2] != nil {
+		step = *slice[2]
+	}
+	if step == 0 {
+		return nil
+	}
+	normalize := func(bound *int, fallback int) int {
+		if bound == nil {
+			return fallback
+		}
+		if *bound < 0 {
+			return *bound + length
+		}
+		return *bound
+	}
+	clamp := func(i, low, high int) int {
+		if i < low {
+			return low
+		}
+		if i > high {
+			return high
+		}
+		return i
+	}
+
+	var indexes []int
+	if step > 0 {
+		start := clamp(normalize(slice[0], 0), 0, length)
+		end := clamp(normalize(slice[1], length), 0, length)
+		for i := start; i < end; i += step {
+			indexes = append(indexes, i)
+		}
+		return indexes
+	}
+	start := clamp(normalize(slice[0], length-1), -1, length-1)
+	end := clamp(normalize(slice[1], -1-length), -1, length-1)
+	for i := start; i > end; i += step {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// children returns the elements of an array or the member values of an object in key order.
+func children(node interface{}) []interface{} {
+	switch value := node.(type) {
+	case []interface{}:
+		return value
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, len(keys))
+		for i, key := range keys {
+			out[i] = value[key]
+		}
+		return out
+	}
+	return nil
+}
+
+// descendants appends node and all values nested in it to out, depth first.
+func descendants(node interface{}, out []interface{}) []interface{} {
+	out = append(out, node)
+	for _, child := range children(node) {
+		out = descendants(child, out)
+	}
+	return out
+}
+
+// eval reports whether the filter holds for the current node.
+func (n *filterNode) eval(current, root interface{}) bool {
+	switch n.op {
+	case "||":
+		return n.left.eval(current, root) || n.right.eval(current, root)
+	case "&&":
+		return n.left.eval(current, root) && n.right.eval(current, root)
+	case "!":
+		return !n.left.eval(current, root)
+	case "exists":
+		if n.a.path == nil {
+			return n.a.value != nil && n.a.value != false
+		}
+		return len(n.a.nodes(current, root)) > 0
+	}
+
+	a, aFound := n.a.resolve(current, root)
+	b, bFound := n.b.resolve(current, root)
+	switch n.op {
+	case "==":
+		return aFound == bFound && (!aFound || reflect.DeepEqual(a, b))
+	case "!=":
+		return aFound != bFound || (aFound && !reflect.DeepEqual(a, b))
+	case "=~":
+		s, ok := a.(string)
+		return aFound && ok && n.pattern.MatchString(s)
+	}
+	if !aFound || !bFound {
+		return false
+	}
+	var order int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		order = compareOrdered(x, y)
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false
+		}
+		order = compareOrdered(x, y)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	}
+	return false
+}
+
+func compareOrdered[T float64 | string](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// nodes returns the values selected by a path operand.
+func (o filterOperand) nodes(current, root interface{}) []interface{} {
+	if o.rooted {
+		return o.path.evaluate(root, root)
+	}
+	return o.path.evaluate(current, root)
+}
+
+// resolve returns the value of an operand and whether there is one. A path
+// selecting several values resolves to the list of them.
+func (o filterOperand) resolve(current, root interface{}) (interface{}, bool) {
+	if o.path == nil {
+		return o.value, true
+	}
+	nodes := o.nodes(current, root)
+	switch {
+	case len(nodes) == 0:
+		return nil, false
+	case o.path.singular():
+		return nodes[0], true
+	}
+	return nodes, true
+}
+
+// pathParser is a recursive descent parser of JSONPath expressions.
+type pathParser struct {
+	src string
+	pos int
+}
+
+func (p *pathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expr %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *pathParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *pathParser) consume(token string) bool {
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// parsePath parses a path starting with "$" or "@". At the top level, the
+// "$" may be omitted. The boolean result is true for paths rooted at "$".
+func (p *pathParser) parsePath(top bool) (*jsonPath, bool, error) {
+	path := &jsonPath{}
+	rooted := true
+	switch {
+	case p.consume("$"):
+	case p.consume("@"):
+		rooted = false
+	case !top:
+		return nil, false, p.errorf("expected $ or @")
+	case p.peek() != '[' && p.peek() != '.':
+		// An implicit root followed by a member name, e.g. "items[*]".
+		name, err := p.parseName()
+		if err != nil {
+			return nil, false, err
+		}
+		path.segments = append(path.segments, pathSegment{selectors: []pathSelector{{kind: selectName, name: name}}})
+	}
+
+	for {
+		var segment pathSegment
+		switch {
+		case p.consume(".."):
+			segment.descendant = true
+			if p.peek() == '[' {
+				selectors, err := p.parseBracket()
+				if err != nil {
+					return nil, false, err
+				}
+				segment.selectors = selectors
+				break
+			}
+			selector, err := p.parseDotSelector()
+			if err != nil {
+				return nil, false, err
+			}
+			segment.selectors = []pathSelector{selector}
+		case p.consume("."):
+			selector, err := p.parseDotSelector()
+			if err != nil {
+				return nil, false, err
+			}
+			segment.selectors = []pathSelector{selector}
+		case p.peek() == '[':
+			selectors, err := p.parseBracket()
+			if err != nil {
+				return nil, false, err
+			}
+			segment.selectors = selectors
+		default:
+			return path, rooted, nil
+		}
+		path.segments = append(path.segments, segment)
+	}
+}
+
+// parseDotSelector parses the member name or "*" after a dot.
+func (p *pathParser) parseDotSelector() (pathSelector, error) {
+	if p.consume("*") {
+		return pathSelector{kind: selectWildcard}, nil
+	}
+	name, err := p.parseName()
+	return pathSelector{kind: selectName, name: name}, err
+}
+
+// parseName parses an unquoted member name.
+func (p *pathParser) parseName() (string, error) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c != '_' && c != '-' && c < 0x80 && !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a member name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// parseBracket parses a bracketed, comma-separated list of selectors.
+func (p *pathParser) parseBracket() ([]pathSelector, error) {
+	p.consume("[")
+	var selectors []pathSelector
+	for {
+		p.skipSpace()
+		selector, err := p.parseBracketSelector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+		p.skipSpace()
+		if p.consume(",") {
+			continue
+		}
+		if !p.consume("]") {
+			return nil, p.errorf("expected , or ]")
+		}
+		return selectors, nil
+	}
+}
+
+func (p *pathParser) parseBracketSelector() (pathSelector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		name, err := p.parseString()
+		return pathSelector{kind: selectName, name: name}, err
+	case c == '*':
+		p.pos++
+		return pathSelector{kind: selectWildcard}, nil
+	case c == '?':
+		p.pos++
+		filter, err := p.parseOr()
+		return pathSelector{kind: selectFilter, filter: filter}, err
+	}
+
+	start := p.parseInt()
+	p.skipSpace()
+	if !p.consume(":") {
+		if start == nil {
+			return pathSelector{}, p.errorf("expected a name, index, slice, * or filter")
+		}
+		return pathSelector{kind: selectIndex, index: *start}, nil
+	}
+	selector := pathSelector{kind: selectSlice}
+	selector.slice[0] = start
+	p.skipSpace()
+	selector.slice[1] = p.parseInt()
+	p.skipSpace()
+	if p.consume(":") {
+		p.skipSpace()
+		selector.slice[2] = p.parseInt()
+	}
+	return selector, nil
+}
+
+// parseInt parses an optionally negative integer, returning nil if there is none.
+func (p *pathParser) parseInt() *int {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for '0' <= p.peek() && p.peek() <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.src[start:p.pos])
+	if err != nil {
+		p.pos = start
+		return nil
+	}
+	return &n
+}
+
+// parseString parses a single- or double-quoted string with backslash escapes.
+func (p *pathParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var out strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return out.String(), nil
+		case '\\':
+			if p.pos >= len(p.src) {
+				return "", p.errorf("unterminated string")
+			}
+			escaped := p.src[p.pos]
+			p.pos++
+			switch escaped {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			default:
+				out.WriteByte(escaped)
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseOr parses a filter expression: comparisons and existence tests
+// combined with ||, && and !, and grouped with parentheses.
+func (p *pathParser) parseOr() (*filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("||"); p.skipSpace() {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *pathParser) parseAnd() (*filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("&&"); p.skipSpace() {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *pathParser) parseUnary() (*filterNode, error) {
+	p.skipSpace()
+	if p.peek() == '!' && !strings.HasPrefix(p.src[p.pos:], "!=") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNode{op: "!", left: operand}, nil
+	}
+	if p.consume("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return inner, nil
+	}
+
+	a, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	op := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if p.consume(candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return &filterNode{op: "exists", a: a}, nil
+	}
+	b, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	node := &filterNode{op: op, a: a, b: b}
+	if op == "=~" {
+		pattern, ok := b.value.(string)
+		if b.path != nil || !ok {
+			return nil, p.errorf("=~ requires a string pattern")
+		}
+		if node.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, p.errorf("invalid pattern: %v", err)
+		}
+	}
+	return node, nil
+}
+
+// parseOperand parses a path or a string, number, boolean or null literal.
+func (p *pathParser) parseOperand() (filterOperand, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		path, rooted, err := p.parsePath(false)
+		return filterOperand{path: path, rooted: rooted}, err
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		return filterOperand{value: s}, err
+	case c == '-' || '0' <= c && c <= '9':
+		start := p.pos
+		for p.pos < len(p.src) && strings.IndexByte("+-.eE0123456789", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return filterOperand{}, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return filterOperand{value: n}, nil
+	}
+	for keyword, value := range map[string]interface{}{"true": true, "false": false, "null": nil} {
+		if p.consume(keyword) {
+			return filterOperand{value: value}, nil
+		}
+	}
+	return filterOperand{}, p.errorf("expected a path or a literal")
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const storeJSON = `{
+	"store": {
+		"name": "Corner Shop",
+		"items": [
+			{"name": "apple", "status": "active", "price": 3, "tags": ["fruit"]},
+			{"name": "pear", "status": "retired", "price": 4},
+			{"name": "plum", "status": "active", "price": 12, "tags": ["fruit", "stone"]},
+			{"name": "fig", "status": "active", "price": 8, "sale": true}
+		]
+	},
+	"config.version": "v2",
+	"limit": 5
+}`
+
+func TestEvaluateExpr(t *testing.T) {
+	var data interface{}
+	require.NoError(t, json.Unmarshal([]byte(storeJSON), &data))
+
+	for expr, expected := range map[string]interface{}{
+		"$.store.name":                                "Corner Shop",
+		"store.items[0].name":                         "apple",
+		"store.items[-1].name":                        "fig",
+		"$['config.version']":                         "v2",
+		`$["store"]['name']`:                          "Corner Shop",
+		"$.store.items[*].name":                       []interface{}{"apple", "pear", "plum", "fig"},
+		"$.store.items[1:3].name":                     []interface{}{"pear", "plum"},
+		"$.store.items[::-2].name":                    []interface{}{"fig", "pear"},
+		"$.store.items[-2:].name":                     []interface{}{"plum", "fig"},
+		"$.store.items[0,2].price":                    []interface{}{float64(3), float64(12)},
+		"$.store.items[?(@.status == 'active')].name": []interface{}{"apple", "plum", "fig"},
+		"$.store.items[?@.status != 'active'].name":   []interface{}{"pear"},
+		"$.store.items[?(@.price > 3 && @.price < 10)]": []interface{}{
+			map[string]interface{}{"name": "pear", "status": "retired", "price": float64(4)},
+			map[string]interface{}{"name": "fig", "status": "active", "price": float64(8), "sale": true},
+		},
+		"$.store.items[?(@.price >= $.limit || @.sale)].name": []interface{}{"plum", "fig"},
+		"$.store.items[?(!@.tags)].name":                      []interface{}{"pear", "fig"},
+		"$.store.items[?(@.name =~ '^p')].name":               []interface{}{"pear", "plum"},
+		"$.store.items[?(@.tags[1] == 'stone')].name":         []interface{}{"plum"},
+		"$.store.items[?(@.status == 'unknown')]":             []interface{}{},
+		"$..tags[*]":       []interface{}{"fruit", "fruit", "stone"},
+		"$.store.*":        []interface{}{data.(map[string]interface{})["store"].(map[string]interface{})["items"], "Corner Shop"},
+		"$.store.missing":  nil,
+		"$.store.items[9]": nil,
+	} {
+		value, found, err := evaluateExpr(expr, data)
+		require.NoError(t, err, expr)
+		assert.Equal(t, expected != nil, found, expr)
+		assert.Equal(t, expected, value, expr)
+	}
+
+	for _, expr := range []string{
+		"$.store.",
+		"$.store.items[",
+		"$.store.items[?(@.price > )]",
+		"$.store.items[?(@.name =~ @.status)]",
+		"$['unterminated]",
+		"$.store items",
+	} {
+		_, _, err := evaluateExpr(expr, data)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestGenericToolOutputExpr(t *testing.T) {
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, storeJSON)
+	}))
+	defer mockAPIServer.Close()
+
+	config := hyancieMCP.GenericToolConfig{
+		ToolName:    "active_items",
+		Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL},
+		InputSchema: mcp.ToolInputSchema{Type: "object"},
+		OutputMapping: []hyancieMCP.OutputMap{
+			{JsonKey: "store.name", Description: "Store", Type: "primitive"},
+			{Expr: "$['config.version']", Description: "Version", Type: "primitive"},
+			{Expr: "$.store.items[?(@.status == 'active')]", Description: "Active", Type: "array", Limit: 2, Items: []hyancieMCP.OutputMap{
+				{JsonKey: "name", Description: "Name", Type: "primitive"},
+				{Expr: "tags[-1]", Description: "Tag", Type: "primitive"},
+			}},
+			{Expr: "$.store.items[?(@.price > 100)].name", Description: "Expensive", Type: "primitive"},
+		},
+	}
+	result, err := newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "Store:Corner Shop|Version:v2|Active:[项1:{Name:apple, Tag:fruit} | 项2:{Name:plum, Tag:stone}]|Expensive:[]", joinContents(result.Content))
+
+	config.OutputMapping[2].Items[1].Expr = "tags[?"
+	_, err = newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid output mapping: invalid expr")
+}
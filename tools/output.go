@@ -0,0 +1,348 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// outputTemplateFuncs are the helper functions available in output templates.
+var outputTemplateFuncs = template.FuncMap{
+	"json":    bodyTemplateFuncs["json"],
+	"default": bodyTemplateFuncs["default"],
+	// join joins the elements of a list, e.g. {{ join ", " .tags }}.
+	"join": func(sep string, list interface{}) string {
+		switch v := list.(type) {
+		case nil:
+			return ""
+		case []string:
+			return strings.Join(v, sep)
+		case []interface{}:
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = formatParam(item)
+			}
+			return strings.Join(parts, sep)
+		}
+		return formatParam(list)
+	},
+	// truncate shortens a value to at most length characters followed by "…", e.g. {{ truncate 80 .content }}.
+	"truncate": func(length int, value interface{}) string {
+		if value == nil {
+			return ""
+		}
+		runes := []rune(formatParam(value))
+		if length < 0 || len(runes) <= length {
+			return string(runes)
+		}
+		return string(runes[:length]) + "…"
+	},
+	// date formats a timestamp with a Go layout, e.g. {{ date "2006-01-02 15:04" .created_at }}.
+	"date": formatDate,
+	// number formats a number with the given decimals and thousands separators, e.g. {{ number 2 .price }}.
+	"number": formatNumber,
+}
+
+// dateLayouts are the layouts date tries to parse timestamp strings with.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// outputTemplate renders the text of a tool result from the decoded response.
+type outputTemplate struct {
+	tmpl *template.Template
+}
+
+// newOutputTemplate compiles an output_template. It returns nil if text is empty.
+func newOutputTemplate(text string) (*outputTemplate, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("output").Funcs(outputTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output_template: %w", err)
+	}
+	return &outputTemplate{tmpl: tmpl}, nil
+}
+
+// Render executes the template with the decoded response as its data.
+func (o *outputTemplate) Render(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := o.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render output_template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// toolOutput renders the result of a tool from the decoded response: with
+// output_template, with output_mapping, or for output_format "json" as a
+// structured object built from output_mapping.
+type toolOutput struct {
+	mappings   []hyancie.OutputMap
+	style      *outputStyle
+	template   *outputTemplate
+	structured bool
+}
+
+// newToolOutput compiles the output settings of a tool.
+func newToolOutput(global *hyancie.ConfigType, config hyancie.GenericToolConfig) (*toolOutput, error) {
+	if err := checkExprs(config.OutputMapping); err != nil {
+		return nil, fmt.Errorf("invalid output mapping: %w", err)
+	}
+	tmpl, err := newOutputTemplate(config.OutputTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &toolOutput{
+		mappings:   config.OutputMapping,
+		style:      newOutputStyle(global, config),
+		template:   tmpl,
+		structured: config.OutputFormat == "json",
+	}, nil
+}
+
+// render returns the text of the result and, for output_format "json", the
+// structured content. The text of a structured result is output_template if
+// set, or else the serialized object. Without a template, a response that no
+// mapping selects anything from is rendered as fallback, if it is not empty.
+func (o *toolOutput) render(data interface{}, fallback string) (string, map[string]interface{}, error) {
+	var structured map[string]interface{}
+	if o.structured {
+		var err error
+		if structured, err = buildStructured(data, o.mappings); err != nil {
+			return "", nil, fmt.Errorf("failed to process output mappings: %w", err)
+		}
+	}
+	if o.template != nil {
+		text, err := o.template.Render(data)
+		return text, structured, err
+	}
+	if o.structured {
+		text, err := json.Marshal(structured)
+		return string(text), structured, err
+	}
+
+	results, err := processMappings(data, o.mappings, o.style)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to process output mappings: %w", err)
+	}
+	if len(results) == 0 && fallback != "" {
+		// Responses that no mapping selects from are returned as text, e.g. JSON
+		// arrays and scalars as is, and HTML pages as their readable text.
+		return fallback, nil, nil
+	}
+	return strings.Join(results, o.style.fieldSeparator), nil, nil
+}
+
+// result returns the tool result with the rendered text and, if there is
+// one, the structured content in its metadata. _meta.structuredContent is an
+// extension of this server, not the structuredContent field of the MCP
+// specification, which mcp-go v0.32 does not support.
+func (o *toolOutput) result(text string, structured map[string]interface{}) *mcp.CallToolResult {
+	result := &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}
+	result.Meta = map[string]interface{}{}
+	if structured != nil {
+		result.Meta["structuredContent"] = structured
+	}
+	return result
+}
+
+// buildStructured builds the object of a structured result. Mappings whose
+// value is missing are left out; the values of primitive mappings keep their
+// JSON types.
+func buildStructured(data interface{}, mappings []hyancie.OutputMap) (map[string]interface{}, error) {
+	object := make(map[string]interface{}, len(mappings))
+	for _, mapping := range mappings {
+		value, found, err := mappedValue(data, mapping)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		switch mapping.Type {
+		case "primitive":
+			object[mapping.Name] = value
+		case "object":
+			if object[mapping.Name], err = buildStructured(value, mapping.Items); err != nil {
+				return nil, err
+			}
+		case "array":
+			arrayValue, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			if mapping.Limit > 0 && mapping.Limit < len(arrayValue) {
+				arrayValue = arrayValue[:mapping.Limit]
+			}
+			if len(mapping.Items) == 0 {
+				object[mapping.Name] = arrayValue
+				continue
+			}
+			items := make([]interface{}, len(arrayValue))
+			for i, item := range arrayValue {
+				if items[i], err = buildStructured(item, mapping.Items); err != nil {
+					return nil, err
+				}
+			}
+			object[mapping.Name] = items
+		}
+	}
+	return object, nil
+}
+
+// outputSchema derives the JSON Schema of the structured results of the mappings.
+func outputSchema(mappings []hyancie.OutputMap) map[string]interface{} {
+	properties := make(map[string]interface{}, len(mappings))
+	for _, mapping := range mappings {
+		var property map[string]interface{}
+		switch mapping.Type {
+		case "object":
+			property = outputSchema(mapping.Items)
+		case "array":
+			property = map[string]interface{}{"type": "array"}
+			if len(mapping.Items) > 0 {
+				property["items"] = outputSchema(mapping.Items)
+			}
+		default:
+			// The type of a primitive depends on the response.
+			property = map[string]interface{}{}
+		}
+		if mapping.Description != "" {
+			property["description"] = mapping.Description
+		}
+		properties[mapping.Name] = property
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// AddOutputSchemas is a tools/list hook adding the output schemas of the
+// tools with output_format "json" to the result's _meta.outputSchemas, keyed
+// by tool name. This is an extension of this server: the tool definitions of
+// mcp-go v0.32 have no outputSchema field, so clients implementing the MCP
+// specification do not see the schemas.
+func AddOutputSchemas(ctx context.Context, id any, request *mcp.ListToolsRequest, result *mcp.ListToolsResult) {
+	current := hyancie.CurrentConfig()
+	configs := make(map[string]hyancie.GenericToolConfig, len(current.McpTools))
+	for _, config := range current.McpTools {
+		configs[config.ToolName] = config
+	}
+	schemas := make(map[string]interface{})
+	for _, tool := range result.Tools {
+		if config, ok := configs[tool.Name]; ok && config.OutputFormat == "json" {
+			schemas[tool.Name] = outputSchema(config.OutputMapping)
+		}
+	}
+	if len(schemas) == 0 {
+		return
+	}
+	if result.Meta == nil {
+		result.Meta = map[string]interface{}{}
+	}
+	result.Meta["outputSchemas"] = schemas
+}
+
+// formatDate formats a timestamp given as a string in a common layout or as
+// Unix seconds (or milliseconds). Values that are not timestamps are returned as is.
+func formatDate(layout string, value interface{}) string {
+	var t time.Time
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		t = v
+	case float64:
+		t = unixTime(v)
+	case string:
+		parsed := false
+		for _, candidate := range dateLayouts {
+			if p, err := time.Parse(candidate, v); err == nil {
+				t, parsed = p, true
+				break
+			}
+		}
+		if !parsed {
+			seconds, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return v
+			}
+			t = unixTime(seconds)
+		}
+	default:
+		return formatParam(value)
+	}
+	return t.Format(layout)
+}
+
+// unixTime converts Unix seconds to UTC, treating values of 1e12 and above as milliseconds.
+func unixTime(seconds float64) time.Time {
+	if math.Abs(seconds) >= 1e12 {
+		return time.UnixMilli(int64(seconds)).UTC()
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+}
+
+// formatNumber formats a number, or a string holding one, with the given
+// decimals and comma thousands separators. Other values are returned as is.
+func formatNumber(decimals int, value interface{}) string {
+	var f float64
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return v
+		}
+		f = parsed
+	default:
+		return formatParam(value)
+	}
+	if decimals < 0 {
+		decimals = -1
+	}
+	formatted := strconv.FormatFloat(f, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(formatted, "-") {
+		sign, formatted = "-", formatted[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(formatted, ".")
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	if hasFraction {
+		return sign + grouped.String() + "." + fraction
+	}
+	return sign + grouped.String()
+}
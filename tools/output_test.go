@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputTemplateFuncs(t *testing.T) {
+	for template, expected := range map[string]string{
+		`{{ join ", " .tags }}`:                        "a, 2, true",
+		`{{ .tags | join "/" }}`:                       "a/2/true",
+		`{{ join ", " .missing }}`:                     "",
+		`{{ truncate 5 .text }}`:                       "Hello…",
+		`{{ truncate 50 .text }}`:                      "Hello, 世界",
+		`{{ default "n/a" .missing }}`:                 "n/a",
+		`{{ json .tags }}`:                             `["a",2,true]`,
+		`{{ date "2006-01-02 15:04" .created }}`:       "2024-03-05 08:30",
+		`{{ date "Jan 2, 2006" .day }}`:                "Mar 5, 2024",
+		`{{ date "2006-01-02T15:04:05Z07:00" .unix }}`: "2024-03-05T08:30:00Z",
+		`{{ date "2006-01-02" .unixMillis }}`:          "2024-03-05",
+		`{{ date "2006" .text }}`:                      "Hello, 世界",
+		`{{ number 2 .price }}`:                        "1,234,567.50",
+		`{{ number 0 .negative }}`:                     "-1,000",
+		`{{ number 1 "42" }}`:                          "42.0",
+		`{{ number -1 .small }}`:                       "0.125",
+		`{{ number 2 .text }}`:                         "Hello, 世界",
+	} {
+		output, err := newOutputTemplate(template)
+		require.NoError(t, err, template)
+		text, err := output.Render(map[string]interface{}{
+			"tags":       []interface{}{"a", float64(2), true},
+			"text":       "Hello, 世界",
+			"created":    "2024-03-05T08:30:00Z",
+			"day":        "2024-03-05",
+			"unix":       float64(1709627400),
+			"unixMillis": float64(1709627400000),
+			"price":      1234567.5,
+			"negative":   float64(-999.9),
+			"small":      0.125,
+		})
+		require.NoError(t, err, template)
+		assert.Equal(t, expected, text, template)
+	}
+
+	_, err := newOutputTemplate("{{ .unclosed ")
+	assert.ErrorContains(t, err, "invalid output_template")
+}
+
+func TestGenericToolOutputTemplate(t *testing.T) {
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"city": "Hangzhou", "forecast": [{"day": "2024-03-05", "high": 18.5}, {"day": "2024-03-06", "high": 21}]}`)
+	}))
+	defer mockAPIServer.Close()
+
+	handler := newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName:       "forecast",
+		Request:        hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL},
+		InputSchema:    mcp.ToolInputSchema{Type: "object"},
+		OutputMapping:  []hyancieMCP.OutputMap{{JsonKey: "city", Description: "City", Type: "primitive"}},
+		OutputTemplate: "## {{ .city }}\n| Day | High |\n|---|---|\n{{ range .forecast }}| {{ date \"Jan 2\" .day }} | {{ number 1 .high }} |\n{{ end }}",
+	})
+	result, err := handler(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "## Hangzhou\n| Day | High |\n|---|---|\n| Mar 5 | 18.5 |\n| Mar 6 | 21.0 |\n", joinContents(result.Content))
+
+	handler = newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName:       "broken",
+		Request:        hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL},
+		InputSchema:    mcp.ToolInputSchema{Type: "object"},
+		OutputTemplate: "{{ .city.name.first }}",
+	})
+	_, err = handler(context.Background(), mcp.CallToolRequest{})
+	assert.ErrorContains(t, err, "failed to render output_template")
+}
+
+func TestGenericToolStructuredOutput(t *testing.T) {
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"location": {"city": "Hangzhou", "lat": 30.27}, "days": [{"day": "Tue", "high": 18.5, "rain": false}, {"day": "Wed", "high": 21, "rain": true}], "alerts": ["wind"]}`)
+	}))
+	defer mockAPIServer.Close()
+
+	config := hyancieMCP.GenericToolConfig{
+		ToolName:     "forecast",
+		Request:      hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL},
+		InputSchema:  mcp.ToolInputSchema{Type: "object"},
+		OutputFormat: "json",
+		OutputMapping: []hyancieMCP.OutputMap{
+			{JsonKey: "location", Name: "location", Description: "Location", Type: "object", Items: []hyancieMCP.OutputMap{
+				{JsonKey: "city", Name: "city", Description: "City", Type: "primitive"},
+				{JsonKey: "lat", Name: "latitude", Type: "primitive"},
+			}},
+			{JsonKey: "days", Name: "days", Description: "Days", Type: "array", Limit: 1, Items: []hyancieMCP.OutputMap{
+				{JsonKey: "day", Name: "day", Type: "primitive"},
+				{JsonKey: "high", Name: "high", Type: "primitive"},
+				{JsonKey: "rain", Name: "rain", Type: "primitive"},
+			}},
+			{JsonKey: "alerts", Name: "alerts", Type: "array"},
+			{JsonKey: "missing", Name: "missing", Type: "primitive"},
+		},
+	}
+	result, err := newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	expected := map[string]interface{}{
+		"location": map[string]interface{}{"city": "Hangzhou", "latitude": 30.27},
+		"days":     []interface{}{map[string]interface{}{"day": "Tue", "high": 18.5, "rain": false}},
+		"alerts":   []interface{}{"wind"},
+	}
+	assert.Equal(t, expected, result.Meta["structuredContent"])
+	var text map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(joinContents(result.Content)), &text))
+	assert.Equal(t, expected, text)
+
+	// A template provides the text fallback instead of the serialized object.
+	config.OutputTemplate = "{{ .location.city }}: {{ len .days }} days"
+	result, err = newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "Hangzhou: 2 days", joinContents(result.Content))
+	assert.Equal(t, expected, result.Meta["structuredContent"])
+
+	// The text format renders object mappings inline and has no structured content.
+	config.OutputFormat, config.OutputTemplate = "", ""
+	result, err = newGenericToolHandler(&hyancieMCP.ConfigType{}, config)(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, joinContents(result.Content), "Location:{City:Hangzhou, :30.27}|Days:[项1:{:Tue, :18.5, :false}]")
+	assert.NotContains(t, result.Meta, "structuredContent")
+}
+
+func TestAddOutputSchemas(t *testing.T) {
+	previous := hyancieMCP.Config.McpTools
+	defer func() { hyancieMCP.Config.McpTools = previous }()
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{
+		{
+			ToolName:     "forecast",
+			Request:      hyancieMCP.RequestConfig{Method: "GET", URL: "http://example.com/forecast"},
+			InputSchema:  mcp.ToolInputSchema{Type: "object"},
+			OutputFormat: "json",
+			OutputMapping: []hyancieMCP.OutputMap{
+				{JsonKey: "city", Name: "city", Description: "City", Type: "primitive"},
+				{JsonKey: "days", Name: "days", Type: "array", Items: []hyancieMCP.OutputMap{
+					{JsonKey: "high", Name: "high", Description: "High", Type: "primitive"},
+				}},
+				{JsonKey: "alerts", Name: "alerts", Type: "array"},
+			},
+		},
+		{
+			ToolName:    "weather",
+			Request:     hyancieMCP.RequestConfig{Method: "GET", URL: "http://example.com/weather"},
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+		},
+	}
+
+	hooks := &server.Hooks{}
+	hooks.AddAfterListTools(AddOutputSchemas)
+	s := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(true), server.WithHooks(hooks))
+	require.NoError(t, AddGenericTools(s))
+
+	response := s.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`))
+	list, ok := response.(mcp.JSONRPCResponse)
+	require.True(t, ok, "%#v", response)
+	assert.Equal(t, map[string]interface{}{
+		"forecast": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{"description": "City"},
+				"days": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"high": map[string]interface{}{"description": "High"}},
+				}},
+				"alerts": map[string]interface{}{"type": "array"},
+			},
+		},
+	}, list.Result.(mcp.ListToolsResult).Meta["outputSchemas"])
+}
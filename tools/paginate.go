@@ -0,0 +1,256 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+)
+
+// defaultMaxPages bounds the pages fetched per call when max_pages is not configured.
+const defaultMaxPages = 10
+
+// defaultPageParams are the query parameters of the pagination types that use one.
+var defaultPageParams = map[string]string{"cursor": "cursor", "page": "page", "offset": "offset"}
+
+// paginator follows the further pages of a list response.
+type paginator struct {
+	config   hyancie.PaginationConfig
+	decoder  *responseDecoder // Decodes every page like the first one
+	param    string
+	start    int
+	maxPages int
+}
+
+// pageFetcher requests the page at pageURL.
+type pageFetcher func(ctx context.Context, pageURL string) (*upstreamResponse, error)
+
+// pagination reports how many pages and items were collected, and whether
+// the last page was reached rather than a limit.
+type pagination struct {
+	pages    int
+	items    int
+	complete bool
+}
+
+// meta returns the pagination metadata added to the tool result.
+func (p pagination) meta() map[string]interface{} {
+	return map[string]interface{}{
+		"pages":    p.pages,
+		"items":    p.items,
+		"complete": p.complete,
+	}
+}
+
+// newPaginator returns the paginator of a tool, or nil if pagination is not
+// configured. Pages are decoded with the tool's response decoder.
+func newPaginator(config *hyancie.PaginationConfig, decoder *responseDecoder) *paginator {
+	if config == nil {
+		return nil
+	}
+	p := &paginator{config: *config, decoder: decoder, param: config.Param, start: config.Start, maxPages: config.MaxPages}
+	if p.param == "" {
+		p.param = defaultPageParams[config.Type]
+	}
+	if p.start == 0 && config.Type == "page" {
+		p.start = 1
+	}
+	if p.maxPages <= 0 {
+		p.maxPages = defaultMaxPages
+	}
+	return p
+}
+
+// collect fetches the pages following first, whose decoded body is data, and
+// returns data with the array at json_key replaced by the items of all pages.
+// If the first page has no array at json_key, there is nothing to paginate.
+func (p *paginator) collect(ctx context.Context, firstURL string, first *upstreamResponse, data interface{}, fetch pageFetcher) (interface{}, pagination, error) {
+	value, _ := getValue(data, p.config.JsonKey)
+	items, ok := value.([]interface{})
+	if !ok {
+		return data, pagination{pages: 1, complete: true}, nil
+	}
+
+	all := append([]interface{}(nil), items...)
+	result := pagination{pages: 1}
+	pageURL, response, pageData := firstURL, first, data
+	for result.pages < p.maxPages && (p.config.MaxItems <= 0 || len(all) < p.config.MaxItems) {
+		next, err := p.next(pageURL, response, pageData, items)
+		if err != nil {
+			return data, result, err
+		}
+		if next == "" || next == pageURL {
+			result.complete = true
+			break
+		}
+		// Pages are fetched with the tool's headers and credentials, which
+		// must not reach a host named by the upstream.
+		if !sameOrigin(firstURL, next) {
+			return data, result, fmt.Errorf("next page URL %s is not on the host of the first page", next)
+		}
+
+		logging.Logger.Info("Fetching next page", "page", result.pages+1, "url", next)
+		response, err = fetch(ctx, next)
+		if err != nil {
+			return data, result, err
+		}
+		if !isSuccess(response.StatusCode) {
+			return data, result, fmt.Errorf("request for page %d failed with status %d: %s", result.pages+1, response.StatusCode, string(response.Body))
+		}
+		pageData, _, err = p.decoder.decode(response.Header, response.Body)
+		if err != nil {
+			return data, result, fmt.Errorf("failed to decode page %d: %w", result.pages+1, err)
+		}
+		result.pages++
+		pageURL = next
+
+		value, _ = getValue(pageData, p.config.JsonKey)
+		items, _ = value.([]interface{})
+		all = append(all, items...)
+	}
+
+	if p.config.MaxItems > 0 && len(all) > p.config.MaxItems {
+		all = all[:p.config.MaxItems]
+		result.complete = false
+	}
+	result.items = len(all)
+	if p.config.JsonKey == "$" {
+		return all, result, nil
+	}
+	if dataMap, ok := data.(map[string]interface{}); ok {
+		setValueInNestedMap(dataMap, strings.TrimPrefix(p.config.JsonKey, "$."), all)
+	}
+	return data, result, nil
+}
+
+// next returns the URL of the page after the given one, or "" if it was the last page.
+func (p *paginator) next(pageURL string, response *upstreamResponse, data interface{}, items []interface{}) (string, error) {
+	lastPage := len(items) == 0 || (p.config.PageSize > 0 && len(items) < p.config.PageSize)
+
+	switch p.config.Type {
+	case "link":
+		return nextLink(pageURL, response.Header.Values("Link"))
+	case "cursor":
+		value, ok := getValue(data, p.config.NextKey)
+		if !ok || value == nil || value == false {
+			return "", nil
+		}
+		cursor := fmt.Sprint(value)
+		if number, ok := value.(float64); ok {
+			cursor = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		switch {
+		case cursor == "":
+			return "", nil
+		case strings.HasPrefix(cursor, "http://"), strings.HasPrefix(cursor, "https://"), strings.HasPrefix(cursor, "/"):
+			// Some APIs return the URL of the next page instead of a token.
+			return resolveURL(pageURL, cursor)
+		}
+		return withQueryParam(pageURL, p.param, cursor)
+	case "page":
+		if lastPage {
+			return "", nil
+		}
+		current := p.start
+		if page, err := strconv.Atoi(queryParam(pageURL, p.param)); err == nil {
+			current = page
+		}
+		return withQueryParam(pageURL, p.param, strconv.Itoa(current+1))
+	case "offset":
+		if lastPage {
+			return "", nil
+		}
+		current, _ := strconv.Atoi(queryParam(pageURL, p.param))
+		return withQueryParam(pageURL, p.param, strconv.Itoa(current+len(items)))
+	}
+	return "", fmt.Errorf("unsupported pagination type %q", p.config.Type)
+}
+
+// nextLink returns the rel="next" target of RFC 8288 Link headers, resolved against pageURL.
+func nextLink(pageURL string, links []string) (string, error) {
+	for _, header := range links {
+		for _, link := range strings.Split(header, ",") {
+			target, params, found := strings.Cut(strings.TrimSpace(link), ";")
+			if !found || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return resolveURL(pageURL, target[1:len(target)-1])
+					}
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// resolveURL resolves a possibly relative reference against base.
+func resolveURL(base, reference string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid page URL %q: %w", base, err)
+	}
+	ref, err := url.Parse(reference)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page URL %q: %w", reference, err)
+	}
+	return baseURL.ResolveReference(ref).String(), nil
+}
+
+// sameOrigin reports whether two URLs have the same scheme and host.
+func sameOrigin(a, b string) bool {
+	urlA, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	urlB, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(urlA.Scheme, urlB.Scheme) && strings.EqualFold(urlA.Host, urlB.Host)
+}
+
+// queryParam returns the value of a query parameter of rawURL.
+func queryParam(rawURL, name string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get(name)
+}
+
+// withQueryParam returns rawURL with the query parameter set to value.
+func withQueryParam(rawURL, name, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid page URL %q: %w", rawURL, err)
+	}
+	query := u.Query()
+	query.Set(name, value)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// setValueInNestedMap sets the value at a dot-separated key whose parent objects exist.
+func setValueInNestedMap(data map[string]interface{}, key string, value interface{}) {
+	keys := strings.Split(key, ".")
+	current := data
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := current[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
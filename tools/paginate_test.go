@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// itemsJSON returns the JSON array of the items numbered from first to last.
+func itemsJSON(first, last int) string {
+	var items []string
+	for i := first; i <= last; i++ {
+		items = append(items, fmt.Sprintf(`{"id": %d}`, i))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func newPaginatedHandler(url string, pagination *hyancieMCP.PaginationConfig) toolHandler {
+	return toolHandler(newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName:    "list_items",
+		Request:     hyancieMCP.RequestConfig{Method: "GET", URL: url},
+		InputSchema: mcp.ToolInputSchema{Type: "object"},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "data.items", Description: "Items", Type: "array", Items: []hyancieMCP.OutputMap{
+			{JsonKey: "id", Description: "ID", Type: "primitive"},
+		}}},
+		Pagination: pagination,
+	}))
+}
+
+func TestGenericToolPagination(t *testing.T) {
+	var requests []string
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/cursor":
+			switch query.Get("after") {
+			case "":
+				fmt.Fprintf(w, `{"data": {"items": %s}, "meta": {"next": "c2"}}`, itemsJSON(1, 2))
+			case "c2":
+				fmt.Fprintf(w, `{"data": {"items": %s}, "meta": {"next": "/cursor?after=c3"}}`, itemsJSON(3, 4))
+			case "c3":
+				fmt.Fprintf(w, `{"data": {"items": %s}, "meta": {"next": null}}`, itemsJSON(5, 5))
+			}
+		case "/page":
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page == 0 {
+				page = 1
+			}
+			if page > 3 {
+				fmt.Fprint(w, `{"data": {"items": []}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"data": {"items": %s}}`, itemsJSON(page*2-1, page*2))
+		case "/offset":
+			offset, _ := strconv.Atoi(query.Get("skip"))
+			last := offset + 2
+			if last > 5 {
+				last = 5
+			}
+			fmt.Fprintf(w, `{"data": {"items": %s}}`, itemsJSON(offset+1, last))
+		case "/link":
+			page, _ := strconv.Atoi(query.Get("p"))
+			if page < 2 {
+				w.Header().Add("Link", `</link?p=`+strconv.Itoa(page+1)+`>; rel="next", </link?p=2>; rel="last"`)
+			}
+			fmt.Fprintf(w, `{"data": {"items": %s}}`, itemsJSON(page*2+1, page*2+2))
+		case "/root":
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page < 2 {
+				w.Header().Set("Link", `</root?page=2>; rel="next"`)
+				fmt.Fprint(w, itemsJSON(1, 2))
+				return
+			}
+			fmt.Fprint(w, itemsJSON(3, 3))
+		case "/yaml":
+			// Decoded by the Content-Type of each page.
+			w.Header().Set("Content-Type", "application/yaml")
+			switch query.Get("page") {
+			case "":
+				fmt.Fprint(w, "data:\n  items:\n    - id: 1\n    - id: 2\n")
+			case "2":
+				fmt.Fprint(w, "data:\n  items:\n    - id: 3\n")
+			default:
+				fmt.Fprint(w, "data:\n  items: []\n")
+			}
+		case "/broken":
+			if query.Get("page") == "2" {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, `{"data": {"items": %s}}`, itemsJSON(1, 2))
+		}
+	}))
+	defer mockAPIServer.Close()
+
+	call := func(t *testing.T, handler toolHandler) *mcp.CallToolResult {
+		result, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		return result
+	}
+	ids := func(n int) string {
+		var items []string
+		for i := 1; i <= n; i++ {
+			items = append(items, fmt.Sprintf("项%d:{ID:%d}", i, i))
+		}
+		return "Items:[" + strings.Join(items, " | ") + "]"
+	}
+
+	t.Run("cursor", func(t *testing.T) {
+		requests = nil
+		result := call(t, newPaginatedHandler(mockAPIServer.URL+"/cursor?limit=2", &hyancieMCP.PaginationConfig{
+			Type: "cursor", JsonKey: "data.items", NextKey: "meta.next", Param: "after",
+		}))
+		assert.Equal(t, ids(5), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 3, "items": 5, "complete": true}, result.Meta["pagination"])
+		assert.Equal(t, []string{"/cursor?limit=2", "/cursor?after=c2&limit=2", "/cursor?after=c3"}, requests)
+	})
+
+	t.Run("page", func(t *testing.T) {
+		requests = nil
+		result := call(t, newPaginatedHandler(mockAPIServer.URL+"/page", &hyancieMCP.PaginationConfig{Type: "page", JsonKey: "data.items"}))
+		assert.Equal(t, ids(6), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 4, "items": 6, "complete": true}, result.Meta["pagination"])
+		assert.Equal(t, []string{"/page", "/page?page=2", "/page?page=3", "/page?page=4"}, requests)
+	})
+
+	t.Run("offset with short last page", func(t *testing.T) {
+		requests = nil
+		result := call(t, newPaginatedHandler(mockAPIServer.URL+"/offset", &hyancieMCP.PaginationConfig{Type: "offset", JsonKey: "data.items", Param: "skip", PageSize: 2}))
+		assert.Equal(t, ids(5), joinContents(result.Content))
+		assert.Equal(t, []string{"/offset", "/offset?skip=2", "/offset?skip=4"}, requests)
+	})
+
+	t.Run("link header", func(t *testing.T) {
+		result := call(t, newPaginatedHandler(mockAPIServer.URL+"/link", &hyancieMCP.PaginationConfig{Type: "link", JsonKey: "data.items"}))
+		assert.Equal(t, ids(6), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 3, "items": 6, "complete": true}, result.Meta["pagination"])
+	})
+
+	t.Run("top-level array", func(t *testing.T) {
+		handler := toolHandler(newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+			ToolName:    "list_root",
+			Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/root"},
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+			OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "$", Description: "Items", Type: "array", Items: []hyancieMCP.OutputMap{
+				{JsonKey: "id", Description: "ID", Type: "primitive"},
+			}}},
+			Pagination: &hyancieMCP.PaginationConfig{Type: "link", JsonKey: "$"},
+		}))
+		result := call(t, handler)
+		assert.Equal(t, ids(3), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 2, "items": 3, "complete": true}, result.Meta["pagination"])
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		requests = nil
+		result := call(t, newPaginatedHandler(mockAPIServer.URL+"/page", &hyancieMCP.PaginationConfig{Type: "page", JsonKey: "data.items", MaxPages: 2}))
+		assert.Equal(t, ids(4), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 2, "items": 4, "complete": false}, result.Meta["pagination"])
+
+		result = call(t, newPaginatedHandler(mockAPIServer.URL+"/page", &hyancieMCP.PaginationConfig{Type: "page", JsonKey: "data.items", MaxItems: 3}))
+		assert.Equal(t, ids(3), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 2, "items": 3, "complete": false}, result.Meta["pagination"])
+	})
+
+	t.Run("non-JSON pages", func(t *testing.T) {
+		result := call(t, newPaginatedHandler(mockAPIServer.URL+"/yaml", &hyancieMCP.PaginationConfig{Type: "page", JsonKey: "data.items"}))
+		assert.Equal(t, ids(3), joinContents(result.Content))
+		assert.Equal(t, map[string]interface{}{"pages": 3, "items": 3, "complete": true}, result.Meta["pagination"])
+	})
+
+	t.Run("next page on another host", func(t *testing.T) {
+		otherRequests := 0
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			otherRequests++
+			fmt.Fprintf(w, `{"data": {"items": %s}}`, itemsJSON(3, 4))
+		}))
+		defer other.Close()
+		foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `<`+other.URL+`/steal?p=2>; rel="next"`)
+			fmt.Fprintf(w, `{"data": {"items": %s}}`, itemsJSON(1, 2))
+		}))
+		defer foreign.Close()
+
+		handler := newPaginatedHandler(foreign.URL+"/link", &hyancieMCP.PaginationConfig{Type: "link", JsonKey: "data.items"})
+		_, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is not on the host of the first page")
+		assert.Zero(t, otherRequests)
+	})
+
+	t.Run("failed page", func(t *testing.T) {
+		handler := newPaginatedHandler(mockAPIServer.URL+"/broken", &hyancieMCP.PaginationConfig{Type: "page", JsonKey: "data.items"})
+		_, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "request for page 2 failed with status 500")
+	})
+}
+
+func TestNextLink(t *testing.T) {
+	next, err := nextLink("https://api.example.com/v1/items?page=1", []string{
+		`<https://api.example.com/v1/items?page=1>; rel="prev first"`,
+		`<items?page=2>; rel="next"`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/v1/items?page=2", next)
+
+	next, err = nextLink("https://api.example.com/v1/items", []string{`<https://api.example.com/v1/items?page=9>; rel=last`})
+	require.NoError(t, err)
+	assert.Empty(t, next)
+}
@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/liu599/hyancie/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Argument placements supported in the "in" field of an input_schema property.
+const (
+	placementPath   = "path"
+	placementQuery  = "query"
+	placementHeader = "header"
+	placementCookie = "cookie"
+	placementBody   = "body"
+)
+
+// placementKeys are the input_schema property fields that configure placement.
+// They are stripped from the schema advertised to clients.
+var placementKeys = []string{"in", "wire_name"}
+
+// placement describes where a single argument is sent and under which name.
+type placement struct {
+	In       string
+	WireName string
+}
+
+// requestParts holds the arguments split by their placement in the HTTP request.
+type requestParts struct {
+	URL     string
+	Headers map[string]string
+	Cookies []*http.Cookie
+	Body    map[string]interface{} // nil when no body is sent
+}
+
+// parsePlacements reads the "in" and "wire_name" fields of every input_schema property.
+func parsePlacements(schema mcp.ToolInputSchema) (map[string]placement, error) {
+	placements := make(map[string]placement)
+	for name, property := range schema.Properties {
+		details, ok := property.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p := placement{WireName: name}
+		if in, ok := details["in"].(string); ok {
+			switch in {
+			case placementPath, placementQuery, placementHeader, placementCookie, placementBody:
+				p.In = in
+			default:
+				return nil, fmt.Errorf("property %q: unsupported placement %q", name, in)
+			}
+		}
+		if wireName, ok := details["wire_name"].(string); ok && wireName != "" {
+			p.WireName = wireName
+		}
+		placements[name] = p
+	}
+	return placements, nil
+}
+
+// advertisedSchema returns a copy of the input schema without the placement
+// fields, which are an implementation detail of the HTTP request.
+func advertisedSchema(schema mcp.ToolInputSchema) mcp.ToolInputSchema {
+	if schema.Properties == nil {
+		return schema
+	}
+	properties := make(map[string]interface{}, len(schema.Properties))
+	for name, property := range schema.Properties {
+		details, ok := property.(map[string]interface{})
+		if !ok {
+			properties[name] = property
+			continue
+		}
+		cleaned := make(map[string]interface{}, len(details))
+		for k, v := range details {
+			cleaned[k] = v
+		}
+		for _, k := range placementKeys {
+			delete(cleaned, k)
+		}
+		properties[name] = cleaned
+	}
+	schema.Properties = properties
+	return schema
+}
+
+// methodHasBody reports whether arguments without an explicit placement are sent in the body.
+func methodHasBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// placeArguments distributes the arguments over the URL path, query string,
+// headers, cookies and body. Arguments without an explicit placement go to the
+// path if the URL has a matching {placeholder}, otherwise to the body for
+// methods with a body and to the query string for the others. Arguments that
+// input_schema does not declare are dropped: they have not been validated.
+// A schema without properties declares nothing, and all arguments are placed
+// by default as before.
+func placeArguments(templateURL, method string, placements map[string]placement, args map[string]interface{}) (*requestParts, error) {
+	parts := &requestParts{Headers: make(map[string]string)}
+	pathParams := make(map[string]interface{})
+	queryParams := make(map[string]interface{})
+	var body map[string]interface{}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := args[name]
+		p, ok := placements[name]
+		if !ok && len(placements) > 0 {
+			logging.Logger.Warn("Dropping undeclared argument", "argument", name)
+			continue
+		}
+		if !ok {
+			p = placement{WireName: name}
+		}
+		if p.In == "" {
+			switch {
+			case strings.Contains(templateURL, "{"+p.WireName+"}"):
+				p.In = placementPath
+			case methodHasBody(method):
+				p.In = placementBody
+			default:
+				p.In = placementQuery
+			}
+		}
+
+		switch p.In {
+		case placementPath:
+			if !strings.Contains(templateURL, "{"+p.WireName+"}") {
+				return nil, fmt.Errorf("argument %q is placed in the path but the URL has no {%s} placeholder", name, p.WireName)
+			}
+			pathParams[p.WireName] = value
+		case placementQuery:
+			queryParams[p.WireName] = value
+		case placementHeader:
+			parts.Headers[p.WireName] = formatParam(value)
+		case placementCookie:
+			parts.Cookies = append(parts.Cookies, &http.Cookie{Name: p.WireName, Value: formatParam(value)})
+		case placementBody:
+			if body == nil {
+				body = make(map[string]interface{})
+			}
+			body[p.WireName] = value
+		}
+	}
+
+	if body == nil && methodHasBody(method) {
+		body = make(map[string]interface{})
+	}
+	parts.Body = body
+
+	expandedURL, err := expandURL(templateURL, pathParams, queryParams)
+	if err != nil {
+		return nil, err
+	}
+	parts.URL = expandedURL
+	return parts, nil
+}
+
+// expandURL replaces placeholders in a URL template with the path parameters
+// and adds the query parameters. Array values become repeated query keys.
+// Placeholders are escaped as path segments before the query string and as
+// query values after it, so that values cannot add query parameters.
+func expandURL(templateURL string, pathParams, queryParams map[string]interface{}) (string, error) {
+	// Create replacers for placeholders in the path and in the query string.
+	var pathArgs, queryArgs []string
+	for k, v := range pathParams {
+		pathArgs = append(pathArgs, "{"+k+"}", url.PathEscape(formatParam(v)))
+		queryArgs = append(queryArgs, "{"+k+"}", url.QueryEscape(formatParam(v)))
+	}
+	path, query, hasQuery := strings.Cut(templateURL, "?")
+	expandedURL := strings.NewReplacer(pathArgs...).Replace(path)
+	if hasQuery {
+		expandedURL += "?" + strings.NewReplacer(queryArgs...).Replace(query)
+	}
+
+	// Parse the URL after placeholder replacement.
+	u, err := url.Parse(expandedURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL after replacement: %w", err)
+	}
+
+	// Add query parameters.
+	q := u.Query()
+	for k, v := range queryParams {
+		if values, ok := v.([]interface{}); ok {
+			q.Del(k)
+			for _, item := range values {
+				q.Add(k, formatParam(item))
+			}
+			continue
+		}
+		q.Set(k, formatParam(v))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// formatParam renders an argument value for use in a URL, header or cookie.
+func formatParam(value interface{}) string {
+	if f, ok := value.(float64); ok && f == float64(int64(f)) {
+		return fmt.Sprintf("%d", int64(f))
+	}
+	return fmt.Sprintf("%v", value)
+}
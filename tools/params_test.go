@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceArguments(t *testing.T) {
+	placements, err := parsePlacements(mcp.ToolInputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"user_id":    map[string]interface{}{"type": "string", "in": "path", "wire_name": "id"},
+			"page":       map[string]interface{}{"type": "integer", "in": "query"},
+			"tags":       map[string]interface{}{"type": "array", "in": "query", "wire_name": "tag"},
+			"request_id": map[string]interface{}{"type": "string", "in": "header", "wire_name": "X-Request-ID"},
+			"session":    map[string]interface{}{"type": "string", "in": "cookie"},
+			"name":       map[string]interface{}{"type": "string", "in": "body", "wire_name": "display_name"},
+			"email":      map[string]interface{}{"type": "string"},
+		},
+	})
+	require.NoError(t, err)
+
+	parts, err := placeArguments("https://api.example.com/users/{id}", http.MethodPut, placements, map[string]interface{}{
+		"user_id":    "42",
+		"page":       float64(2),
+		"tags":       []interface{}{"a", "b"},
+		"request_id": "req-1",
+		"session":    "s3cr3t",
+		"name":       "Alice",
+		"email":      "alice@example.com",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://api.example.com/users/42?page=2&tag=a&tag=b", parts.URL)
+	assert.Equal(t, map[string]string{"X-Request-ID": "req-1"}, parts.Headers)
+	require.Len(t, parts.Cookies, 1)
+	assert.Equal(t, "session", parts.Cookies[0].Name)
+	assert.Equal(t, map[string]interface{}{"display_name": "Alice", "email": "alice@example.com"}, parts.Body)
+
+	t.Run("default placement for GET", func(t *testing.T) {
+		placements := map[string]placement{"id": {WireName: "id"}, "sort": {WireName: "sort"}}
+		parts, err := placeArguments("https://api.example.com/users/{id}", http.MethodGet, placements, map[string]interface{}{
+			"id":   "7",
+			"sort": "name",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.example.com/users/7?sort=name", parts.URL)
+		assert.Nil(t, parts.Body)
+	})
+
+	t.Run("undeclared arguments are dropped", func(t *testing.T) {
+		parts, err := placeArguments("https://api.example.com/users", http.MethodPost, placements, map[string]interface{}{
+			"email": "alice@example.com",
+			"admin": true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.example.com/users", parts.URL)
+		assert.Equal(t, map[string]interface{}{"email": "alice@example.com"}, parts.Body)
+	})
+
+	t.Run("schema without properties passes arguments through", func(t *testing.T) {
+		parts, err := placeArguments("https://api.example.com/users/{id}", http.MethodPost, map[string]placement{}, map[string]interface{}{
+			"id":    "7",
+			"email": "alice@example.com",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.example.com/users/7", parts.URL)
+		assert.Equal(t, map[string]interface{}{"email": "alice@example.com"}, parts.Body)
+	})
+
+	t.Run("placeholders in the query string", func(t *testing.T) {
+		placements := map[string]placement{"q": {WireName: "q"}}
+		parts, err := placeArguments("https://api.example.com/search/{q}?term={q}", http.MethodGet, placements, map[string]interface{}{
+			"q": "a b&admin=true",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "https://api.example.com/search/a%20b&admin=true?term=a+b%26admin%3Dtrue", parts.URL)
+	})
+
+	t.Run("path placement without placeholder", func(t *testing.T) {
+		_, err := placeArguments("https://api.example.com/users", http.MethodGet, placements, map[string]interface{}{"user_id": "1"})
+		require.Error(t, err)
+	})
+
+	t.Run("unsupported placement", func(t *testing.T) {
+		_, err := parsePlacements(mcp.ToolInputSchema{Properties: map[string]interface{}{
+			"x": map[string]interface{}{"in": "fragment"},
+		}})
+		require.Error(t, err)
+	})
+}
+
+func TestGenericToolParameterPlacement(t *testing.T) {
+	var received struct {
+		path, query, header string
+		body                map[string]interface{}
+	}
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.path = r.URL.Path
+		received.query = r.URL.RawQuery
+		received.header = r.Header.Get("X-Tenant")
+		body, _ := io.ReadAll(r.Body)
+		received.body = nil
+		json.Unmarshal(body, &received.body)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer mockAPIServer.Close()
+
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{{
+		ToolName:    "update_user",
+		Description: "Update a user",
+		Request:     hyancieMCP.RequestConfig{Method: "POST", URL: mockAPIServer.URL + "/users/{id}"},
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"id":     map[string]interface{}{"type": "string", "in": "path"},
+				"tenant": map[string]interface{}{"type": "string", "in": "header", "wire_name": "X-Tenant"},
+				"notify": map[string]interface{}{"type": "boolean", "in": "query"},
+				"name":   map[string]interface{}{"type": "string"},
+			},
+		},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "status", Description: "Status", Type: "primitive"}},
+	}}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	handler := getToolHandler(s, "update_user")
+	require.NotNil(t, handler)
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{
+		"id":     "42",
+		"tenant": "acme",
+		"notify": true,
+		"name":   "Alice",
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, "Status:ok", joinContents(result.Content))
+	assert.Equal(t, "/users/42", received.path)
+	assert.Equal(t, "notify=true", received.query)
+	assert.Equal(t, "acme", received.header)
+	assert.Equal(t, map[string]interface{}{"name": "Alice"}, received.body)
+
+	// Placement fields are not advertised to clients.
+	tool := newGenericTool(hyancieMCP.Config, hyancieMCP.Config.McpTools[0]).Tool
+	assert.NotContains(t, tool.InputSchema.Properties["tenant"], "in")
+	assert.NotContains(t, tool.InputSchema.Properties["tenant"], "wire_name")
+}
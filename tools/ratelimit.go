@@ -0,0 +1,372 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// inFlightRetryAfter is suggested to callers rejected by a concurrency cap.
+const inFlightRetryAfter = time.Second
+
+// RateLimiter is tool handler middleware that enforces the rate_limits
+// config: token buckets and concurrency caps per tool, per upstream host and
+// per client session. Being middleware, it also covers tools written in Go.
+//
+// A call is admitted with one token of every bucket that applies to it.
+// Generic tools take a further token for every other upstream request they
+// send (retries, pages, steps and images), waiting for it if needed.
+type RateLimiter struct {
+	mu        sync.Mutex
+	config    *hyancie.RateLimitsConfig
+	toolHosts map[string][]string // Upstream hosts of each generic tool and its steps
+	buckets   map[string]*tokenBucket
+	inFlight  map[string]int
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter returns a rate limiter without limits; call Update to configure it.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets:  make(map[string]*tokenBucket),
+		inFlight: make(map[string]int),
+		now:      time.Now,
+	}
+}
+
+// Update applies the rate_limits of a (re-)loaded config. Buckets whose
+// limits did not change keep their state.
+func (l *RateLimiter) Update(config *hyancie.ConfigType) {
+	toolHosts := make(map[string][]string, len(config.McpTools))
+	for _, tool := range config.McpTools {
+		urls := []string{tool.Request.URL}
+		for _, step := range tool.Steps {
+			urls = append(urls, step.Request.URL)
+		}
+		for _, rawURL := range urls {
+			if host := upstreamHost(rawURL); host != "" && !slices.Contains(toolHosts[tool.ToolName], host) {
+				toolHosts[tool.ToolName] = append(toolHosts[tool.ToolName], host)
+			}
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config.RateLimits
+	l.toolHosts = toolHosts
+}
+
+// Middleware is a server.ToolHandlerMiddleware that rejects calls exceeding a
+// limit with a "rate limited" error result instead of calling the tool.
+func (l *RateLimiter) Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sessionID := sessionIDFromContext(ctx)
+		release, denial := l.acquire(request.Params.Name, sessionID)
+		if denial != nil {
+			logging.Logger.Warn("Tool call rate limited", "tool_name", request.Params.Name, "limit", denial.scope, "key", denial.key, "retry_after_seconds", denial.retryAfterSeconds())
+			return denial.result(), nil
+		}
+		defer release()
+		call := &callLimits{limiter: l, toolName: request.Params.Name, sessionID: sessionID, prepaid: l.hostsOf(request.Params.Name)}
+		return next(context.WithValue(ctx, callLimitsKey{}, call), request)
+	}
+}
+
+// limitScope is one limit that applies to a call.
+type limitScope struct {
+	scope string // "tool", "host" or "session"
+	key   string
+	limit hyancie.RateLimitConfig
+}
+
+func (s limitScope) id() string {
+	return s.scope + ":" + s.key
+}
+
+// rateLimitDenial describes why a call was rejected.
+type rateLimitDenial struct {
+	scope, key string
+	retryAfter time.Duration
+}
+
+func (d *rateLimitDenial) retryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(d.retryAfter.Seconds())))
+}
+
+// result builds the error result returned to the client. The metadata lets
+// clients back off without parsing the text.
+func (d *rateLimitDenial) result() *mcp.CallToolResult {
+	result := mcp.NewToolResultError(fmt.Sprintf("rate limited by the %s limit for %q, retry after %d s", d.scope, d.key, d.retryAfterSeconds()))
+	result.Meta = map[string]interface{}{
+		"rateLimited":       true,
+		"limit":             d.scope,
+		"key":               d.key,
+		"retryAfterSeconds": d.retryAfterSeconds(),
+	}
+	return result
+}
+
+// scopes returns the limits that apply to a call of the tool from the session.
+func (l *RateLimiter) scopes(toolName, sessionID string) []limitScope {
+	if l.config == nil {
+		return nil
+	}
+	var scopes []limitScope
+	if limit, ok := l.config.Tools[toolName]; ok {
+		scopes = append(scopes, limitScope{"tool", toolName, limit})
+	} else if limit, ok := l.config.Tools["*"]; ok {
+		scopes = append(scopes, limitScope{"tool", toolName, limit})
+	}
+	for _, host := range l.toolHosts[toolName] {
+		if limit, ok := l.config.Hosts[host]; ok {
+			scopes = append(scopes, limitScope{"host", host, limit})
+		}
+	}
+	if l.config.PerSession != nil && sessionID != "" {
+		scopes = append(scopes, limitScope{"session", sessionID, *l.config.PerSession})
+	}
+	return scopes
+}
+
+// acquire takes a token from every applicable bucket and an in-flight slot
+// from every applicable cap, or nothing if any of them is exhausted.
+func (l *RateLimiter) acquire(toolName, sessionID string) (func(), *rateLimitDenial) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	scopes := l.scopes(toolName, sessionID)
+
+	var denial *rateLimitDenial
+	for _, s := range scopes {
+		if s.limit.MaxInFlight > 0 && l.inFlight[s.id()] >= s.limit.MaxInFlight {
+			return nil, &rateLimitDenial{scope: s.scope, key: s.key, retryAfter: inFlightRetryAfter}
+		}
+		if s.limit.RequestsPerSecond <= 0 {
+			continue
+		}
+		bucket := l.bucket(s, now)
+		if wait := bucket.wait(); wait > 0 && (denial == nil || wait > denial.retryAfter) {
+			denial = &rateLimitDenial{scope: s.scope, key: s.key, retryAfter: wait}
+		}
+	}
+	if denial != nil {
+		return nil, denial
+	}
+
+	var held []string
+	for _, s := range scopes {
+		if s.limit.RequestsPerSecond > 0 {
+			l.buckets[s.id()].tokens--
+		}
+		if s.limit.MaxInFlight > 0 {
+			l.inFlight[s.id()]++
+			held = append(held, s.id())
+		}
+	}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, id := range held {
+			if l.inFlight[id]--; l.inFlight[id] <= 0 {
+				delete(l.inFlight, id)
+			}
+		}
+	}, nil
+}
+
+// hostsOf returns the set of upstream hosts of a tool.
+func (l *RateLimiter) hostsOf(toolName string) map[string]bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hosts := make(map[string]bool, len(l.toolHosts[toolName]))
+	for _, host := range l.toolHosts[toolName] {
+		hosts[host] = true
+	}
+	return hosts
+}
+
+// callLimitsKey is the context key of the callLimits of a tool call.
+type callLimitsKey struct{}
+
+// callLimits charges the upstream requests of an admitted tool call. The
+// admission paid for the first request and for one request to each of the
+// tool's hosts; later requests take a token of their own.
+type callLimits struct {
+	limiter   *RateLimiter
+	toolName  string
+	sessionID string
+	requests  int
+	prepaid   map[string]bool // Hosts whose admission token is unused
+}
+
+// waitForUpstream charges an upstream request to host against the rate
+// limits of the tool call in ctx, waiting until every bucket has a token.
+// Requests outside of a rate limited tool call are not charged.
+func waitForUpstream(ctx context.Context, host string) error {
+	call, ok := ctx.Value(callLimitsKey{}).(*callLimits)
+	if !ok {
+		return nil
+	}
+	host = strings.ToLower(host)
+	l := call.limiter
+	for {
+		l.mu.Lock()
+		wait, scope := call.take(host, l.now())
+		l.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		logging.Logger.Info("Waiting for rate limit", "tool_name", call.toolName, "limit", scope.scope, "key", scope.key, "wait", wait.String())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("rate limited by the %s limit for %q: %w", scope.scope, scope.key, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// take consumes a token of every bucket that applies to the next request of
+// the call, or returns how long to wait for the scarcest one. The caller
+// holds the limiter's lock.
+func (c *callLimits) take(host string, now time.Time) (time.Duration, limitScope) {
+	l := c.limiter
+	if l.config == nil {
+		return 0, limitScope{}
+	}
+	var scopes []limitScope
+	if c.requests > 0 {
+		for _, s := range l.scopes(c.toolName, c.sessionID) {
+			if s.scope != "host" {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	if limit, ok := l.config.Hosts[host]; ok && !c.prepaid[host] {
+		scopes = append(scopes, limitScope{"host", host, limit})
+	}
+
+	var wait time.Duration
+	var scarcest limitScope
+	for _, s := range scopes {
+		if s.limit.RequestsPerSecond <= 0 {
+			continue
+		}
+		if w := l.bucket(s, now).wait(); w > wait {
+			wait, scarcest = w, s
+		}
+	}
+	if wait > 0 {
+		return wait, scarcest
+	}
+	for _, s := range scopes {
+		if s.limit.RequestsPerSecond > 0 {
+			l.buckets[s.id()].tokens--
+		}
+	}
+	c.requests++
+	delete(c.prepaid, host)
+	return 0, limitScope{}
+}
+
+// bucket returns the refilled bucket of the scope, replacing it if its limit changed.
+func (l *RateLimiter) bucket(s limitScope, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[s.id()]
+	if !ok || bucket.limit != s.limit {
+		bucket = newTokenBucket(s.limit, now)
+		l.buckets[s.id()] = bucket
+	}
+	bucket.refill(now)
+	return bucket
+}
+
+// prune drops full buckets once a minute; they are equivalent to new ones.
+// This keeps buckets of ended sessions from accumulating.
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for id, bucket := range l.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= bucket.burst {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// tokenBucket holds up to burst tokens, refilled at the configured rate.
+type tokenBucket struct {
+	limit  hyancie.RateLimitConfig
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit hyancie.RateLimitConfig, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+	return &tokenBucket{limit: limit, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.limit.RequestsPerSecond)
+		b.last = now
+	}
+}
+
+// wait returns how long until a token is available.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.RequestsPerSecond * float64(time.Second))
+}
+
+// sessionIDFromContext returns the ID of the calling client session, if any.
+func sessionIDFromContext(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// upstreamHost returns the lower-cased host name of a request URL template,
+// which may contain {placeholders} and is therefore not parsed with net/url.
+func upstreamHost(rawURL string) string {
+	_, rest, found := strings.Cut(rawURL, "://")
+	if !found {
+		return ""
+	}
+	if end := strings.IndexAny(rest, "/?#"); end >= 0 {
+		rest = rest[:end]
+	}
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		rest = rest[at+1:]
+	}
+	if strings.HasPrefix(rest, "[") {
+		if end := strings.Index(rest, "]"); end >= 0 {
+			return strings.ToLower(rest[1:end])
+		}
+	}
+	if colon := strings.LastIndex(rest, ":"); colon >= 0 {
+		rest = rest[:colon]
+	}
+	return strings.ToLower(rest)
+}
@@ -0,0 +1,271 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedSession is a client session with a configurable ID.
+type namedSession struct {
+	notifyingSession
+	id string
+}
+
+func (s *namedSession) SessionID() string { return s.id }
+
+// rateLimitedServer returns a server whose tools are throttled by limiter.
+func rateLimitedServer(limiter *RateLimiter, handler server.ToolHandlerFunc, names ...string) *server.MCPServer {
+	s := server.NewMCPServer("test", "1.0", server.WithToolHandlerMiddleware(limiter.Middleware))
+	for _, name := range names {
+		s.AddTool(mcp.NewTool(name), handler)
+	}
+	return s
+}
+
+// callTool sends tools/call through the server, so that middleware applies.
+func callTool(t *testing.T, ctx context.Context, s *server.MCPServer, name string) mcp.CallToolResult {
+	t.Helper()
+	response := s.HandleMessage(ctx, json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "`+name+`"}}`))
+	result, ok := response.(mcp.JSONRPCResponse)
+	require.True(t, ok, "%#v", response)
+	return result.Result.(mcp.CallToolResult)
+}
+
+func okHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return mcp.NewToolResultText("ok"), nil
+}
+
+func TestRateLimiterTokenBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := NewRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limiter.Update(&hyancieMCP.ConfigType{
+		McpTools: []hyancieMCP.GenericToolConfig{
+			{ToolName: "weather_a", Request: hyancieMCP.RequestConfig{URL: "https://api.weather.example.com:8443/a/{city}"}},
+			{ToolName: "weather_b", Request: hyancieMCP.RequestConfig{URL: "https://API.weather.example.com/b"}},
+		},
+		RateLimits: &hyancieMCP.RateLimitsConfig{
+			Tools: map[string]hyancieMCP.RateLimitConfig{
+				"search":    {RequestsPerSecond: 1, Burst: 2},
+				"weather_a": {RequestsPerSecond: 1},
+				"weather_b": {RequestsPerSecond: 10},
+				"*":         {RequestsPerSecond: 0.5},
+			},
+			Hosts: map[string]hyancieMCP.RateLimitConfig{
+				"api.weather.example.com": {RequestsPerSecond: 1, Burst: 3},
+			},
+		},
+	})
+	s := rateLimitedServer(limiter, okHandler, "search", "weather_a", "weather_b", "translate")
+	ctx := context.Background()
+
+	t.Run("per tool", func(t *testing.T) {
+		assert.False(t, callTool(t, ctx, s, "search").IsError)
+		assert.False(t, callTool(t, ctx, s, "search").IsError)
+
+		result := callTool(t, ctx, s, "search")
+		require.True(t, result.IsError)
+		assert.Equal(t, "rate limited by the tool limit for \"search\", retry after 1 s", result.Content[0].(mcp.TextContent).Text)
+		assert.Equal(t, map[string]interface{}{"rateLimited": true, "limit": "tool", "key": "search", "retryAfterSeconds": 1}, result.Meta)
+
+		now = now.Add(time.Second)
+		assert.False(t, callTool(t, ctx, s, "search").IsError)
+	})
+
+	t.Run("wildcard applies to each tool separately", func(t *testing.T) {
+		assert.False(t, callTool(t, ctx, s, "translate").IsError)
+		result := callTool(t, ctx, s, "translate")
+		require.True(t, result.IsError)
+		assert.Equal(t, 2, result.Meta["retryAfterSeconds"])
+	})
+
+	t.Run("per upstream host", func(t *testing.T) {
+		now = now.Add(10 * time.Second)
+		assert.False(t, callTool(t, ctx, s, "weather_a").IsError)
+		assert.False(t, callTool(t, ctx, s, "weather_b").IsError)
+
+		// weather_a's own limit is exhausted, which must not use up a host token.
+		result := callTool(t, ctx, s, "weather_a")
+		require.True(t, result.IsError)
+		assert.Equal(t, "tool", result.Meta["limit"])
+
+		now = now.Add(time.Second)
+		assert.False(t, callTool(t, ctx, s, "weather_a").IsError)
+		assert.False(t, callTool(t, ctx, s, "weather_b").IsError)
+		result = callTool(t, ctx, s, "weather_b")
+		require.True(t, result.IsError)
+		assert.Equal(t, "host", result.Meta["limit"])
+		assert.Equal(t, "api.weather.example.com", result.Meta["key"])
+	})
+}
+
+func TestRateLimiterSessionsAndConcurrency(t *testing.T) {
+	limiter := NewRateLimiter()
+	limiter.Update(&hyancieMCP.ConfigType{RateLimits: &hyancieMCP.RateLimitsConfig{
+		Tools:      map[string]hyancieMCP.RateLimitConfig{"slow": {MaxInFlight: 1}},
+		PerSession: &hyancieMCP.RateLimitConfig{RequestsPerSecond: 1},
+	}})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.Params.Name == "slow" {
+			close(started)
+			<-release
+		}
+		return mcp.NewToolResultText("ok"), nil
+	}
+	s := rateLimitedServer(limiter, handler, "slow", "fast")
+	alice := s.WithContext(context.Background(), &namedSession{id: "alice"})
+	bob := s.WithContext(context.Background(), &namedSession{id: "bob"})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.False(t, callTool(t, alice, s, "slow").IsError)
+	}()
+	<-started
+
+	// Bob's session still has a token, but the slow tool is busy.
+	result := callTool(t, bob, s, "slow")
+	require.True(t, result.IsError)
+	assert.Equal(t, "tool", result.Meta["limit"])
+
+	// The concurrency denial did not consume Bob's session token.
+	assert.False(t, callTool(t, bob, s, "fast").IsError)
+	result = callTool(t, bob, s, "fast")
+	require.True(t, result.IsError)
+	assert.Equal(t, "session", result.Meta["limit"])
+	assert.Equal(t, "bob", result.Meta["key"])
+
+	close(release)
+	wg.Wait()
+	assert.Empty(t, limiter.inFlight)
+}
+
+func TestUpstreamHost(t *testing.T) {
+	for rawURL, expected := range map[string]string{
+		"https://api.example.com/v1/{id}":     "api.example.com",
+		"http://user:pw@API.example.com:8080": "api.example.com",
+		"https://{region}.example.com/x":      "{region}.example.com",
+		"http://[::1]:9000/x":                 "::1",
+		"not a url":                           "",
+	} {
+		assert.Equal(t, expected, upstreamHost(rawURL), rawURL)
+	}
+}
+
+func TestRateLimiterUpstreamRequests(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		if r.URL.Path == "/unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer api.Close()
+
+	flow := hyancieMCP.GenericToolConfig{
+		ToolName:    "flow",
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		Steps: []hyancieMCP.StepConfig{
+			{Name: "first", Request: hyancieMCP.RequestConfig{Method: "GET", URL: api.URL + "/first"}},
+			{Name: "second", Request: hyancieMCP.RequestConfig{Method: "GET", URL: api.URL + "/second"}},
+		},
+	}
+	retrying := hyancieMCP.GenericToolConfig{
+		ToolName:    "retrying",
+		Request:     hyancieMCP.RequestConfig{Method: "GET", URL: api.URL + "/unavailable"},
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		Retry:       &hyancieMCP.RetryConfig{MaxAttempts: 3, Backoff: &hyancieMCP.BackoffConfig{Initial: "1ms", Max: "1ms"}},
+	}
+	global := &hyancieMCP.ConfigType{
+		McpTools: []hyancieMCP.GenericToolConfig{flow, retrying},
+		RateLimits: &hyancieMCP.RateLimitsConfig{
+			Tools: map[string]hyancieMCP.RateLimitConfig{"retrying": {RequestsPerSecond: 0.1}},
+			Hosts: map[string]hyancieMCP.RateLimitConfig{"127.0.0.1": {RequestsPerSecond: 0.1}},
+		},
+	}
+	limiter := NewRateLimiter()
+	limiter.Update(global)
+
+	call := func(config hyancieMCP.GenericToolConfig) (*mcp.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		handler := limiter.Middleware(newGenericToolHandler(global, config))
+		return handler(ctx, mcp.CallToolRequest{Params: mcp.CallToolParams{Name: config.ToolName}})
+	}
+
+	t.Run("every step takes a token of its host", func(t *testing.T) {
+		// The admission paid for the first step; the second one waits for a token.
+		_, err := call(flow)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `step "second": rate limited by the host limit for "127.0.0.1"`)
+		assert.Equal(t, 1, requests)
+
+		// The host of the steps is checked on admission.
+		result, err := call(flow)
+		require.NoError(t, err)
+		require.True(t, result.IsError)
+		assert.Equal(t, "host", result.Meta["limit"])
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("every retry takes a token of the tool", func(t *testing.T) {
+		limiter.Update(&hyancieMCP.ConfigType{McpTools: global.McpTools, RateLimits: &hyancieMCP.RateLimitsConfig{Tools: global.RateLimits.Tools}})
+		requests = 0
+		_, err := call(retrying)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `rate limited by the tool limit for "retrying"`)
+		assert.Equal(t, 1, requests)
+	})
+}
+
+func TestRateLimiterWaitOutsideRequestTimeout(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer api.Close()
+
+	flow := hyancieMCP.GenericToolConfig{
+		ToolName:    "flow",
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		Steps: []hyancieMCP.StepConfig{
+			{Name: "first", Request: hyancieMCP.RequestConfig{Method: "GET", URL: api.URL + "/first", Timeout: "50ms"}},
+			{Name: "second", Request: hyancieMCP.RequestConfig{Method: "GET", URL: api.URL + "/second", Timeout: "50ms"}},
+		},
+	}
+	global := &hyancieMCP.ConfigType{
+		McpTools:   []hyancieMCP.GenericToolConfig{flow},
+		RateLimits: &hyancieMCP.RateLimitsConfig{Hosts: map[string]hyancieMCP.RateLimitConfig{"127.0.0.1": {RequestsPerSecond: 5, Burst: 1}}},
+	}
+	limiter := NewRateLimiter()
+	limiter.Update(global)
+
+	// The second step waits about 200ms for a token, longer than its timeout.
+	handler := limiter.Middleware(newGenericToolHandler(global, flow))
+	start := time.Now()
+	result, err := handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Name: "flow"}})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	steps := result.Meta["steps"].([]interface{})
+	assert.Equal(t, "ok", steps[1].(map[string]interface{})["status"])
+}
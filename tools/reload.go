@@ -0,0 +1,67 @@
+package tools
+
+import (
+	"reflect"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// ReloadGenericTools diffs the previous and next tool configs and updates the
+// MCP server accordingly: removed tools are deleted, new and changed tools are
+// (re-)registered. When a global setting shared by all tools changes, every
+// tool is replaced, and so is a tool whose CA bundle or client certificate
+// changed on disk. The server sends notifications/tools/list_changed to all
+// connected sessions whenever the tool list is modified.
+//
+// It returns the names of the added, removed and replaced tools.
+func ReloadGenericTools(s *server.MCPServer, previousConfig, nextConfig *hyancie.ConfigType) (added, removed, replaced []string) {
+	previous, next := previousConfig.McpTools, nextConfig.McpTools
+	sharedChanged := !reflect.DeepEqual(sharedToolSettings(previousConfig), sharedToolSettings(nextConfig))
+	staleClients := staleHTTPClients(nextConfig)
+
+	previousByName := make(map[string]hyancie.GenericToolConfig, len(previous))
+	for _, config := range previous {
+		previousByName[config.ToolName] = config
+	}
+
+	var toRegister []server.ServerTool
+	nextNames := make(map[string]bool, len(next))
+	for _, config := range next {
+		nextNames[config.ToolName] = true
+		old, existed := previousByName[config.ToolName]
+		switch {
+		case !existed:
+			added = append(added, config.ToolName)
+		case sharedChanged || staleClients[config.ToolName] || !reflect.DeepEqual(old, config):
+			replaced = append(replaced, config.ToolName)
+		default:
+			continue
+		}
+		toRegister = append(toRegister, newGenericTool(nextConfig, config))
+	}
+
+	for _, config := range previous {
+		if !nextNames[config.ToolName] {
+			removed = append(removed, config.ToolName)
+		}
+	}
+
+	if len(removed) > 0 {
+		s.DeleteTools(removed...)
+	}
+	if len(toRegister) > 0 {
+		s.AddTools(toRegister...)
+	}
+	pruneHTTPClients(nextConfig)
+	pruneAuthenticators(nextConfig)
+
+	logging.Logger.Info("Generic tools reloaded", "added", added, "removed", removed, "replaced", replaced)
+	return added, removed, replaced
+}
+
+// sharedToolSettings returns the global settings that every tool handler depends on.
+func sharedToolSettings(c *hyancie.ConfigType) []interface{} {
+	return []interface{}{c.Timeout, c.Retry, c.HTTPClient, c.HTTPClients, c.AuthProfiles, c.OutputStyle}
+}
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifyingSession is a minimal client session that records notifications.
+type notifyingSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *notifyingSession) SessionID() string { return "reload-test" }
+func (s *notifyingSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+func (s *notifyingSession) Initialize()       {}
+func (s *notifyingSession) Initialized() bool { return true }
+
+func TestReloadGenericTools(t *testing.T) {
+	makeTool := func(name, url string) hyancieMCP.GenericToolConfig {
+		return hyancieMCP.GenericToolConfig{
+			ToolName:    name,
+			Description: name,
+			Request:     hyancieMCP.RequestConfig{Method: "GET", URL: url},
+			InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		}
+	}
+
+	previous := []hyancieMCP.GenericToolConfig{
+		makeTool("kept", "http://example.com/kept"),
+		makeTool("changed", "http://example.com/old"),
+		makeTool("removed", "http://example.com/removed"),
+	}
+	next := []hyancieMCP.GenericToolConfig{
+		makeTool("kept", "http://example.com/kept"),
+		makeTool("changed", "http://example.com/new"),
+		makeTool("added", "http://example.com/added"),
+	}
+
+	hyancieMCP.Config.McpTools = previous
+	s := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(true))
+	require.NoError(t, AddGenericTools(s))
+
+	session := &notifyingSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	require.NoError(t, s.RegisterSession(context.Background(), session))
+
+	added, removed, replaced := ReloadGenericTools(s, &hyancieMCP.ConfigType{McpTools: previous}, &hyancieMCP.ConfigType{McpTools: next})
+	assert.Equal(t, []string{"added"}, added)
+	assert.Equal(t, []string{"removed"}, removed)
+	assert.Equal(t, []string{"changed"}, replaced)
+
+	assert.NotNil(t, getToolHandler(s, "kept"))
+	assert.NotNil(t, getToolHandler(s, "changed"))
+	assert.NotNil(t, getToolHandler(s, "added"))
+	assert.Nil(t, getToolHandler(s, "removed"))
+
+	require.NotEmpty(t, session.notifications)
+	notification := <-session.notifications
+	assert.Equal(t, mcp.MethodNotificationToolsListChanged, notification.Method)
+
+	// Reloading an identical config must not touch the server.
+	for len(session.notifications) > 0 {
+		<-session.notifications
+	}
+	added, removed, replaced = ReloadGenericTools(s, &hyancieMCP.ConfigType{McpTools: next}, &hyancieMCP.ConfigType{McpTools: next})
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+	assert.Empty(t, replaced)
+	assert.Empty(t, session.notifications)
+
+	// Changing a global tool setting replaces every tool.
+	added, removed, replaced = ReloadGenericTools(s, &hyancieMCP.ConfigType{McpTools: next}, &hyancieMCP.ConfigType{Timeout: "5s", McpTools: next})
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+	assert.ElementsMatch(t, []string{"kept", "changed", "added"}, replaced)
+}
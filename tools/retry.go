@@ -0,0 +1,317 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+)
+
+const (
+	// defaultTimeout bounds a single upstream attempt when no timeout is configured.
+	defaultTimeout = 30 * time.Second
+	// defaultBackoff is the first delay between attempts.
+	defaultBackoff = 200 * time.Millisecond
+	// defaultMaxBackoff caps a single computed delay.
+	defaultMaxBackoff = 10 * time.Second
+	// maxRetryAfter caps the delay requested by an upstream Retry-After header.
+	maxRetryAfter = time.Minute
+)
+
+// defaultRetryStatus lists the status codes retried when on_status is not configured.
+var defaultRetryStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// retryPolicy is the resolved timeout and retry behaviour of a tool.
+type retryPolicy struct {
+	timeout            time.Duration
+	maxAttempts        int
+	initialBackoff     time.Duration
+	maxBackoff         time.Duration
+	multiplier         float64
+	onStatus           map[int]bool
+	allowNonIdempotent bool
+	bodyLimit          func(header http.Header) int64 // Largest body read for a response, 0 for no limit
+}
+
+// newRetryPolicy merges the global and per-tool settings; per-tool values win field by field.
+func newRetryPolicy(global *hyancie.ConfigType, config hyancie.GenericToolConfig) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		timeout:        defaultTimeout,
+		maxAttempts:    1,
+		initialBackoff: defaultBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		multiplier:     2,
+		onStatus:       make(map[int]bool),
+	}
+
+	for _, timeout := range []string{global.Timeout, config.Request.Timeout} {
+		if timeout == "" {
+			continue
+		}
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q: %w", timeout, err)
+		}
+		policy.timeout = d
+	}
+
+	onStatus := defaultRetryStatus
+	for _, retry := range []*hyancie.RetryConfig{global.Retry, config.Retry} {
+		if retry == nil {
+			continue
+		}
+		if retry.MaxAttempts > 0 {
+			policy.maxAttempts = retry.MaxAttempts
+		}
+		if len(retry.OnStatus) > 0 {
+			onStatus = retry.OnStatus
+		}
+		if retry.AllowNonIdempotent {
+			policy.allowNonIdempotent = true
+		}
+		if retry.Backoff == nil {
+			continue
+		}
+		if retry.Backoff.Initial != "" {
+			d, err := time.ParseDuration(retry.Backoff.Initial)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry.backoff.initial %q: %w", retry.Backoff.Initial, err)
+			}
+			policy.initialBackoff = d
+		}
+		if retry.Backoff.Max != "" {
+			d, err := time.ParseDuration(retry.Backoff.Max)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry.backoff.max %q: %w", retry.Backoff.Max, err)
+			}
+			policy.maxBackoff = d
+		}
+		if retry.Backoff.Multiplier > 0 {
+			policy.multiplier = retry.Backoff.Multiplier
+		}
+	}
+	for _, status := range onStatus {
+		policy.onStatus[status] = true
+	}
+	return policy, nil
+}
+
+// isIdempotent reports whether a method can be safely repeated.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// upstreamResponse is a fully read upstream response.
+type upstreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Attempts   int
+	Request    *http.Request // The last request sent, after redirects
+}
+
+// requestBuilder creates a fresh request for every attempt, so that the body can be re-sent.
+type requestBuilder func(ctx context.Context) (*http.Request, error)
+
+// send performs the request with the policy's per-attempt timeout, retrying
+// network errors and the configured status codes with exponential backoff.
+// Only idempotent methods are retried unless allowNonIdempotent is set.
+func (p *retryPolicy) send(ctx context.Context, client *http.Client, method string, build requestBuilder) (*upstreamResponse, error) {
+	attempts := p.maxAttempts
+	if !isIdempotent(method) && !p.allowNonIdempotent {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		resp, err := p.attempt(ctx, client, build)
+		if resp != nil {
+			resp.Attempts = attempt
+		}
+
+		retryable := false
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			lastErr = err
+			// Do not retry when the caller gave up or the response is too large.
+			retryable = ctx.Err() == nil && !errors.Is(err, errResponseTooLarge)
+		case p.onStatus[resp.StatusCode]:
+			retryable = true
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		default:
+			return resp, nil
+		}
+
+		if !retryable || attempt >= attempts {
+			if err != nil {
+				return nil, lastErr
+			}
+			return resp, nil
+		}
+
+		delay := p.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if err != nil {
+			logging.Logger.Warn("HTTP request failed, retrying", "attempt", attempt, "delay", delay.String(), "error", err)
+		} else {
+			logging.Logger.Warn("HTTP request returned retryable status, retrying", "attempt", attempt, "status_code", resp.StatusCode, "delay", delay.String())
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err == nil {
+				return resp, nil
+			}
+			return nil, lastErr
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a single request and reads the whole response body within the timeout.
+func (p *retryPolicy) attempt(ctx context.Context, client *http.Client, build requestBuilder) (*upstreamResponse, error) {
+	req, err := build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Waiting for a rate limit token does not count against the timeout of
+	// the request.
+	if err := waitForUpstream(ctx, req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	if p.timeout > 0 {
+		attemptCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+		req = req.WithContext(attemptCtx)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("http request timed out after %s: %w", p.timeout, err)
+		}
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := p.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &upstreamResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body, Request: resp.Request}, nil
+}
+
+// readBody reads the response body, up to the policy's body limit. Bodies
+// beyond it are rejected by their Content-Length or once the limit is passed,
+// without reading the rest.
+func (p *retryPolicy) readBody(resp *http.Response) ([]byte, error) {
+	var limit int64
+	if p.bodyLimit != nil {
+		limit = p.bodyLimit(resp.Header)
+	}
+	if limit <= 0 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		return body, nil
+	}
+
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("binary response of %d bytes %w (%d)", resp.ContentLength, errResponseTooLarge, limit)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("binary response %w (%d)", errResponseTooLarge, limit)
+	}
+	return body, nil
+}
+
+// backoff returns the delay after the given attempt: exponential growth capped
+// at maxBackoff, with "equal jitter" (a random value between half and the full delay).
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.initialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.multiplier
+		if delay >= float64(p.maxBackoff) {
+			break
+		}
+	}
+	if delay > float64(p.maxBackoff) {
+		delay = float64(p.maxBackoff)
+	}
+	half := delay / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = time.Until(at)
+	}
+	if delay < 0 {
+		return 0
+	}
+	if delay > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return delay
+}
+
+// newBodyBuilder returns a request builder that re-creates the request with
+// the given payload for every attempt and lets configure set its headers.
+func newBodyBuilder(method, url string, payload []byte, configure func(*http.Request) error) requestBuilder {
+	return func(ctx context.Context) (*http.Request, error) {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create http request: %w", err)
+		}
+		if err := configure(req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+}
+
+// withHeaders returns a request builder that adds the headers to the requests of build.
+func withHeaders(build requestBuilder, header http.Header) requestBuilder {
+	return func(ctx context.Context) (*http.Request, error) {
+		req, err := build(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = append([]string(nil), values...)
+		}
+		return req, nil
+	}
+}
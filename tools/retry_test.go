@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetryTestHandler registers a single tool against url and returns its handler.
+func newRetryTestHandler(t *testing.T, method, url string, retry *hyancieMCP.RetryConfig, timeout string) toolHandler {
+	t.Helper()
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{{
+		ToolName:      "flaky",
+		Description:   "Flaky upstream",
+		Request:       hyancieMCP.RequestConfig{Method: method, URL: url, Timeout: timeout},
+		InputSchema:   mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{}},
+		OutputMapping: []hyancieMCP.OutputMap{{JsonKey: "status", Description: "Status", Type: "primitive"}},
+		Retry:         retry,
+	}}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	handler := getToolHandler(s, "flaky")
+	require.NotNil(t, handler)
+	return handler
+}
+
+func TestGenericToolRetry(t *testing.T) {
+	fastBackoff := &hyancieMCP.BackoffConfig{Initial: "1ms", Max: "5ms"}
+
+	t.Run("retries retryable status until success", func(t *testing.T) {
+		var calls int32
+		mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"status": "ok"}`))
+		}))
+		defer mockAPIServer.Close()
+
+		handler := newRetryTestHandler(t, "GET", mockAPIServer.URL, &hyancieMCP.RetryConfig{MaxAttempts: 3, Backoff: fastBackoff}, "")
+		result, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "Status:ok", joinContents(result.Content))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var calls int32
+		mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer mockAPIServer.Close()
+
+		handler := newRetryTestHandler(t, "GET", mockAPIServer.URL, &hyancieMCP.RetryConfig{MaxAttempts: 2, Backoff: fastBackoff}, "")
+		_, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "status 502")
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("does not retry non-idempotent methods by default", func(t *testing.T) {
+		var calls int32
+		mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer mockAPIServer.Close()
+
+		handler := newRetryTestHandler(t, "POST", mockAPIServer.URL, &hyancieMCP.RetryConfig{MaxAttempts: 3, Backoff: fastBackoff}, "")
+		_, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		handler = newRetryTestHandler(t, "POST", mockAPIServer.URL, &hyancieMCP.RetryConfig{MaxAttempts: 3, Backoff: fastBackoff, AllowNonIdempotent: true}, "")
+		_, err = handler(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("honors on_status and Retry-After", func(t *testing.T) {
+		var calls int32
+		var first, second time.Time
+		mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				first = time.Now()
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			second = time.Now()
+			w.Write([]byte(`{"status": "ok"}`))
+		}))
+		defer mockAPIServer.Close()
+
+		handler := newRetryTestHandler(t, "GET", mockAPIServer.URL, &hyancieMCP.RetryConfig{MaxAttempts: 2, Backoff: fastBackoff, OnStatus: []int{http.StatusConflict}}, "")
+		result, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "Status:ok", joinContents(result.Content))
+		assert.GreaterOrEqual(t, second.Sub(first), 900*time.Millisecond)
+	})
+
+	t.Run("times out slow upstreams", func(t *testing.T) {
+		release := make(chan struct{})
+		mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer mockAPIServer.Close()
+		defer close(release)
+
+		handler := newRetryTestHandler(t, "GET", mockAPIServer.URL, nil, "50ms")
+		_, err := handler(context.Background(), mcp.CallToolRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "timed out")
+	})
+}
+
+func TestRetryPolicyMerge(t *testing.T) {
+	global := &hyancieMCP.ConfigType{
+		Timeout: "5s",
+		Retry:   &hyancieMCP.RetryConfig{MaxAttempts: 4, Backoff: &hyancieMCP.BackoffConfig{Initial: "100ms", Max: "1s"}},
+	}
+	tool := hyancieMCP.GenericToolConfig{
+		Request: hyancieMCP.RequestConfig{Timeout: "2s"},
+		Retry:   &hyancieMCP.RetryConfig{Backoff: &hyancieMCP.BackoffConfig{Initial: "300ms"}},
+	}
+
+	policy, err := newRetryPolicy(global, tool)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, policy.timeout)
+	assert.Equal(t, 4, policy.maxAttempts)
+	assert.Equal(t, 300*time.Millisecond, policy.initialBackoff)
+	assert.Equal(t, time.Second, policy.maxBackoff)
+	assert.True(t, policy.onStatus[http.StatusServiceUnavailable])
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		delay := policy.backoff(attempt)
+		assert.LessOrEqual(t, delay, time.Second)
+		assert.GreaterOrEqual(t, delay, 150*time.Millisecond)
+	}
+
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, maxRetryAfter, parseRetryAfter("3600"))
+	assert.Zero(t, parseRetryAfter("soon"))
+}
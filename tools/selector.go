@@ -0,0 +1,377 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cssSelector is a compiled group of CSS selectors, e.g. "div.result > a[href], h2".
+// It supports type, universal, id, class and attribute selectors (=, ~=,
+// |=, ^=, $=, *=), the :first-child, :last-child and :nth-child(n|odd|even)
+// pseudo-classes, and the descendant, child (>), next-sibling (+) and
+// subsequent-sibling (~) combinators.
+type cssSelector []cssComplex
+
+// cssComplex is a chain of compound selectors. combinators[i] joins
+// compounds[i] and compounds[i+1].
+type cssComplex struct {
+	compounds   []cssCompound
+	combinators []byte
+}
+
+// cssCompound is a sequence of simple selectors that an element must all match.
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []cssAttr
+	pseudos []cssPseudo
+}
+
+type cssAttr struct {
+	name, op, value string
+}
+
+type cssPseudo struct {
+	name string
+	a, b int // For nth-child: matches positions a*k + b
+}
+
+// compileSelector parses a selector group.
+func compileSelector(src string) (cssSelector, error) {
+	p := &selectorParser{src: src}
+	var group cssSelector
+	for {
+		complexSelector, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, complexSelector)
+		p.skipSpace()
+		if p.pos == len(p.src) {
+			return group, nil
+		}
+		if p.src[p.pos] != ',' {
+			return nil, p.errorf("unexpected %q", p.src[p.pos:])
+		}
+		p.pos++
+	}
+}
+
+// selectAll returns the elements below root matching the selector, in document order.
+func (s cssSelector) selectAll(root *htmlNode) []*htmlNode {
+	var matches []*htmlNode
+	root.elements(func(element *htmlNode) {
+		for _, complexSelector := range s {
+			if complexSelector.matches(element, len(complexSelector.compounds)-1) {
+				matches = append(matches, element)
+				return
+			}
+		}
+	})
+	return matches
+}
+
+// matches reports whether element matches the compounds up to index last.
+func (c cssComplex) matches(element *htmlNode, last int) bool {
+	if !c.compounds[last].matches(element) {
+		return false
+	}
+	if last == 0 {
+		return true
+	}
+	switch c.combinators[last-1] {
+	case '>':
+		parent := element.parent
+		return parent != nil && parent.tag != "" && c.matches(parent, last-1)
+	case '+':
+		previous := element.previousElement()
+		return previous != nil && c.matches(previous, last-1)
+	case '~':
+		for previous := element.previousElement(); previous != nil; previous = previous.previousElement() {
+			if c.matches(previous, last-1) {
+				return true
+			}
+		}
+		return false
+	}
+	for ancestor := element.parent; ancestor != nil && ancestor.tag != ""; ancestor = ancestor.parent {
+		if c.matches(ancestor, last-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c cssCompound) matches(element *htmlNode) bool {
+	if c.tag != "" && c.tag != "*" && c.tag != element.tag {
+		return false
+	}
+	if c.id != "" && element.attrs["id"] != c.id {
+		return false
+	}
+	classes := strings.Fields(element.attrs["class"])
+	for _, class := range c.classes {
+		if !containsString(classes, class) {
+			return false
+		}
+	}
+	for _, attr := range c.attrs {
+		value, ok := element.attrs[attr.name]
+		if !ok || !attr.matches(value) {
+			return false
+		}
+	}
+	for _, pseudo := range c.pseudos {
+		if !pseudo.matches(element) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a cssAttr) matches(value string) bool {
+	switch a.op {
+	case "=":
+		return value == a.value
+	case "~=":
+		return containsString(strings.Fields(value), a.value)
+	case "|=":
+		return value == a.value || strings.HasPrefix(value, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(value, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(value, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(value, a.value)
+	}
+	return true
+}
+
+func (p cssPseudo) matches(element *htmlNode) bool {
+	siblings := element.parent.elementChildren()
+	switch p.name {
+	case "first-child":
+		return siblings[0] == element
+	case "last-child":
+		return siblings[len(siblings)-1] == element
+	}
+	position := 0
+	for i, sibling := range siblings {
+		if sibling == element {
+			position = i + 1
+		}
+	}
+	if p.a == 0 {
+		return position == p.b
+	}
+	k := position - p.b
+	return k%p.a == 0 && k/p.a >= 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// elementChildren returns the child elements of n.
+func (n *htmlNode) elementChildren() []*htmlNode {
+	var elements []*htmlNode
+	for _, child := range n.children {
+		if child.tag != "" {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// previousElement returns the element before n among its siblings, or nil.
+func (n *htmlNode) previousElement() *htmlNode {
+	var previous *htmlNode
+	for _, sibling := range n.parent.children {
+		if sibling == n {
+			return previous
+		}
+		if sibling.tag != "" {
+			previous = sibling
+		}
+	}
+	return nil
+}
+
+// selectorParser is a recursive descent parser of CSS selectors.
+type selectorParser struct {
+	src string
+	pos int
+}
+
+func (p *selectorParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid selector %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\n\r\f", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) parseComplex() (cssComplex, error) {
+	var c cssComplex
+	p.skipSpace()
+	for {
+		compound, err := p.parseCompound()
+		if err != nil {
+			return c, err
+		}
+		c.compounds = append(c.compounds, compound)
+
+		spaced := p.skipSpace()
+		if p.pos == len(p.src) || p.src[p.pos] == ',' {
+			return c, nil
+		}
+		combinator := byte(' ')
+		if strings.IndexByte(">+~", p.src[p.pos]) >= 0 {
+			combinator = p.src[p.pos]
+			p.pos++
+			p.skipSpace()
+		} else if !spaced {
+			return c, p.errorf("unexpected %q", p.src[p.pos:])
+		}
+		c.combinators = append(c.combinators, combinator)
+	}
+}
+
+func (p *selectorParser) parseCompound() (cssCompound, error) {
+	var c cssCompound
+	if p.pos < len(p.src) && p.src[p.pos] == '*' {
+		c.tag = "*"
+		p.pos++
+	} else if name := p.parseIdent(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '#':
+			p.pos++
+			if c.id = p.parseIdent(); c.id == "" {
+				return c, p.errorf("expected an id")
+			}
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if class == "" {
+				return c, p.errorf("expected a class name")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			attr, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, attr)
+		case ':':
+			pseudo, err := p.parsePseudo()
+			if err != nil {
+				return c, err
+			}
+			c.pseudos = append(c.pseudos, pseudo)
+		default:
+			if c.tag == "" && c.id == "" && c.classes == nil && c.attrs == nil && c.pseudos == nil {
+				return c, p.errorf("expected a selector")
+			}
+			return c, nil
+		}
+	}
+	if c.tag == "" && c.id == "" && c.classes == nil && c.attrs == nil && c.pseudos == nil {
+		return c, p.errorf("expected a selector")
+	}
+	return c, nil
+}
+
+// parseIdent parses a CSS identifier, which may be empty.
+func (p *selectorParser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c != '-' && c != '_' && c < 0x80 && !isASCIILetter(c) && !('0' <= c && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *selectorParser) parseAttr() (cssAttr, error) {
+	p.pos++ // [
+	p.skipSpace()
+	attr := cssAttr{name: strings.ToLower(p.parseIdent())}
+	if attr.name == "" {
+		return attr, p.errorf("expected an attribute name")
+	}
+	p.skipSpace()
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			attr.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if attr.op != "" {
+		p.skipSpace()
+		if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+			quote := p.src[p.pos]
+			end := strings.IndexByte(p.src[p.pos+1:], quote)
+			if end < 0 {
+				return attr, p.errorf("unterminated string")
+			}
+			attr.value = p.src[p.pos+1 : p.pos+1+end]
+			p.pos += end + 2
+		} else if attr.value = p.parseIdent(); attr.value == "" {
+			return attr, p.errorf("expected an attribute value")
+		}
+		p.skipSpace()
+	}
+	if p.pos >= len(p.src) || p.src[p.pos] != ']' {
+		return attr, p.errorf("expected ]")
+	}
+	p.pos++
+	return attr, nil
+}
+
+func (p *selectorParser) parsePseudo() (cssPseudo, error) {
+	p.pos++ // :
+	pseudo := cssPseudo{name: strings.ToLower(p.parseIdent())}
+	switch pseudo.name {
+	case "first-child", "last-child":
+		return pseudo, nil
+	case "nth-child":
+	default:
+		return pseudo, p.errorf("unsupported pseudo-class :%s", pseudo.name)
+	}
+	end := strings.IndexByte(p.src[p.pos:], ')')
+	if p.pos >= len(p.src) || p.src[p.pos] != '(' || end < 0 {
+		return pseudo, p.errorf("expected (n)")
+	}
+	argument := strings.ToLower(strings.TrimSpace(p.src[p.pos+1 : p.pos+end]))
+	switch argument {
+	case "odd":
+		pseudo.a, pseudo.b = 2, 1
+	case "even":
+		pseudo.a, pseudo.b = 2, 0
+	default:
+		n, err := strconv.Atoi(argument)
+		if err != nil || n < 1 {
+			return pseudo, p.errorf("unsupported :nth-child argument %q", argument)
+		}
+		pseudo.b = n
+	}
+	p.pos += end + 1
+	return pseudo, nil
+}
@@ -0,0 +1,304 @@
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+// basicAuth sends HTTP Basic credentials.
+type basicAuth struct {
+	username, password string
+}
+
+func (a *basicAuth) Apply(req *http.Request, payload []byte) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// defaultCanonicalTemplate is the string signed by hmac auth unless canonical_template is set.
+const defaultCanonicalTemplate = "{{ .Method }}\n{{ .Path }}\n{{ .Timestamp }}\n{{ .Body }}"
+
+// hmacAuth signs a canonical string built from the request with a shared secret.
+type hmacAuth struct {
+	secret          []byte
+	newHash         func() hash.Hash
+	canonical       *template.Template
+	signatureHeader string
+	signaturePrefix string
+	base64          bool
+	timestampHeader string
+	timestampFormat string
+	now             func() time.Time
+}
+
+// hmacCanonicalData is the data available to canonical_template.
+type hmacCanonicalData struct {
+	Method     string
+	Host       string
+	Path       string // Escaped path
+	Query      string // Raw query string
+	Body       string
+	BodySHA256 string // Hex SHA-256 of the body
+	Timestamp  string
+}
+
+func newHMACAuth(settings hyancie.AuthConfig) (*hmacAuth, error) {
+	a := &hmacAuth{
+		secret:          []byte(settings.Secret),
+		signatureHeader: settings.SignatureHeader,
+		signaturePrefix: settings.SignaturePrefix,
+		timestampHeader: settings.TimestampHeader,
+		timestampFormat: settings.TimestampFormat,
+		now:             time.Now,
+	}
+	switch settings.Algorithm {
+	case "", "sha256":
+		a.newHash = sha256.New
+	case "sha1":
+		a.newHash = sha1.New
+	case "sha512":
+		a.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported hmac algorithm %q", settings.Algorithm)
+	}
+	switch settings.SignatureEncoding {
+	case "", "hex":
+	case "base64":
+		a.base64 = true
+	default:
+		return nil, fmt.Errorf("unsupported hmac signature_encoding %q", settings.SignatureEncoding)
+	}
+	if a.signatureHeader == "" {
+		a.signatureHeader = "X-Signature"
+	}
+	if a.timestampHeader == "" {
+		a.timestampHeader = "X-Timestamp"
+	}
+
+	canonical := settings.CanonicalTemplate
+	if canonical == "" {
+		canonical = defaultCanonicalTemplate
+	}
+	tmpl, err := template.New("canonical").Option("missingkey=error").Funcs(template.FuncMap{
+		// header is replaced per request, see Apply
+		"header": func(name string) string { return "" },
+	}).Parse(canonical)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hmac canonical_template: %w", err)
+	}
+	a.canonical = tmpl
+	return a, nil
+}
+
+// Apply sets the timestamp and signature headers.
+func (a *hmacAuth) Apply(req *http.Request, payload []byte) error {
+	now := a.now()
+	var timestamp string
+	switch a.timestampFormat {
+	case "unix_ms":
+		timestamp = strconv.FormatInt(now.UnixMilli(), 10)
+	case "rfc3339":
+		timestamp = now.UTC().Format(time.RFC3339)
+	default:
+		timestamp = strconv.FormatInt(now.Unix(), 10)
+	}
+	req.Header.Set(a.timestampHeader, timestamp)
+
+	bodyHash := sha256.Sum256(payload)
+	data := hmacCanonicalData{
+		Method:     req.Method,
+		Host:       req.URL.Host,
+		Path:       req.URL.EscapedPath(),
+		Query:      req.URL.RawQuery,
+		Body:       string(payload),
+		BodySHA256: hex.EncodeToString(bodyHash[:]),
+		Timestamp:  timestamp,
+	}
+	tmpl, err := a.canonical.Clone()
+	if err != nil {
+		return err
+	}
+	tmpl.Funcs(template.FuncMap{"header": req.Header.Get})
+	var canonical strings.Builder
+	if err := tmpl.Execute(&canonical, data); err != nil {
+		return fmt.Errorf("failed to build hmac canonical string: %w", err)
+	}
+
+	mac := hmac.New(a.newHash, a.secret)
+	mac.Write([]byte(canonical.String()))
+	sum := mac.Sum(nil)
+	signature := hex.EncodeToString(sum)
+	if a.base64 {
+		signature = base64.StdEncoding.EncodeToString(sum)
+	}
+	req.Header.Set(a.signatureHeader, a.signaturePrefix+signature)
+	return nil
+}
+
+// sigV4Auth signs requests with AWS Signature Version 4.
+type sigV4Auth struct {
+	region, service              string
+	accessKeyID, secretAccessKey string
+	sessionToken                 string
+	now                          func() time.Time
+}
+
+func newSigV4Auth(settings hyancie.AuthConfig) (*sigV4Auth, error) {
+	if settings.Region == "" || settings.Service == "" {
+		return nil, fmt.Errorf("aws_sigv4 requires region and service")
+	}
+	return &sigV4Auth{
+		region:          settings.Region,
+		service:         settings.Service,
+		accessKeyID:     settings.AccessKeyID,
+		secretAccessKey: settings.SecretAccessKey,
+		sessionToken:    settings.SessionToken,
+		now:             time.Now,
+	}, nil
+}
+
+// credentials returns the configured keys, falling back to the environment,
+// which is read on every request so that rotated credentials are picked up.
+func (a *sigV4Auth) credentials() (string, string, string, error) {
+	if a.accessKeyID != "" {
+		return a.accessKeyID, a.secretAccessKey, a.sessionToken, nil
+	}
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return "", "", "", fmt.Errorf("aws_sigv4: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return accessKeyID, secretAccessKey, os.Getenv("AWS_SESSION_TOKEN"), nil
+}
+
+// Apply adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers.
+func (a *sigV4Auth) Apply(req *http.Request, payload []byte) error {
+	accessKeyID, secretAccessKey, sessionToken, err := a.credentials()
+	if err != nil {
+		return err
+	}
+
+	now := a.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	if a.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	// Sign the host, the content type and all x-amz-* headers.
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	signed := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			signed[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if a.service != "s3" {
+		// All services except S3 expect the path to be encoded twice.
+		path = awsEscape(path, false)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.region + "/" + a.service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, a.service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// awsCanonicalQuery sorts and encodes query parameters as SigV4 requires.
+func awsCanonicalQuery(query map[string][]string) string {
+	var pairs []string
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters and,
+// unless encodeSlash is set, "/".
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
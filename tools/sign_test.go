@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigV4Auth(t *testing.T) {
+	// The "get-vanilla" case of the AWS Signature Version 4 test suite.
+	auth, err := newSigV4Auth(hyancieMCP.AuthConfig{
+		Type:            "aws_sigv4",
+		Region:          "us-east-1",
+		Service:         "service",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	})
+	require.NoError(t, err)
+	auth.now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	require.NoError(t, auth.Apply(req, nil))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+
+	t.Run("credentials from the environment", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_SESSION_TOKEN", "session")
+		envAuth, err := newSigV4Auth(hyancieMCP.AuthConfig{Type: "aws_sigv4", Region: "eu-west-1", Service: "execute-api"})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "https://abc.execute-api.eu-west-1.amazonaws.com/prod/items?b=2&a=1", nil)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		require.NoError(t, envAuth.Apply(req, []byte(`{}`)))
+		assert.Equal(t, "session", req.Header.Get("X-Amz-Security-Token"))
+		assert.Contains(t, req.Header.Get("Authorization"), "Credential=AKIDENV/")
+		assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token")
+
+		t.Setenv("AWS_ACCESS_KEY_ID", "")
+		require.Error(t, envAuth.Apply(req, nil))
+	})
+}
+
+func TestGenericToolSignedRequests(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		received, receivedBody = r, string(raw)
+		w.Write([]byte(`{"user": "ok"}`))
+	}))
+	defer api.Close()
+
+	newServer := func(auth *hyancieMCP.AuthConfig) *server.MCPServer {
+		hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{{
+			ToolName:    "signed",
+			Request:     hyancieMCP.RequestConfig{Method: "POST", URL: api.URL + "/orders?dry_run=true"},
+			Headers:     []hyancieMCP.Header{{Name: "X-Key-Id", Value: "key-1"}},
+			InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{"item": map[string]interface{}{"type": "string"}}},
+			OutputMapping: []hyancieMCP.OutputMap{
+				{JsonKey: "user", Description: "User", Type: "primitive"},
+			},
+			Auth: auth,
+		}}
+		s := server.NewMCPServer("test", "1.0")
+		require.NoError(t, AddGenericTools(s))
+		return s
+	}
+	call := func(s *server.MCPServer) {
+		result, err := getToolHandler(s, "signed")(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{"item": "book"}}})
+		require.NoError(t, err)
+		assert.Equal(t, "User:ok", joinContents(result.Content))
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		call(newServer(&hyancieMCP.AuthConfig{Type: "basic", Username: "alice", Password: "s3cret"}))
+		username, password, ok := received.BasicAuth()
+		require.True(t, ok)
+		assert.Equal(t, "alice", username)
+		assert.Equal(t, "s3cret", password)
+	})
+
+	t.Run("hmac default canonical string", func(t *testing.T) {
+		call(newServer(&hyancieMCP.AuthConfig{Type: "hmac", Secret: "shared"}))
+		timestamp := received.Header.Get("X-Timestamp")
+		require.NotEmpty(t, timestamp)
+
+		mac := hmac.New(sha256.New, []byte("shared"))
+		mac.Write([]byte("POST\n/orders\n" + timestamp + "\n" + receivedBody))
+		assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), received.Header.Get("X-Signature"))
+		assert.JSONEq(t, `{"item": "book"}`, receivedBody)
+	})
+
+	t.Run("hmac custom canonical string and headers", func(t *testing.T) {
+		call(newServer(&hyancieMCP.AuthConfig{
+			Type:              "hmac",
+			Secret:            "shared",
+			CanonicalTemplate: `{{ header "X-Key-Id" }}|{{ .Method }}|{{ .Path }}?{{ .Query }}|{{ .Timestamp }}|{{ .BodySHA256 }}`,
+			SignatureHeader:   "X-Hub-Signature-256",
+			SignaturePrefix:   "sha256=",
+			TimestampHeader:   "X-Request-Time",
+			TimestampFormat:   "rfc3339",
+		}))
+		timestamp := received.Header.Get("X-Request-Time")
+		_, err := time.Parse(time.RFC3339, timestamp)
+		require.NoError(t, err)
+
+		bodyHash := sha256.Sum256([]byte(receivedBody))
+		mac := hmac.New(sha256.New, []byte("shared"))
+		mac.Write([]byte("key-1|POST|/orders?dry_run=true|" + timestamp + "|" + hex.EncodeToString(bodyHash[:])))
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), received.Header.Get("X-Hub-Signature-256"))
+	})
+
+	t.Run("aws_sigv4", func(t *testing.T) {
+		call(newServer(&hyancieMCP.AuthConfig{Type: "aws_sigv4", Region: "us-east-1", Service: "execute-api", AccessKeyID: "AKID", SecretAccessKey: "secret"}))
+		assert.Contains(t, received.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/")
+		assert.Contains(t, received.Header.Get("Authorization"), "SignedHeaders=content-type;host;x-amz-date")
+	})
+}
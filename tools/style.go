@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	hyancie "github.com/liu599/hyancie"
+)
+
+// outputStyle defines how processMappings formats values as text.
+type outputStyle struct {
+	keySeparator       string // Between a label and its value
+	fieldSeparator     string // Between top-level fields
+	itemSeparator      string // Between the items of an array
+	itemFieldSeparator string // Between the fields of an item or object
+	itemLabel          string // Label of array items, {n} is the item number; empty for the locale's label
+	itemLabelSeparator string // Between an item label and the item; empty for keySeparator
+	labelFormat        string // fmt format applied to descriptions
+	arrayOpen          string
+	arrayClose         string
+	itemOpen           string
+	itemClose          string
+	locale             string
+	escape             string
+	escaper            *strings.Replacer // For escape "markdown" and "separators"
+}
+
+// outputStylePresets are the styles selected by output_style.preset.
+var outputStylePresets = map[string]outputStyle{
+	// default is the original format: 描述:值|列表:[项1:{A:x, B:y} | 项2:{...}]
+	"default": {
+		keySeparator:       ":",
+		fieldSeparator:     "|",
+		itemSeparator:      " | ",
+		itemFieldSeparator: ", ",
+		labelFormat:        "%s",
+		arrayOpen:          "[",
+		arrayClose:         "]",
+		itemOpen:           "{",
+		itemClose:          "}",
+		escape:             "none",
+	},
+	// markdown puts each field on a line and each array item in a numbered list.
+	"markdown": {
+		keySeparator:       ": ",
+		fieldSeparator:     "\n",
+		itemSeparator:      "\n",
+		itemFieldSeparator: ", ",
+		itemLabel:          "{n}.",
+		itemLabelSeparator: " ",
+		labelFormat:        "**%s**",
+		arrayOpen:          "\n",
+		escape:             "markdown",
+	},
+}
+
+// itemLabels are the default item labels per locale.
+var itemLabels = map[string]string{
+	"zh": "项{n}",
+	"en": "Item {n}",
+}
+
+// markdownEscaper escapes characters with a meaning in Markdown, and folds
+// line breaks that would end a list item.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `|`, `\|`, `#`, `\#`, "\r\n", " ", "\n", " ",
+)
+
+// newOutputStyle resolves the output style of a tool. Starting from the
+// default preset, the global and then the tool settings are applied; a
+// preset replaces everything set before it.
+func newOutputStyle(global *hyancie.ConfigType, config hyancie.GenericToolConfig) *outputStyle {
+	style := outputStylePresets["default"]
+	style.locale = "zh"
+	for _, settings := range []*hyancie.OutputStyleConfig{global.OutputStyle, config.OutputStyle} {
+		if settings == nil {
+			continue
+		}
+		if preset, ok := outputStylePresets[settings.Preset]; ok {
+			preset.locale = style.locale
+			style = preset
+		}
+		for _, field := range []struct {
+			target *string
+			value  string
+		}{
+			{&style.locale, settings.Locale},
+			{&style.keySeparator, settings.KeySeparator},
+			{&style.fieldSeparator, settings.FieldSeparator},
+			{&style.itemSeparator, settings.ItemSeparator},
+			{&style.itemFieldSeparator, settings.ItemFieldSeparator},
+			{&style.itemLabel, settings.ItemLabel},
+			{&style.escape, settings.Escape},
+		} {
+			if field.value != "" {
+				*field.target = field.value
+			}
+		}
+	}
+	if style.itemLabel == "" {
+		style.itemLabel = itemLabels[style.locale]
+	}
+	if style.itemLabelSeparator == "" {
+		style.itemLabelSeparator = style.keySeparator
+	}
+	switch style.escape {
+	case "markdown":
+		style.escaper = markdownEscaper
+	case "separators":
+		style.escaper = style.separatorEscaper()
+	}
+	return &style
+}
+
+// field formats a labelled value.
+func (s *outputStyle) field(description, value string) string {
+	return fmt.Sprintf(s.labelFormat, description) + s.keySeparator + value
+}
+
+// array formats the formatted items of an array.
+func (s *outputStyle) array(description string, items []string) string {
+	label := fmt.Sprintf(s.labelFormat, description) + s.keySeparator
+	if strings.HasPrefix(s.arrayOpen, "\n") {
+		// No trailing blanks before a line break
+		label = strings.TrimRight(label, " ")
+	}
+	return label + s.arrayOpen + strings.Join(items, s.itemSeparator) + s.arrayClose
+}
+
+// item formats the fields of the n-th array item.
+func (s *outputStyle) item(n int, fields []string) string {
+	label := strings.ReplaceAll(s.itemLabel, "{n}", strconv.Itoa(n))
+	return label + s.itemLabelSeparator + s.object(fields)
+}
+
+// object formats the fields of an item or nested object.
+func (s *outputStyle) object(fields []string) string {
+	return s.itemOpen + strings.Join(fields, s.itemFieldSeparator) + s.itemClose
+}
+
+// value formats and escapes a primitive value.
+func (s *outputStyle) value(value interface{}) string {
+	if s.escape == "json" {
+		if encoded, err := json.Marshal(value); err == nil {
+			return string(encoded)
+		}
+	}
+	formatted := fmt.Sprintf("%v", value)
+	if s.escaper != nil {
+		return s.escaper.Replace(formatted)
+	}
+	return formatted
+}
+
+// separatorEscaper backslash-escapes the separators, and backslashes, in values.
+func (s *outputStyle) separatorEscaper() *strings.Replacer {
+	pairs := []string{`\`, `\\`}
+	seen := map[string]bool{`\`: true}
+	for _, separator := range []string{s.fieldSeparator, s.itemSeparator, s.itemFieldSeparator} {
+		separator = strings.TrimSpace(separator)
+		if separator == "" || seen[separator] {
+			continue
+		}
+		seen[separator] = true
+		pairs = append(pairs, separator, `\`+separator)
+	}
+	return strings.NewReplacer(pairs...)
+}
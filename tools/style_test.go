@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputStyle(t *testing.T) {
+	var data interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"title": "A|B *bold*",
+		"owner": {"name": "Ada", "team": "core, infra"},
+		"results": [{"name": "x", "score": 1.5}, {"name": "y", "score": 2}]
+	}`), &data))
+	mappings := []hyancieMCP.OutputMap{
+		{JsonKey: "title", Description: "Title", Type: "primitive"},
+		{JsonKey: "owner", Description: "Owner", Type: "object", Items: []hyancieMCP.OutputMap{
+			{JsonKey: "name", Description: "Name", Type: "primitive"},
+			{JsonKey: "team", Description: "Team", Type: "primitive"},
+		}},
+		{JsonKey: "results", Description: "Results", Type: "array", Items: []hyancieMCP.OutputMap{
+			{JsonKey: "name", Description: "Name", Type: "primitive"},
+			{JsonKey: "score", Description: "Score", Type: "primitive"},
+		}},
+	}
+	render := func(global, tool *hyancieMCP.OutputStyleConfig) string {
+		output, err := newToolOutput(&hyancieMCP.ConfigType{OutputStyle: global}, hyancieMCP.GenericToolConfig{OutputMapping: mappings, OutputStyle: tool})
+		require.NoError(t, err)
+		text, _, err := output.render(data, "")
+		require.NoError(t, err)
+		return text
+	}
+
+	assert.Equal(t, "Title:A|B *bold*|Owner:{Name:Ada, Team:core, infra}|Results:[项1:{Name:x, Score:1.5} | 项2:{Name:y, Score:2}]", render(nil, nil))
+
+	assert.Equal(t, "**Title**: A\\|B \\*bold\\*\n"+
+		"**Owner**: **Name**: Ada, **Team**: core, infra\n"+
+		"**Results**:\n"+
+		"1. **Name**: x, **Score**: 1.5\n"+
+		"2. **Name**: y, **Score**: 2", render(nil, &hyancieMCP.OutputStyleConfig{Preset: "markdown"}))
+
+	// Tool settings override global ones field by field.
+	assert.Equal(t, "Title=A\\|B *bold*; Owner={Name=Ada; Team=core, infra}; Results=[Item 1={Name=x; Score=1.5} | Item 2={Name=y; Score=2}]", render(
+		&hyancieMCP.OutputStyleConfig{Locale: "en", KeySeparator: "=", FieldSeparator: "; ", Escape: "separators"},
+		&hyancieMCP.OutputStyleConfig{ItemFieldSeparator: "; "},
+	))
+
+	assert.Equal(t, `Title:"A|B *bold*"|Owner:{Name:"Ada", Team:"core, infra"}|Results:[#1:{Name:"x", Score:1.5} | #2:{Name:"y", Score:2}]`, render(
+		&hyancieMCP.OutputStyleConfig{Preset: "markdown"},
+		&hyancieMCP.OutputStyleConfig{Preset: "default", ItemLabel: "#{n}", Escape: "json"},
+	))
+}
@@ -0,0 +1,446 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ValidationError describes a single argument that does not satisfy the input schema.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// schemaValidator validates tool arguments against a JSON Schema document.
+// Compiled patterns are cached so that a validator can be reused across calls.
+type schemaValidator struct {
+	schema   map[string]interface{}
+	patterns sync.Map // pattern -> *regexp.Regexp
+}
+
+// newSchemaValidator builds a validator for a tool input schema. The schema is
+// round-tripped through JSON so that properties declared with any Go type
+// (e.g. map[string]string) are handled uniformly.
+func newSchemaValidator(inputSchema mcp.ToolInputSchema) (*schemaValidator, error) {
+	raw, err := json.Marshal(inputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input schema: %w", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode input schema: %w", err)
+	}
+	return &schemaValidator{schema: schema}, nil
+}
+
+// Validate checks args against the schema and returns every violation found.
+func (v *schemaValidator) Validate(args map[string]interface{}) []ValidationError {
+	var errs []ValidationError
+	v.validate("", args, v.schema, &errs)
+	return errs
+}
+
+// newValidationErrorResult builds an IsError tool result that names every
+// violating field, so that the model can correct its arguments.
+func newValidationErrorResult(errs []ValidationError) *mcp.CallToolResult {
+	lines := make([]string, 0, len(errs)+1)
+	lines = append(lines, "Invalid arguments:")
+	for _, e := range errs {
+		lines = append(lines, fmt.Sprintf("- %s: %s", e.Field, e.Message))
+	}
+	result := mcp.NewToolResultError(strings.Join(lines, "\n"))
+	result.Meta = map[string]interface{}{
+		"validationErrors": errs,
+	}
+	return result
+}
+
+func (v *schemaValidator) validate(path string, value interface{}, schema map[string]interface{}, errs *[]ValidationError) {
+	field := path
+	if field == "" {
+		field = "(arguments)"
+	}
+	fail := func(format string, a ...interface{}) {
+		*errs = append(*errs, ValidationError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(value, t) {
+		fail("must be of type %s, got %s", typeNames(t), jsonTypeOf(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(value, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", formatJSON(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(value, constant) {
+		fail("must be %s", formatJSON(constant))
+	}
+
+	switch typed := value.(type) {
+	case string:
+		v.validateString(typed, schema, fail)
+	case map[string]interface{}:
+		v.validateObject(path, typed, schema, errs, fail)
+	case []interface{}:
+		v.validateArray(path, typed, schema, errs, fail)
+	default:
+		if n, ok := toFloat(value); ok {
+			validateNumber(n, schema, fail)
+		}
+	}
+
+	v.validateCombinators(path, value, schema, errs, fail)
+}
+
+func (v *schemaValidator) validateString(s string, schema map[string]interface{}, fail func(string, ...interface{})) {
+	length := len([]rune(s))
+	if min, ok := toFloat(schema["minLength"]); ok && float64(length) < min {
+		fail("must be at least %v characters long", min)
+	}
+	if max, ok := toFloat(schema["maxLength"]); ok && float64(length) > max {
+		fail("must be at most %v characters long", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := v.compile(pattern)
+		if err != nil {
+			fail("has an invalid pattern in the schema: %v", err)
+		} else if !re.MatchString(s) {
+			fail("must match pattern %q", pattern)
+		}
+	}
+	if format, ok := schema["format"].(string); ok {
+		if msg := checkFormat(format, s); msg != "" {
+			fail("%s", msg)
+		}
+	}
+}
+
+func validateNumber(n float64, schema map[string]interface{}, fail func(string, ...interface{})) {
+	if min, ok := toFloat(schema["minimum"]); ok {
+		// Draft 4 expresses exclusiveness as a boolean next to minimum.
+		if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && n <= min {
+			fail("must be greater than %v", min)
+		} else if n < min {
+			fail("must be greater than or equal to %v", min)
+		}
+	}
+	if max, ok := toFloat(schema["maximum"]); ok {
+		if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && n >= max {
+			fail("must be less than %v", max)
+		} else if n > max {
+			fail("must be less than or equal to %v", max)
+		}
+	}
+	if min, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= min {
+		fail("must be greater than %v", min)
+	}
+	if max, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= max {
+		fail("must be less than %v", max)
+	}
+	if multiple, ok := toFloat(schema["multipleOf"]); ok && multiple > 0 {
+		quotient := n / multiple
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			fail("must be a multiple of %v", multiple)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(path string, obj map[string]interface{}, schema map[string]interface{}, errs *[]ValidationError, fail func(string, ...interface{})) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*errs = append(*errs, ValidationError{Field: joinPath(path, name), Message: "is required"})
+			}
+		}
+	}
+	if min, ok := toFloat(schema["minProperties"]); ok && float64(len(obj)) < min {
+		fail("must have at least %v properties", min)
+	}
+	if max, ok := toFloat(schema["maxProperties"]); ok && float64(len(obj)) > max {
+		fail("must have at most %v properties", max)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := joinPath(path, name)
+		if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+			v.validate(propertyPath, obj[name], propertySchema, errs)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, ValidationError{Field: propertyPath, Message: "is not an allowed property"})
+			}
+		case map[string]interface{}:
+			v.validate(propertyPath, obj[name], additional, errs)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(path string, arr []interface{}, schema map[string]interface{}, errs *[]ValidationError, fail func(string, ...interface{})) {
+	if min, ok := toFloat(schema["minItems"]); ok && float64(len(arr)) < min {
+		fail("must contain at least %v items", min)
+	}
+	if max, ok := toFloat(schema["maxItems"]); ok && float64(len(arr)) > max {
+		fail("must contain at most %v items", max)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	duplicates:
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					fail("must not contain duplicate items (items %d and %d are equal)", i, j)
+					break duplicates
+				}
+			}
+		}
+	}
+
+	switch items := schema["items"].(type) {
+	case map[string]interface{}:
+		for i, item := range arr {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), item, items, errs)
+		}
+	case []interface{}:
+		// Tuple validation.
+		for i, item := range arr {
+			if i >= len(items) {
+				break
+			}
+			if itemSchema, ok := items[i].(map[string]interface{}); ok {
+				v.validate(fmt.Sprintf("%s[%d]", path, i), item, itemSchema, errs)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateCombinators(path string, value interface{}, schema map[string]interface{}, errs *[]ValidationError, fail func(string, ...interface{})) {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				v.validate(path, value, subSchema, errs)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		if v.countMatches(path, value, anyOf) == 0 {
+			fail("must match at least one of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if matches := v.countMatches(path, value, oneOf); matches != 1 {
+			fail("must match exactly one of the allowed schemas, matched %d", matches)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok {
+		var notErrs []ValidationError
+		v.validate(path, value, not, &notErrs)
+		if len(notErrs) == 0 {
+			fail("must not match the excluded schema")
+		}
+	}
+}
+
+// countMatches returns how many of the given schemas value satisfies.
+func (v *schemaValidator) countMatches(path string, value interface{}, schemas []interface{}) int {
+	matches := 0
+	for _, sub := range schemas {
+		subSchema, ok := sub.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var subErrs []ValidationError
+		v.validate(path, value, subSchema, &subErrs)
+		if len(subErrs) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func (v *schemaValidator) compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := v.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns.Store(pattern, re)
+	return re, nil
+}
+
+// checkFormat validates the common string formats and returns an error message, or "" if valid.
+// Unknown formats are accepted.
+func checkFormat(format, s string) string {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return "must be an RFC 3339 date-time"
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return "must be a date in YYYY-MM-DD format"
+		}
+	case "email":
+		if _, err := mail.ParseAddress(s); err != nil {
+			return "must be a valid email address"
+		}
+	case "uri", "url":
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" {
+			return "must be an absolute URI"
+		}
+	}
+	return ""
+}
+
+// matchesType reports whether value matches a JSON Schema "type" (a name or a list of names).
+func matchesType(value interface{}, t interface{}) bool {
+	switch typed := t.(type) {
+	case string:
+		return matchesTypeName(value, typed)
+	case []interface{}:
+		for _, name := range typed {
+			if s, ok := name.(string); ok && matchesTypeName(value, s) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func matchesTypeName(value interface{}, name string) bool {
+	actual := jsonTypeOf(value)
+	switch name {
+	case "":
+		return true
+	case "number":
+		return actual == "integer" || actual == "number"
+	case "integer":
+		return actual == "integer"
+	default:
+		return actual == name
+	}
+}
+
+// jsonTypeOf returns the JSON Schema type name of a decoded argument value.
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if n, ok := toFloat(value); ok {
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return reflect.TypeOf(value).String()
+}
+
+func typeNames(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprintf("%v", name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprintf("%v", t)
+}
+
+// toFloat converts any Go numeric value (including json.Number) to float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded JSON values, treating all numeric types alike.
+func jsonEqual(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func formatJSON(value interface{}) string {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(out)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
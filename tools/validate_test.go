@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	inputSchema := mcp.ToolInputSchema{
+		Type: "object",
+		Properties: map[string]interface{}{
+			"city":  map[string]interface{}{"type": "string", "minLength": 2, "pattern": "^[A-Za-z ]+$"},
+			"unit":  map[string]interface{}{"type": "string", "enum": []string{"metric", "imperial"}},
+			"days":  map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 7},
+			"email": map[string]interface{}{"type": "string", "format": "email"},
+			"tags": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"uniqueItems": true,
+			},
+			"filter": map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"min": map[string]interface{}{"type": "number"}},
+				"required":             []string{"min"},
+				"additionalProperties": false,
+			},
+		},
+		Required: []string{"city"},
+	}
+	validator, err := newSchemaValidator(inputSchema)
+	require.NoError(t, err)
+
+	t.Run("valid arguments", func(t *testing.T) {
+		errs := validator.Validate(map[string]interface{}{
+			"city":   "Shanghai",
+			"unit":   "metric",
+			"days":   float64(3),
+			"email":  "user@example.com",
+			"tags":   []interface{}{"a", "b"},
+			"filter": map[string]interface{}{"min": 1.5},
+		})
+		assert.Empty(t, errs)
+	})
+
+	t.Run("every violation is reported", func(t *testing.T) {
+		errs := validator.Validate(map[string]interface{}{
+			"unit":   "kelvin",
+			"days":   8.5,
+			"email":  "not-an-email",
+			"tags":   []interface{}{"a", "a"},
+			"filter": map[string]interface{}{"max": 3},
+		})
+		fields := make(map[string]string)
+		for _, e := range errs {
+			fields[e.Field] = e.Message
+		}
+		assert.Equal(t, "is required", fields["city"])
+		assert.Contains(t, fields["unit"], "must be one of")
+		assert.Contains(t, fields["days"], "must be of type integer")
+		assert.Contains(t, fields["email"], "email")
+		assert.Contains(t, fields["tags"], "duplicate")
+		assert.Equal(t, "is required", fields["filter.min"])
+		assert.Equal(t, "is not an allowed property", fields["filter.max"])
+	})
+
+	t.Run("string constraints", func(t *testing.T) {
+		errs := validator.Validate(map[string]interface{}{"city": "1"})
+		require.Len(t, errs, 2)
+		assert.Contains(t, errs[0].Message, "at least 2 characters")
+		assert.Contains(t, errs[1].Message, "must match pattern")
+	})
+}
+
+func TestGenericToolRejectsInvalidArguments(t *testing.T) {
+	called := false
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer mockAPIServer.Close()
+
+	hyancieMCP.Config.McpTools = []hyancieMCP.GenericToolConfig{{
+		ToolName:    "get_forecast",
+		Description: "Get forecast",
+		Request:     hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/forecast"},
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]interface{}{
+				"days": map[string]interface{}{"type": "integer", "maximum": 7, "default": 3},
+			},
+		},
+	}}
+
+	s := server.NewMCPServer("test", "1.0")
+	require.NoError(t, AddGenericTools(s))
+	handler := getToolHandler(s, "get_forecast")
+	require.NotNil(t, handler)
+
+	result, err := handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{"days": 30}}})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, "Invalid arguments:\n- days: must be less than or equal to 7", joinContents(result.Content))
+	assert.Equal(t, []ValidationError{{Field: "days", Message: "must be less than or equal to 7"}}, result.Meta["validationErrors"])
+	assert.False(t, called)
+
+	// Defaults are applied before validation.
+	result, err = handler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]interface{}{}}})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.True(t, called)
+}
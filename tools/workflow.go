@@ -0,0 +1,323 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	hyancie "github.com/liu599/hyancie"
+	"github.com/liu599/hyancie/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// stepReference matches a {placeholder} in a step's URL or header values. It
+// names an argument or a value extracted by an earlier step, e.g. {lookup.id}.
+var stepReference = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\}`)
+
+// Step outcomes reported in the result metadata.
+const (
+	stepOK      = "ok"
+	stepSkipped = "skipped"
+	stepFailed  = "failed"
+)
+
+// workflow runs the steps of a multi-step tool one after another.
+type workflow struct {
+	toolName string
+	headers  []hyancie.Header
+	decoder  *responseDecoder
+	output   *toolOutput
+	client   *http.Client
+	auth     authenticator
+	steps    []*workflowStep
+}
+
+// workflowStep is a compiled step config.
+type workflowStep struct {
+	config      hyancie.StepConfig
+	method      string
+	when        *template.Template
+	body        *bodyTemplate
+	encoder     *bodyEncoder
+	policy      *retryPolicy
+}
+
+// stepReport describes how a step ended, for the result metadata.
+type stepReport struct {
+	name       string
+	status     string
+	statusCode int
+	err        error
+}
+
+func (r stepReport) meta() map[string]interface{} {
+	meta := map[string]interface{}{"name": r.name, "status": r.status}
+	if r.statusCode != 0 {
+		meta["statusCode"] = r.statusCode
+	}
+	if r.err != nil {
+		meta["error"] = r.err.Error()
+	}
+	return meta
+}
+
+// newWorkflow compiles the steps of a tool config. It returns nil if the tool
+// has no steps. The steps share the tool's headers, HTTP client, auth and
+// retry settings, and output renders the result.
+func newWorkflow(global *hyancie.ConfigType, config hyancie.GenericToolConfig, client *http.Client, auth authenticator, decoder *responseDecoder, output *toolOutput) (*workflow, error) {
+	if len(config.Steps) == 0 {
+		return nil, nil
+	}
+	w := &workflow{
+		toolName: config.ToolName,
+		headers:  config.Headers,
+		decoder:  decoder,
+		output:   output,
+		client:   client,
+		auth:     auth,
+	}
+	for _, stepConfig := range config.Steps {
+		step := &workflowStep{config: stepConfig, method: strings.ToUpper(stepConfig.Request.Method)}
+		if step.method == "" {
+			step.method = http.MethodGet
+		}
+		if stepConfig.When != "" {
+			when, err := template.New(stepConfig.Name).Funcs(bodyTemplateFuncs).Parse(stepConfig.When)
+			if err != nil {
+				return nil, fmt.Errorf("step %q: invalid when: %w", stepConfig.Name, err)
+			}
+			step.when = when
+		}
+		body, err := newBodyTemplate(stepConfig.Request.BodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", stepConfig.Name, err)
+		}
+		step.body = body
+		encoder, err := newBodyEncoder(stepConfig.Request, nil)
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", stepConfig.Name, err)
+		}
+		step.encoder = encoder
+		step.policy, err = newRetryPolicy(global, hyancie.GenericToolConfig{Request: stepConfig.Request, Retry: config.Retry})
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", stepConfig.Name, err)
+		}
+		if decoder != nil {
+			step.policy.bodyLimit = decoder.bodyLimit
+		}
+		w.steps = append(w.steps, step)
+	}
+	return w, nil
+}
+
+// run executes the steps with the given arguments. Each executed step adds
+// its extracted values to the variables of the following steps, under the
+// step's name. The output mapping is applied to an object holding the
+// decoded response of every step that succeeded, keyed by step name.
+func (w *workflow) run(ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	vars := make(map[string]interface{}, len(args)+len(w.steps))
+	for name, value := range args {
+		vars[name] = value
+	}
+	responses := make(map[string]interface{}, len(w.steps))
+	var reports []stepReport
+	var failures []string
+
+	for _, step := range w.steps {
+		name := step.config.Name
+		// Later steps may test extracted values of skipped or failed steps.
+		vars[name] = map[string]interface{}{}
+
+		run, err := step.enabled(vars)
+		if err == nil && !run {
+			logging.Logger.Info("Skipping step", "tool_name", w.toolName, "step", name)
+			reports = append(reports, stepReport{name: name, status: stepSkipped})
+			continue
+		}
+
+		var resp *upstreamResponse
+		if err == nil {
+			resp, err = w.call(ctx, step, args, vars)
+		}
+		if err == nil && !isSuccess(resp.StatusCode) {
+			err = fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(resp.Body))
+		}
+		report := stepReport{name: name, status: stepOK, err: err}
+		if resp != nil {
+			report.statusCode = resp.StatusCode
+		}
+
+		if err != nil {
+			report.status = stepFailed
+			reports = append(reports, report)
+			logging.Logger.Warn("Step failed", "tool_name", w.toolName, "step", name, "on_error", step.config.OnError, "error", err)
+			if step.config.OnError != "continue" && step.config.OnError != "stop" {
+				return nil, fmt.Errorf("step %q: %w", name, err)
+			}
+			// Report the failure to the model along with the output of the other steps.
+			failures = append(failures, fmt.Sprintf("step %s failed: %v", name, err))
+			if step.config.OnError == "stop" {
+				break
+			}
+			continue
+		}
+		reports = append(reports, report)
+
+		decoded, _, err := w.decoder.decode(resp.Header, resp.Body)
+		if err != nil {
+			decoded = string(resp.Body)
+		}
+		responses[name] = decoded
+		vars[name] = extractValues(decoded, step.config.Extract)
+	}
+
+	text, structured, err := w.output.render(responses, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(failures) > 0 {
+		if text != "" {
+			failures = append([]string{text}, failures...)
+		}
+		text = strings.Join(failures, w.output.style.fieldSeparator)
+	}
+
+	steps := make([]interface{}, len(reports))
+	for i, report := range reports {
+		steps[i] = report.meta()
+	}
+	result := w.output.result(text, structured)
+	result.Meta["args"] = args
+	result.Meta["steps"] = steps
+	return result, nil
+}
+
+// enabled evaluates the step's when condition.
+func (s *workflowStep) enabled(vars map[string]interface{}) (bool, error) {
+	if s.when == nil {
+		return true, nil
+	}
+	var buf bytes.Buffer
+	if err := s.when.Execute(&buf, vars); err != nil {
+		return false, fmt.Errorf("failed to evaluate when: %w", err)
+	}
+	switch strings.TrimSpace(buf.String()) {
+	case "", "false", "0", "<no value>":
+		return false, nil
+	}
+	return true, nil
+}
+
+// call sends the request of a step. Without a body_template, steps with a
+// body send the tool's arguments that the step URL does not reference, like
+// the default body of a single-request tool.
+func (w *workflow) call(ctx context.Context, step *workflowStep, args, vars map[string]interface{}) (*upstreamResponse, error) {
+	stepURL, err := expandStepURL(step.config.Request.URL, vars)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(http.Header)
+	for _, header := range append(append([]hyancie.Header(nil), w.headers...), step.config.Headers...) {
+		value, err := expandReferences(header.Value, vars, nil)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", header.Name, err)
+		}
+		headers.Set(header.Name, value)
+	}
+	var payload []byte
+	contentType := step.encoder.contentType
+	switch {
+	case step.body != nil:
+		if payload, err = step.body.Render(vars); err != nil {
+			return nil, err
+		}
+	case methodHasBody(step.method):
+		body := make(map[string]interface{}, len(args))
+		for name, value := range args {
+			if !strings.Contains(step.config.Request.URL, "{"+name+"}") {
+				body[name] = value
+			}
+		}
+		if payload, contentType, err = step.encoder.Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	build := newBodyBuilder(step.method, stepURL, payload, func(req *http.Request) error {
+		if payload != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for name, values := range headers {
+			req.Header[name] = append([]string(nil), values...)
+		}
+		if w.auth != nil {
+			return w.auth.Apply(req, payload)
+		}
+		return nil
+	})
+	logging.Logger.Info("Sending HTTP request", "tool_name", w.toolName, "step", step.config.Name, "method", step.method, "url", stepURL)
+	resp, err := sendAuthenticated(ctx, w.toolName, step.policy, w.client, w.auth, step.method, build)
+	if err != nil {
+		return nil, err
+	}
+	logging.Logger.Info("Received HTTP response", "tool_name", w.toolName, "step", step.config.Name, "status_code", resp.StatusCode, "attempts", resp.Attempts, "body", string(resp.Body))
+	return resp, nil
+}
+
+// extractValues picks the configured values out of a decoded step response.
+// Values that are not present are left out.
+func extractValues(decoded interface{}, extract map[string]string) map[string]interface{} {
+	values := make(map[string]interface{}, len(extract))
+	for name, key := range extract {
+		if value, found := getValue(decoded, key); found {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// expandStepURL replaces the references in a step URL, escaping values as
+// path segments before the query string and as query values after it.
+func expandStepURL(rawURL string, vars map[string]interface{}) (string, error) {
+	path, query, hasQuery := strings.Cut(rawURL, "?")
+	expanded, err := expandReferences(path, vars, url.PathEscape)
+	if err != nil {
+		return "", err
+	}
+	if hasQuery {
+		expandedQuery, err := expandReferences(query, vars, url.QueryEscape)
+		if err != nil {
+			return "", err
+		}
+		expanded += "?" + expandedQuery
+	}
+	return expanded, nil
+}
+
+// expandReferences replaces every {reference} in s by its value, escaped with
+// escape if it is not nil. A reference without a value is an error.
+func expandReferences(s string, vars map[string]interface{}, escape func(string) string) (string, error) {
+	var missing []string
+	expanded := stepReference.ReplaceAllStringFunc(s, func(match string) string {
+		reference := match[1 : len(match)-1]
+		value, ok := getValueFromNestedMap(vars, reference)
+		if !ok || value == nil {
+			missing = append(missing, match)
+			return match
+		}
+		formatted := formatParam(value)
+		if escape != nil {
+			formatted = escape(formatted)
+		}
+		return formatted
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unresolved reference %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hyancieMCP "github.com/liu599/hyancie"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericToolSteps(t *testing.T) {
+	var requests []string
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		assert.Equal(t, "k", r.Header.Get("X-API-Key"))
+		switch r.URL.Path {
+		case "/customers":
+			if r.URL.Query().Get("email") == "nobody@example.com" {
+				fmt.Fprint(w, `{"results": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"results": [{"id": 42, "name": "Ada Lovelace"}]}`)
+		case "/customers/42/orders":
+			assert.Equal(t, "42", r.Header.Get("X-Customer"))
+			fmt.Fprint(w, `{"orders": [{"id": "A-1", "total": 12.5}], "count": 1}`)
+		case "/audit":
+			body, _ := io.ReadAll(r.Body)
+			var decoded map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &decoded))
+			assert.Equal(t, map[string]interface{}{"customer": float64(42), "orders": float64(1)}, decoded)
+			http.Error(w, "audit log unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer mockAPIServer.Close()
+
+	config := hyancieMCP.GenericToolConfig{
+		ToolName: "customer_orders",
+		Headers:  []hyancieMCP.Header{{Name: "X-API-Key", Value: "k"}},
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{
+			"email": map[string]interface{}{"type": "string"},
+		}},
+		Steps: []hyancieMCP.StepConfig{
+			{
+				Name:    "lookup",
+				Request: hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/customers?email={email}"},
+				Extract: map[string]string{"id": "results[0].id"},
+			},
+			{
+				Name:    "orders",
+				When:    "{{ .lookup.id }}",
+				Request: hyancieMCP.RequestConfig{Method: "GET", URL: mockAPIServer.URL + "/customers/{lookup.id}/orders"},
+				Headers: []hyancieMCP.Header{{Name: "X-Customer", Value: "{lookup.id}"}},
+				Extract: map[string]string{"count": "count"},
+			},
+			{
+				Name:    "audit",
+				When:    "{{ .orders.count }}",
+				OnError: "continue",
+				Request: hyancieMCP.RequestConfig{
+					Method:       "POST",
+					URL:          mockAPIServer.URL + "/audit",
+					BodyTemplate: json.RawMessage(`{"customer": "{{ .lookup.id }}", "orders": "{{ .orders.count }}"}`),
+				},
+			},
+		},
+		OutputMapping: []hyancieMCP.OutputMap{
+			{JsonKey: "lookup.results[0].name", Description: "Name", Type: "primitive"},
+			{JsonKey: "orders.orders", Description: "Orders", Type: "array", Items: []hyancieMCP.OutputMap{
+				{JsonKey: "id", Description: "ID", Type: "primitive"},
+				{JsonKey: "total", Description: "Total", Type: "primitive"},
+			}},
+		},
+	}
+	handler := newGenericToolHandler(&hyancieMCP.ConfigType{}, config)
+
+	call := func(email string) *mcp.CallToolResult {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = map[string]interface{}{"email": email}
+		result, err := handler(context.Background(), request)
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call("ada+test@example.com")
+	assert.Equal(t, "Name:Ada Lovelace|Orders:[项1:{ID:A-1, Total:12.5}]|step audit failed: request failed with status 503: audit log unavailable\n", joinContents(result.Content))
+	assert.Equal(t, []string{
+		"GET /customers?email=ada%2Btest%40example.com",
+		"GET /customers/42/orders",
+		"POST /audit",
+	}, requests)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "lookup", "status": "ok", "statusCode": 200},
+		map[string]interface{}{"name": "orders", "status": "ok", "statusCode": 200},
+		map[string]interface{}{"name": "audit", "status": "failed", "statusCode": 503, "error": "request failed with status 503: audit log unavailable\n"},
+	}, result.Meta["steps"])
+
+	// Without a customer the conditional steps are skipped.
+	requests = nil
+	result = call("nobody@example.com")
+	assert.Equal(t, "", joinContents(result.Content))
+	assert.Equal(t, []string{"GET /customers?email=nobody%40example.com"}, requests)
+	assert.Equal(t, "skipped", result.Meta["steps"].([]interface{})[1].(map[string]interface{})["status"])
+
+	// A failing step without on_error fails the call.
+	config.Steps[1].When = ""
+	handler = newGenericToolHandler(&hyancieMCP.ConfigType{}, config)
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]interface{}{"email": "nobody@example.com"}
+	_, err := handler(context.Background(), request)
+	require.Error(t, err)
+	assert.Equal(t, `step "orders": unresolved reference {lookup.id}`, err.Error())
+}
+
+func TestGenericToolStepDefaultBody(t *testing.T) {
+	var bodies []string
+	mockAPIServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Method+" "+r.URL.Path+" "+r.Header.Get("Content-Type")+" "+string(body))
+		fmt.Fprint(w, `{"id": 7}`)
+	}))
+	defer mockAPIServer.Close()
+
+	handler := newGenericToolHandler(&hyancieMCP.ConfigType{}, hyancieMCP.GenericToolConfig{
+		ToolName: "register",
+		InputSchema: mcp.ToolInputSchema{Type: "object", Properties: map[string]interface{}{
+			"team": map[string]interface{}{"type": "string"},
+			"name": map[string]interface{}{"type": "string"},
+		}},
+		Steps: []hyancieMCP.StepConfig{
+			{Name: "create", Request: hyancieMCP.RequestConfig{Method: "POST", URL: mockAPIServer.URL + "/teams/{team}/members"}},
+			{Name: "notify", Request: hyancieMCP.RequestConfig{Method: "PUT", URL: mockAPIServer.URL + "/notify", ContentType: "application/x-www-form-urlencoded"}},
+		},
+	})
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]interface{}{"team": "core", "name": "Ada"}
+	_, err := handler(context.Background(), request)
+	require.NoError(t, err)
+
+	// Without body_template, the arguments not used in the URL are the body.
+	assert.Equal(t, []string{
+		`POST /teams/core/members application/json {"name":"Ada"}`,
+		`PUT /notify application/x-www-form-urlencoded name=Ada&team=core`,
+	}, bodies)
+}
+
+func TestExpandStepURL(t *testing.T) {
+	vars := map[string]interface{}{
+		"q":      "a&b c",
+		"lookup": map[string]interface{}{"id": float64(7), "slug": "x/y"},
+	}
+	expanded, err := expandStepURL("https://api.example.com/items/{lookup.slug}/{lookup.id}?q={q}&raw=1", vars)
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.example.com/items/x%2Fy/7?q=a%26b+c&raw=1", expanded)
+
+	_, err = expandStepURL("https://api.example.com/{lookup.missing}/{other}", vars)
+	require.Error(t, err)
+	assert.Equal(t, "unresolved reference {lookup.missing}, {other}", err.Error())
+}